@@ -0,0 +1,361 @@
+// Package archive exports the history of flows to a directory, as a backup
+// or to read offline.
+//
+//	m, err := archive.Export(client, "backup", &archive.Options{
+//		Flows: []string{"acme/main", "acme/ops"},
+//	})
+//
+// Running Export again on the same directory only fetches the messages
+// posted since the previous run. The directory holds:
+//
+//	archive.json                    the Manifest
+//	users.json                      every user visible to the exporting user
+//	<org>/<flow>/flow.json          the flow and its users
+//	<org>/<flow>/messages.jsonl     the messages, one per line, oldest first
+//	<org>/<flow>/files/<id>/<name>  the file posted by message <id>
+//
+// Everything is plain JSON in the API's own format, so an archive can be
+// copied, compressed and read without this package.
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+const (
+	// Version is the version of the archive format written by Export.
+	Version = 1
+
+	// ManifestFile is the name of the manifest in an archive directory.
+	ManifestFile = "archive.json"
+
+	// MessagesFile is the name of the messages file in a flow's directory.
+	MessagesFile = "messages.jsonl"
+
+	pageSize = 100
+)
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Version int                   `json:"version"`
+	Updated time.Time             `json:"updated"`
+	Flows   map[string]*FlowState `json:"flows"` // by "org/flow"
+}
+
+// FlowState records how much of a flow has been archived.
+type FlowState struct {
+	ID            string `json:"id"`
+	LastMessageID int    `json:"last_message_id"`
+	Messages      int    `json:"messages"`
+	Files         int    `json:"files"`
+
+	// Size is the length of the messages file after the last run. Anything
+	// written past it by an interrupted run is discarded by the next one.
+	Size int64 `json:"size"`
+}
+
+// Options specifies the optional parameters to Export.
+type Options struct {
+	// Flows lists the flows to export as "org/flow". When empty, every flow
+	// the user has joined is exported.
+	Flows []string
+
+	// SkipFiles leaves out the files posted to the flows.
+	SkipFiles bool
+
+	// Progress, if set, is called with the number of new messages fetched
+	// from a flow so far, after each page.
+	Progress func(flow string, fetched int)
+}
+
+// ReadManifest reads the manifest of the archive in dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("archive: %v: %v", ManifestFile, err)
+	}
+	if m.Version > Version {
+		return nil, fmt.Errorf("archive: %v has format version %d, newer than %d", dir, m.Version, Version)
+	}
+	if m.Flows == nil {
+		m.Flows = make(map[string]*FlowState)
+	}
+	return m, nil
+}
+
+// Export archives flows to dir, creating it if needed. When dir already
+// holds an archive only the messages posted since are fetched and appended.
+// The manifest is saved after each flow, so a failed export loses at most
+// the work on one flow.
+func Export(client *flowdock.Client, dir string, opt *Options) (*Manifest, error) {
+	if opt == nil {
+		opt = new(Options)
+	}
+	m, err := ReadManifest(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		m = &Manifest{Flows: make(map[string]*FlowState)}
+	} else if err != nil {
+		return nil, err
+	}
+	m.Version = Version
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	flows, err := listFlows(client, opt.Flows)
+	if err != nil {
+		return nil, err
+	}
+	users, _, err := client.Users.All()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeJSON(filepath.Join(dir, "users.json"), users); err != nil {
+		return nil, err
+	}
+
+	for _, f := range flows {
+		name := flowName(f)
+		state := m.Flows[name]
+		if state == nil {
+			state = new(FlowState)
+		}
+		if err := exportFlow(client, dir, name, f, state, opt); err != nil {
+			return m, fmt.Errorf("archive: %v: %w", name, err)
+		}
+		m.Flows[name] = state
+		m.Updated = time.Now().UTC()
+		if err := writeJSON(filepath.Join(dir, ManifestFile), m); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// ReadMessages calls fn for each archived message of flow, given as
+// "org/flow", oldest first.
+func ReadMessages(dir, flow string, fn func(flowdock.Message) error) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(flow), MessagesFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var m flowdock.Message
+		if err := dec.Decode(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("archive: %v: %v", flow, err)
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+// FilePath returns where the file posted by m, a "file" message of flow, is
+// kept in the archive in dir. It returns "" for other messages.
+func FilePath(dir, flow string, m flowdock.Message) string {
+	if m.ID == nil || m.Event == nil || *m.Event != "file" || m.RawContent == nil {
+		return ""
+	}
+	var content flowdock.FileContent
+	if err := json.Unmarshal(*m.RawContent, &content); err != nil || content.FileName == nil {
+		return ""
+	}
+	name := filepath.Base(filepath.FromSlash(*content.FileName))
+	return filepath.Join(dir, filepath.FromSlash(flow), "files", strconv.Itoa(*m.ID), name)
+}
+
+// listFlows returns the named flows, or every joined flow if there are none.
+func listFlows(client *flowdock.Client, names []string) ([]flowdock.Flow, error) {
+	var flows []flowdock.Flow
+	if len(names) == 0 {
+		all, _, err := client.Flows.List(false, &flowdock.FlowsListOptions{User: true})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range all {
+			if f.Joined == nil || *f.Joined {
+				flows = append(flows, f)
+			}
+		}
+	}
+	for _, name := range names {
+		org, flow, ok := strings.Cut(name, "/")
+		if !ok {
+			return nil, fmt.Errorf("archive: flow %q is not named org/flow", name)
+		}
+		f, _, err := client.Flows.Get(org, flow)
+		if err != nil {
+			return nil, fmt.Errorf("archive: %v: %w", name, err)
+		}
+		flows = append(flows, *f)
+	}
+	return flows, nil
+}
+
+func flowName(f flowdock.Flow) string {
+	var org string
+	if f.Organization != nil && f.Organization.ParameterizedName != nil {
+		org = *f.Organization.ParameterizedName
+	}
+	return org + "/" + *f.ParameterizedName
+}
+
+func exportFlow(client *flowdock.Client, dir, name string, f flowdock.Flow, state *FlowState, opt *Options) error {
+	flowDir := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(flowDir, 0755); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(flowDir, "flow.json"), f); err != nil {
+		return err
+	}
+	state.ID = *f.Id
+
+	org, flow, _ := strings.Cut(name, "/")
+	progress := func(n int) {
+		if opt.Progress != nil {
+			opt.Progress(name, n)
+		}
+	}
+	messages, err := fetchSince(client, org, flow, state.LastMessageID, progress)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(flowDir, MessagesFile), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Truncate(state.Size); err != nil {
+		return err
+	}
+	if _, err := file.Seek(state.Size, io.SeekStart); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, m := range messages {
+		if path := FilePath(dir, name, m); path != "" && !opt.SkipFiles {
+			ok, err := download(client, m, path)
+			if err != nil {
+				return err
+			}
+			if ok {
+				state.Files++
+			}
+		}
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+		state.Messages++
+		state.LastMessageID = *m.ID
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	state.Size, err = file.Seek(0, io.SeekCurrent)
+	return err
+}
+
+// fetchSince pages back through a flow's messages until it reaches the
+// message with ID after, and returns the newer ones oldest first.
+func fetchSince(client *flowdock.Client, org, flow string, after int, progress func(int)) ([]flowdock.Message, error) {
+	opt := &flowdock.MessagesListOptions{Limit: pageSize}
+
+	var messages []flowdock.Message
+	for {
+		page, _, err := client.Messages.List(org, flow, opt)
+		if err != nil {
+			return nil, err
+		}
+		oldest := 0
+		for _, m := range page {
+			if m.ID == nil {
+				continue
+			}
+			if oldest == 0 || *m.ID < oldest {
+				oldest = *m.ID
+			}
+			if *m.ID > after {
+				messages = append(messages, m)
+			}
+		}
+		progress(len(messages))
+		if len(page) < pageSize || oldest == 0 || oldest <= after {
+			break
+		}
+		opt.UntilId = oldest
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return *messages[i].ID < *messages[j].ID })
+	return messages, nil
+}
+
+// download saves the file of m to path. It reports false if the file has
+// been deleted from the flow.
+func download(client *flowdock.Client, m flowdock.Message, path string) (bool, error) {
+	var content flowdock.FileContent
+	if err := json.Unmarshal(*m.RawContent, &content); err != nil || content.Path == nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Messages.Download(*content.Path, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("file of message %d: %w", *m.ID, err)
+	}
+	return true, os.Rename(tmp, path)
+}
+
+// writeJSON replaces the file at path with v as indented JSON.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
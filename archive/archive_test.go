@@ -0,0 +1,136 @@
+package archive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/flowdocktest"
+)
+
+func setup(t *testing.T) *flowdocktest.Server {
+	srv := flowdocktest.NewServer()
+	t.Cleanup(srv.Close)
+
+	srv.AddOrganization("acme", "Acme")
+	bot := srv.AddUser("bot", "Bot", "bot@example.com")
+	for _, name := range []string{"main", "ops"} {
+		if _, err := srv.AddFlow("acme", name, *bot.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return srv
+}
+
+func addMessages(t *testing.T, srv *flowdocktest.Server, flow string, n int) {
+	for i := 0; i < n; i++ {
+		event := "message"
+		raw := json.RawMessage(strconv.Quote("message " + strconv.Itoa(i)))
+		if _, err := srv.AddMessage("acme", flow, flowdock.Message{Event: &event, RawContent: &raw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readIDs(t *testing.T, dir, flow string) []int {
+	var ids []int
+	err := ReadMessages(dir, flow, func(m flowdock.Message) error {
+		ids = append(ids, *m.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestExport(t *testing.T) {
+	srv := setup(t)
+	client := srv.Client()
+	addMessages(t, srv, "main", 150)
+	addMessages(t, srv, "ops", 3)
+	file, _, err := client.Messages.Upload("acme", "main", strings.NewReader("ok\n"), &flowdock.MessagesUploadOptions{FileName: "build.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	m, err := Export(client, dir, nil)
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+
+	state := m.Flows["acme/main"]
+	if len(m.Flows) != 2 || state == nil || state.Messages != 151 || state.Files != 1 || state.LastMessageID != *file.ID {
+		t.Fatalf("Export returned manifest with flows %+v", m.Flows)
+	}
+	ids := readIDs(t, dir, "acme/main")
+	if len(ids) != 151 {
+		t.Fatalf("archived %d messages, want 151", len(ids))
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("archived messages out of order: %v", ids)
+		}
+	}
+
+	data, err := os.ReadFile(FilePath(dir, "acme/main", *file))
+	if err != nil || string(data) != "ok\n" {
+		t.Errorf("archived file is %q (%v), want %q", data, err, "ok\n")
+	}
+	for _, name := range []string{ManifestFile, "users.json", "acme/main/flow.json", "acme/ops/" + MessagesFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("archive has no %v: %v", name, err)
+		}
+	}
+}
+
+func TestExport_incremental(t *testing.T) {
+	srv := setup(t)
+	client := srv.Client()
+	addMessages(t, srv, "main", 5)
+
+	dir := t.TempDir()
+	opt := &Options{Flows: []string{"acme/main"}}
+	if _, err := Export(client, dir, opt); err != nil {
+		t.Fatal(err)
+	}
+
+	// an interrupted run leaves a partial line behind
+	f, err := os.OpenFile(filepath.Join(dir, "acme/main", MessagesFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id": 999, "ev`)
+	f.Close()
+
+	addMessages(t, srv, "main", 120)
+	var fetched int
+	opt.Progress = func(flow string, n int) { fetched = n }
+	m, err := Export(client, dir, opt)
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+
+	if fetched != 120 {
+		t.Errorf("second export fetched %d messages, want 120", fetched)
+	}
+	if len(m.Flows) != 1 || m.Flows["acme/main"].Messages != 125 {
+		t.Errorf("Export returned manifest with flows %+v", m.Flows)
+	}
+	if ids := readIDs(t, dir, "acme/main"); len(ids) != 125 {
+		t.Errorf("archived %d messages, want 125", len(ids))
+	}
+}
+
+func TestReadManifest_newer(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ManifestFile), []byte(`{"version": 99}`), 0644)
+	if _, err := ReadManifest(dir); err == nil {
+		t.Error("ReadManifest of a newer format returned no error")
+	}
+}
@@ -0,0 +1,312 @@
+// Package index searches the messages of an archive made by package archive
+// offline.
+//
+// The index is kept in the archive directory and brought up to date with
+// the archive whenever it is opened:
+//
+//	ix, err := index.Open("backup")
+//	res, err := ix.Search(`deploy -staging tag:prod after:2024-01-01`, &index.SearchOptions{Limit: 20})
+//	for _, hit := range res.Hits {
+//		fmt.Println(hit.Flow, hit.ID, hit.Snippet)
+//	}
+//
+// A query is a list of words, all of which must appear in a message. Words
+// are matched case-insensitively and whole. A query can also have:
+//
+//	"deploy failed"         a phrase: the words next to each other
+//	deploy OR release       either word
+//	-staging, NOT staging   messages without the word
+//	(a OR b) c              grouping
+//	tag:deploy              messages with a tag
+//	user:alice              messages by a user, by nick or ID
+//	event:comment           messages of an event type
+//	flow:acme/main          messages in a flow, or flow:main
+//	after:2024-01-01        messages sent on or after a day
+//	before:2024-02-01       messages sent before a day
+//
+// Hits are ranked by BM25 relevance to the query's words.
+package index
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/wm/go-flowdock/archive"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// FileName is the name of the index in an archive directory.
+const FileName = "index.gob"
+
+// formatVersion is bumped when indexData changes, to rebuild old indexes.
+const formatVersion = 1
+
+// skipEvents are not indexed: they have no text worth searching.
+var skipEvents = map[string]bool{
+	"activity.user": true,
+	"user-edit":     true,
+	"tag-change":    true,
+	"action":        true,
+	"message-edit":  true,
+}
+
+// Index is a full-text index of an archive.
+type Index struct {
+	dir  string
+	data indexData
+}
+
+// indexData is the part of an Index saved to disk.
+type indexData struct {
+	Version  int
+	Docs     []doc
+	Postings map[string][]posting
+	Flows    map[string]int    // last message ID indexed, by flow
+	Nicks    map[string]string // by user ID
+	TotalLen int
+}
+
+// doc is an indexed message.
+type doc struct {
+	Flow  string
+	ID    int
+	Sent  time.Time
+	User  string
+	Event string
+	Tags  []string
+	Text  string
+	Len   int
+}
+
+// posting lists where a term appears in a doc.
+type posting struct {
+	Doc int
+	Pos []int
+}
+
+// Open opens the index of the archive in dir, indexing the messages archived
+// since it was last opened. The index is created if it does not exist yet.
+func Open(dir string) (*Index, error) {
+	m, err := archive.ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{dir: dir}
+	if err := ix.load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if ix.data.Version != formatVersion {
+		ix.data = indexData{
+			Version:  formatVersion,
+			Postings: make(map[string][]posting),
+			Flows:    make(map[string]int),
+		}
+	}
+
+	changed, err := ix.update(m)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if err := ix.save(); err != nil {
+			return nil, err
+		}
+	}
+	return ix, nil
+}
+
+// Len returns the number of indexed messages.
+func (ix *Index) Len() int {
+	return len(ix.data.Docs)
+}
+
+func (ix *Index) load() error {
+	f, err := os.Open(filepath.Join(ix.dir, FileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// An index that cannot be read is rebuilt rather than reported.
+	if gob.NewDecoder(f).Decode(&ix.data) != nil {
+		ix.data = indexData{}
+	}
+	return nil
+}
+
+func (ix *Index) save() error {
+	path := filepath.Join(ix.dir, FileName)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(&ix.data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// update indexes the messages archived after the ones already indexed.
+func (ix *Index) update(m *archive.Manifest) (bool, error) {
+	changed := false
+	var users []flowdock.User
+	if data, err := os.ReadFile(filepath.Join(ix.dir, "users.json")); err == nil {
+		json.Unmarshal(data, &users)
+	}
+	nicks := make(map[string]string)
+	for _, u := range users {
+		if u.Id != nil && u.Nick != nil {
+			nicks[strconv.Itoa(*u.Id)] = *u.Nick
+		}
+	}
+	if len(nicks) != len(ix.data.Nicks) {
+		changed = true
+	}
+	ix.data.Nicks = nicks
+
+	names := make([]string, 0, len(m.Flows))
+	for name := range m.Flows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		last := ix.data.Flows[name]
+		if m.Flows[name].LastMessageID <= last {
+			continue
+		}
+		err := archive.ReadMessages(ix.dir, name, func(msg flowdock.Message) error {
+			if msg.ID != nil && *msg.ID > last {
+				ix.add(name, msg)
+			}
+			return nil
+		})
+		if err != nil {
+			return changed, err
+		}
+		ix.data.Flows[name] = m.Flows[name].LastMessageID
+		changed = true
+	}
+	return changed, nil
+}
+
+func (ix *Index) add(flow string, m flowdock.Message) {
+	if m.Event == nil || skipEvents[*m.Event] {
+		return
+	}
+	d := doc{Flow: flow, ID: *m.ID, Event: *m.Event, Text: messageText(m)}
+	if m.Sent != nil {
+		d.Sent = m.Sent.Time
+	}
+	if m.UserID != nil {
+		d.User = *m.UserID
+	}
+	if m.Tags != nil {
+		d.Tags = *m.Tags
+	}
+
+	n := len(ix.data.Docs)
+	positions := make(map[string][]int)
+	toks := tokenize(d.Text)
+	for i, t := range toks {
+		positions[t.term] = append(positions[t.term], i)
+	}
+	for term, pos := range positions {
+		ix.data.Postings[term] = append(ix.data.Postings[term], posting{Doc: n, Pos: pos})
+	}
+	d.Len = len(toks)
+	ix.data.TotalLen += d.Len
+	ix.data.Docs = append(ix.data.Docs, d)
+}
+
+// messageText returns the searchable text of a message.
+func messageText(m flowdock.Message) string {
+	if m.RawContent == nil {
+		return ""
+	}
+	switch *m.Event {
+	case "message":
+		var s string
+		json.Unmarshal(*m.RawContent, &s)
+		return s
+	case "comment":
+		var c flowdock.CommentContent
+		if json.Unmarshal(*m.RawContent, &c) == nil && c.Text != nil {
+			return *c.Text
+		}
+		return ""
+	case "file":
+		var c flowdock.FileContent
+		if json.Unmarshal(*m.RawContent, &c) == nil && c.FileName != nil {
+			return *c.FileName
+		}
+		return ""
+	}
+
+	// Other events, like mail and vcs, have structured content: search all
+	// of its strings.
+	var v interface{}
+	if json.Unmarshal(*m.RawContent, &v) != nil {
+		return ""
+	}
+	var parts []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			parts = append(parts, v)
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(v[k])
+			}
+		}
+	}
+	walk(v)
+	return strings.Join(parts, "\n")
+}
+
+// token is a word of text and where it is.
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits s into lower-case words of letters and digits.
+func tokenize(s string) []token {
+	var toks []token
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			toks = append(toks, token{strings.ToLower(s[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		toks = append(toks, token{strings.ToLower(s[start:]), start, len(s)})
+	}
+	return toks
+}
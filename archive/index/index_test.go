@@ -0,0 +1,192 @@
+package index
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wm/go-flowdock/archive"
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/flowdocktest"
+)
+
+type testMessage struct {
+	flow, user, event, content string
+	day                        string
+	tags                       []string
+}
+
+var testMessages = []testMessage{
+	{"main", "alice", "message", `"Deploy failed on web, rolling back"`, "2024-01-10", []string{"deploy"}},
+	{"main", "bob", "message", `"The deploy of api went fine"`, "2024-01-20", nil},
+	{"main", "alice", "comment", `{"title": "Deploy failed on web", "text": "Fixed, deploying again"}`, "2024-02-01", nil},
+	{"ops", "bob", "mail", `{"subject": "Release 1.2 deployed to staging", "content": "<p>All good</p>"}`, "2024-02-05", []string{"staging"}},
+	{"ops", "bob", "message", `"failed to page the on-call, failed twice"`, "2024-03-01", nil},
+	{"ops", "alice", "activity.user", `{"last_activity": 1}`, "2024-03-02", nil},
+}
+
+// setup exports testMessages to an archive and returns its directory.
+func setup(t *testing.T) (*flowdocktest.Server, string) {
+	srv := flowdocktest.NewServer()
+	t.Cleanup(srv.Close)
+
+	srv.AddOrganization("acme", "Acme")
+	users := map[string]string{
+		"alice": strconv.Itoa(*srv.AddUser("alice", "Alice", "alice@example.com").Id),
+		"bob":   strconv.Itoa(*srv.AddUser("bob", "Bob", "bob@example.com").Id),
+	}
+	for _, name := range []string{"main", "ops"} {
+		if _, err := srv.AddFlow("acme", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range testMessages {
+		addMessage(t, srv, users[m.user], m)
+	}
+
+	dir := t.TempDir()
+	if _, err := archive.Export(srv.Client(), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	return srv, dir
+}
+
+func addMessage(t *testing.T, srv *flowdocktest.Server, user string, m testMessage) {
+	sent, _ := time.ParseInLocation("2006-01-02", m.day, time.Local)
+	raw := json.RawMessage(m.content)
+	tags := append([]string{}, m.tags...)
+	_, err := srv.AddMessage("acme", m.flow, flowdock.Message{
+		UserID:     &user,
+		Event:      &m.event,
+		RawContent: &raw,
+		Tags:       &tags,
+		Sent:       &flowdock.Time{Time: sent.Add(12 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// search returns the IDs of the hits, in order.
+func search(t *testing.T, ix *Index, query string) []int {
+	res, err := ix.Search(query, nil)
+	if err != nil {
+		t.Fatalf("Search(%q) returned error: %v", query, err)
+	}
+	ids := []int{}
+	for _, hit := range res.Hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	_, dir := setup(t)
+	ix, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.Len() != 5 {
+		t.Errorf("indexed %d messages, want 5", ix.Len())
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"deploy", []int{2, 1}},
+		{"DEPLOY web", []int{1}},
+		{`"deploy failed"`, []int{1}},
+		{`"failed deploy"`, []int{}},
+		{"deploy OR deployed", []int{4, 2, 1}},
+		{"failed", []int{5, 1}},
+		{"failed -web", []int{5}},
+		{"failed NOT (web OR api)", []int{5}},
+		{"(deploy OR deploying) AND (web OR again)", []int{3, 1}},
+		{"tag:deploy", []int{1}},
+		{"tag:#staging all good", []int{4}},
+		{"user:alice", []int{3, 1}},
+		{"user:Bob failed", []int{5}},
+		{"event:comment", []int{3}},
+		{"flow:ops", []int{5, 4}},
+		{"flow:acme/main fine", []int{2}},
+		{"after:2024-01-20 before:2024-02-05", []int{3, 2}},
+		{"last_activity", []int{}},
+	}
+	for _, tt := range tests {
+		if got := search(t, ix, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearch_errors(t *testing.T) {
+	_, dir := setup(t)
+	ix, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"", "(deploy", "deploy)", "deploy OR", "NOT", "after:yesterday"} {
+		if _, err := ix.Search(query, nil); err == nil {
+			t.Errorf("Search(%q) returned no error", query)
+		}
+	}
+}
+
+func TestSearch_snippet(t *testing.T) {
+	_, dir := setup(t)
+	ix, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ix.Search("page", &SearchOptions{SnippetLength: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit := res.Hits[0]
+	if hit.Snippet != "failed to page the …" || hit.User != "bob" || hit.Flow != "acme/ops" {
+		t.Errorf("Search returned %+v", hit)
+	}
+	for _, h := range hit.Highlights {
+		if word := hit.Snippet[h[0]:h[1]]; word != "page" {
+			t.Errorf("Search highlighted %q, want %q", word, "page")
+		}
+	}
+}
+
+func TestOpen_incremental(t *testing.T) {
+	srv, dir := setup(t)
+	if _, err := Open(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	addMessage(t, srv, "1", testMessage{"main", "", "message", `"deploy again"`, "2024-04-01", nil})
+	if _, err := archive.Export(srv.Client(), dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := search(t, ix, "deploy"); !reflect.DeepEqual(got, []int{7, 2, 1}) {
+		t.Errorf("Search after a new export = %v, want [7 2 1]", got)
+	}
+	if ix.Len() != 6 {
+		t.Errorf("indexed %d messages, want 6", ix.Len())
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	var terms []string
+	for _, tok := range tokenize("Héllo, wörld! v1.2 on-call") {
+		terms = append(terms, tok.term)
+	}
+	want := "héllo wörld v1 2 on call"
+	if got := strings.Join(terms, " "); got != want {
+		t.Errorf("tokenize returned %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,536 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchOptions specifies the optional parameters to Index.Search.
+type SearchOptions struct {
+	// Limit is the most hits returned. Zero returns every hit.
+	Limit int
+
+	// Newest sorts hits newest first instead of by relevance.
+	Newest bool
+
+	// SnippetLength is the length of snippets in bytes, 160 by default.
+	SnippetLength int
+}
+
+// Results are the hits of a search.
+type Results struct {
+	Total int   `json:"total"` // number of matching messages
+	Hits  []Hit `json:"hits"`
+}
+
+// Hit is a message matching a search.
+type Hit struct {
+	Flow    string    `json:"flow"`
+	ID      int       `json:"id"`
+	Sent    time.Time `json:"sent"`
+	User    string    `json:"user"` // nick, or ID if the user is unknown
+	Event   string    `json:"event"`
+	Tags    []string  `json:"tags,omitempty"`
+	Score   float64   `json:"score"`
+	Snippet string    `json:"snippet"`
+
+	// Highlights are the byte offsets of the start and end of each word of
+	// the snippet matching the query.
+	Highlights [][2]int `json:"highlights,omitempty"`
+}
+
+// Search returns the messages matching query. See the package
+// documentation for the query syntax.
+func (ix *Index) Search(query string, opt *SearchOptions) (*Results, error) {
+	if opt == nil {
+		opt = new(SearchOptions)
+	}
+	p := &parser{ix: ix, toks: lex(query)}
+	if len(p.toks) == 0 {
+		return nil, fmt.Errorf("index: empty query")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("index: unexpected %q in query", p.toks[p.pos].text)
+	}
+
+	matches := n.eval(ix)
+	terms := make(map[string]bool)
+	for _, t := range p.terms {
+		terms[t] = true
+	}
+	var docs []int
+	scores := make(map[int]float64)
+	for i := range ix.data.Docs {
+		if matches.has(i) {
+			docs = append(docs, i)
+			scores[i] = ix.score(i, terms)
+		}
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, b := docs[i], docs[j]
+		if !opt.Newest && scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return ix.data.Docs[a].Sent.After(ix.data.Docs[b].Sent)
+	})
+
+	res := &Results{Total: len(docs), Hits: []Hit{}}
+	if opt.Limit > 0 && len(docs) > opt.Limit {
+		docs = docs[:opt.Limit]
+	}
+	width := opt.SnippetLength
+	if width <= 0 {
+		width = 160
+	}
+	for _, i := range docs {
+		d := ix.data.Docs[i]
+		hit := Hit{Flow: d.Flow, ID: d.ID, Sent: d.Sent, User: d.User, Event: d.Event, Tags: d.Tags, Score: scores[i]}
+		if nick, ok := ix.data.Nicks[d.User]; ok {
+			hit.User = nick
+		}
+		hit.Snippet, hit.Highlights = snippet(d.Text, terms, width)
+		res.Hits = append(res.Hits, hit)
+	}
+	return res, nil
+}
+
+// score returns the BM25 score of doc i for terms.
+func (ix *Index) score(i int, terms map[string]bool) float64 {
+	const k1, b = 1.2, 0.75
+	n := float64(len(ix.data.Docs))
+	avg := math.Max(float64(ix.data.TotalLen)/n, 1)
+	dl := float64(ix.data.Docs[i].Len)
+
+	var score float64
+	for term := range terms {
+		postings := ix.data.Postings[term]
+		p := findPosting(postings, i)
+		if p == nil {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		tf := float64(len(p.Pos))
+		score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*dl/avg))
+	}
+	return score
+}
+
+func findPosting(postings []posting, doc int) *posting {
+	i := sort.Search(len(postings), func(i int) bool { return postings[i].Doc >= doc })
+	if i < len(postings) && postings[i].Doc == doc {
+		return &postings[i]
+	}
+	return nil
+}
+
+// snippet returns about width bytes of text around the first word in terms,
+// on one line, and where the words in terms are in it.
+func snippet(text string, terms map[string]bool, width int) (string, [][2]int) {
+	toks := tokenize(text)
+	lo, hi := 0, len(text)
+	if len(text) > width {
+		first := 0
+		for i, t := range toks {
+			if terms[t.term] {
+				first = i
+				break
+			}
+		}
+		if len(toks) > 0 {
+			lo = toks[first].start - width/3
+		}
+		if lo < 0 {
+			lo = 0
+		}
+		// don't cut words in two
+		for _, t := range toks {
+			if t.end > lo {
+				if t.start < lo {
+					lo = t.start
+				}
+				break
+			}
+		}
+		hi = lo + width
+		if hi > len(text) {
+			hi = len(text)
+		}
+		for _, t := range toks {
+			if t.start < hi && t.end > hi {
+				hi = t.start
+			}
+		}
+		for lo > 0 && !utf8.RuneStart(text[lo]) {
+			lo--
+		}
+		for hi < len(text) && !utf8.RuneStart(text[hi]) {
+			hi--
+		}
+	}
+
+	var prefix, suffix string
+	if lo > 0 {
+		prefix = "…"
+	}
+	if hi < len(text) {
+		suffix = "…"
+	}
+	var highlights [][2]int
+	for _, t := range toks {
+		if t.start >= lo && t.end <= hi && terms[t.term] {
+			highlights = append(highlights, [2]int{len(prefix) + t.start - lo, len(prefix) + t.end - lo})
+		}
+	}
+	s := strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, text[lo:hi])
+	return prefix + s + suffix, highlights
+}
+
+// A qtoken is a token of a query.
+type qtoken struct {
+	kind byte // '(', ')', '-', '"' for a phrase, or 'w' for a word
+	text string
+}
+
+func lex(query string) []qtoken {
+	var toks []qtoken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, qtoken{c, string(c)})
+			i++
+		case c == '-' && i+1 < len(query) && !strings.ContainsRune(" \t\n)", rune(query[i+1])):
+			toks = append(toks, qtoken{'-', "-"})
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				end = len(query) - i - 1
+			}
+			toks = append(toks, qtoken{'"', query[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			end := strings.IndexAny(query[i:], " \t\n()\"")
+			if end < 0 {
+				end = len(query) - i
+			}
+			toks = append(toks, qtoken{'w', query[i : i+end]})
+			i += end
+		}
+	}
+	return toks
+}
+
+// parser parses a query into a tree of nodes. It collects the words that
+// are not negated to rank and highlight the hits.
+type parser struct {
+	ix    *Index
+	toks  []qtoken
+	pos   int
+	neg   bool
+	terms []string
+}
+
+func (p *parser) peek() *qtoken {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *parser) isWord(t *qtoken, word string) bool {
+	return t != nil && t.kind == 'w' && t.text == word
+}
+
+func (p *parser) parseOr() (node, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := orNode{n}
+	for p.isWord(p.peek(), "OR") {
+		p.pos++
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, n)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	var and andNode
+	for {
+		t := p.peek()
+		if t == nil || t.kind == ')' || p.isWord(t, "OR") {
+			break
+		}
+		if p.isWord(t, "AND") {
+			p.pos++
+			continue
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, n)
+	}
+	switch len(and) {
+	case 0:
+		if t := p.peek(); t != nil {
+			return nil, fmt.Errorf("index: unexpected %q in query", t.text)
+		}
+		return nil, fmt.Errorf("index: query ends early")
+	case 1:
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("index: query ends early")
+	}
+	if t.kind == '-' || p.isWord(t, "NOT") {
+		p.pos++
+		p.neg = !p.neg
+		n, err := p.parseUnary()
+		p.neg = !p.neg
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case '(':
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != ')' {
+			return nil, fmt.Errorf("index: missing ) in query")
+		}
+		p.pos++
+		return n, nil
+	case ')':
+		return nil, fmt.Errorf("index: unexpected ) in query")
+	case 'w':
+		if field, value, ok := strings.Cut(t.text, ":"); ok && value != "" {
+			if n, ok, err := p.filter(field, value); ok {
+				return n, err
+			}
+		}
+	}
+	return p.phrase(t.text), nil
+}
+
+// phrase returns a node matching the words of s next to each other.
+func (p *parser) phrase(s string) node {
+	var terms []string
+	for _, t := range tokenize(s) {
+		terms = append(terms, t.term)
+	}
+	if len(terms) == 0 {
+		return allNode{}
+	}
+	if !p.neg {
+		p.terms = append(p.terms, terms...)
+	}
+	return phraseNode(terms)
+}
+
+// filter returns a node for a field:value word, or false if field is not
+// one that can be filtered on.
+func (p *parser) filter(field, value string) (node, bool, error) {
+	switch field {
+	case "tag":
+		tag := strings.ToLower(strings.TrimPrefix(value, "#"))
+		return filterNode(func(d *doc) bool {
+			for _, t := range d.Tags {
+				if strings.ToLower(strings.TrimPrefix(t, "#")) == tag {
+					return true
+				}
+			}
+			return false
+		}), true, nil
+	case "user":
+		id := value
+		for uid, nick := range p.ix.data.Nicks {
+			if strings.EqualFold(nick, value) {
+				id = uid
+			}
+		}
+		return filterNode(func(d *doc) bool { return d.User == id }), true, nil
+	case "event":
+		return filterNode(func(d *doc) bool { return d.Event == value }), true, nil
+	case "flow":
+		return filterNode(func(d *doc) bool {
+			_, name, _ := strings.Cut(d.Flow, "/")
+			return d.Flow == value || name == value
+		}), true, nil
+	case "after", "before":
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, true, fmt.Errorf("index: %v: want a date like 2024-01-31", field)
+		}
+		if field == "after" {
+			return filterNode(func(d *doc) bool { return !d.Sent.Before(day) }), true, nil
+		}
+		return filterNode(func(d *doc) bool { return d.Sent.Before(day) }), true, nil
+	}
+	return nil, false, nil
+}
+
+// A node of a query evaluates to the set of docs it matches.
+type node interface {
+	eval(ix *Index) bitset
+}
+
+type andNode []node
+
+func (n andNode) eval(ix *Index) bitset {
+	s := n[0].eval(ix)
+	for _, c := range n[1:] {
+		s.and(c.eval(ix))
+	}
+	return s
+}
+
+type orNode []node
+
+func (n orNode) eval(ix *Index) bitset {
+	s := n[0].eval(ix)
+	for _, c := range n[1:] {
+		s.or(c.eval(ix))
+	}
+	return s
+}
+
+type notNode struct{ n node }
+
+func (n notNode) eval(ix *Index) bitset {
+	s := n.n.eval(ix)
+	s.not(len(ix.data.Docs))
+	return s
+}
+
+type allNode struct{}
+
+func (allNode) eval(ix *Index) bitset {
+	s := newBitset(len(ix.data.Docs))
+	s.not(len(ix.data.Docs))
+	return s
+}
+
+type filterNode func(d *doc) bool
+
+func (f filterNode) eval(ix *Index) bitset {
+	s := newBitset(len(ix.data.Docs))
+	for i := range ix.data.Docs {
+		if f(&ix.data.Docs[i]) {
+			s.set(i)
+		}
+	}
+	return s
+}
+
+// phraseNode matches docs with its terms next to each other, in order.
+type phraseNode []string
+
+func (n phraseNode) eval(ix *Index) bitset {
+	s := newBitset(len(ix.data.Docs))
+	first := ix.data.Postings[n[0]]
+next:
+	for _, p := range first {
+		if len(n) == 1 {
+			s.set(p.Doc)
+			continue
+		}
+		rest := make([]*posting, len(n)-1)
+		for i, term := range n[1:] {
+			if rest[i] = findPosting(ix.data.Postings[term], p.Doc); rest[i] == nil {
+				continue next
+			}
+		}
+	start:
+		for _, pos := range p.Pos {
+			for i, r := range rest {
+				if !hasPosition(r.Pos, pos+i+1) {
+					continue start
+				}
+			}
+			s.set(p.Doc)
+			break
+		}
+	}
+	return s
+}
+
+func hasPosition(positions []int, pos int) bool {
+	i := sort.SearchInts(positions, pos)
+	return i < len(positions) && positions[i] == pos
+}
+
+// bitset is a set of doc numbers.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (s bitset) set(i int) {
+	s[i/64] |= 1 << (i % 64)
+}
+
+func (s bitset) has(i int) bool {
+	return s[i/64]&(1<<(i%64)) != 0
+}
+
+func (s bitset) and(t bitset) {
+	for i := range s {
+		s[i] &= t[i]
+	}
+}
+
+func (s bitset) or(t bitset) {
+	for i := range s {
+		s[i] |= t[i]
+	}
+}
+
+// not complements the set of n docs.
+func (s bitset) not(n int) {
+	for i := range s {
+		s[i] = ^s[i]
+	}
+	if n%64 != 0 {
+		s[len(s)-1] &= 1<<(n%64) - 1
+	}
+}
@@ -1,86 +1,308 @@
-// Basic OAuth2 command line helper.
-// This code is based on the example found at https://code.google.com/p/goauth2/source/browse/oauth/example/oauthreq.go
-// See LICENSE-GOOGLE
-
+// Package auth obtains OAuth2 credentials for the Flowdock API.
+//
+// A Config describes the OAuth2 application. Once a token has been obtained,
+// Client returns an *http.Client that refreshes it as needed, suitable for
+// flowdock.NewClient:
+//
+//	config := &auth.Config{ClientID: id, ClientSecret: secret, Profile: "work"}
+//	httpClient, err := config.Authenticate(ctx, code)
+//	if err != nil {
+//		// an *auth.AuthorizationRequiredError carries the URL to visit
+//	}
+//	client := flowdock.NewClient(httpClient)
+//
+// Nothing in this package reads global flags, prints or exits.
 package auth
 
 import (
-	"code.google.com/p/goauth2/oauth"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
 )
 
-var (
-	clientId     = flag.String("id", "", "Client ID")
-	clientSecret = flag.String("secret", "", "Client Secret")
-	scope        = flag.String("scope", "flow private manage profile offline_access", "OAuth scope")
-	redirectURL  = flag.String("redirect_url", "urn:ietf:wg:oauth:2.0:oob", "Redirect URL")
-	authURL      = flag.String("auth_url", "https://api.flowdock.com/oauth/authorize", "Authentication URL")
-	tokenURL     = flag.String("token_url", "https://api.flowdock.com/oauth/token", "Token URL")
-	code         = flag.String("code", "", "Authorization Code")
-	cachefile    = flag.String("cache", "cache.json", "Token cache file")
+const (
+	// OutOfBandRedirectURL makes Flowdock display the authorization code
+	// instead of redirecting to the application.
+	OutOfBandRedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+
+	defaultAuthURL  = "https://api.flowdock.com/oauth/authorize"
+	defaultTokenURL = "https://api.flowdock.com/oauth/token"
 )
 
-const usageMsg = `
-To obtain a request token you must specify both -id and -secret.
+// DefaultScopes are requested when Config.Scopes is empty.
+var DefaultScopes = []string{"flow", "private", "manage", "profile", "offline_access"}
+
+// Endpoint is Flowdock's OAuth 2.0 endpoint.
+var Endpoint = oauth2.Endpoint{
+	AuthURL:  defaultAuthURL,
+	TokenURL: defaultTokenURL,
+}
+
+// ErrNoToken is returned when no token has been saved yet.
+var ErrNoToken = errors.New("auth: no saved token")
+
+// Config describes a Flowdock OAuth2 application.
+//
+// To obtain a client ID and secret, see the "OAuth 2 Credentials" section
+// under the "API Access" tab on
+// https://flowdock.com/account/authorized_applications
+type Config struct {
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL defaults to OutOfBandRedirectURL.
+	RedirectURL string
 
-To obtain Client ID and Secret, see the "OAuth 2 Credentials" section under
-the "API Access" tab on this page: https://flowdock.com/account/authorized_applications
+	// Scopes defaults to DefaultScopes.
+	Scopes []string
 
-Once you have completed the OAuth flow, the credentials should be stored inside
-the file specified by -cache and you may run without the -id and -secret flags.
-`
+	// AuthURL and TokenURL default to Endpoint.
+	AuthURL  string
+	TokenURL string
 
-func AuthenticationRequest() *http.Client {
-	flag.Parse()
+	// Store saves the token after the authorization code is exchanged and
+	// every time it is refreshed. If nil, DefaultStore is used.
+	Store TokenStore
+
+	// Profile names the token in Store. If empty, the ProfileEnv
+	// environment variable is used, then DefaultProfile.
+	Profile string
+}
 
-	// Set up a configuration.
-	config := &oauth.Config{
-		ClientId:     *clientId,
-		ClientSecret: *clientSecret,
-		RedirectURL:  *redirectURL,
-		Scope:        *scope,
-		AuthURL:      *authURL,
-		TokenURL:     *tokenURL,
-		TokenCache:   oauth.CacheFile(*cachefile),
+// OAuth2 returns the equivalent oauth2.Config, with defaults applied.
+func (c *Config) OAuth2() *oauth2.Config {
+	oc := &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURL:  c.RedirectURL,
+		Scopes:       c.Scopes,
+		Endpoint:     Endpoint,
 	}
+	if oc.RedirectURL == "" {
+		oc.RedirectURL = OutOfBandRedirectURL
+	}
+	if len(oc.Scopes) == 0 {
+		oc.Scopes = DefaultScopes
+	}
+	if c.AuthURL != "" {
+		oc.Endpoint.AuthURL = c.AuthURL
+	}
+	if c.TokenURL != "" {
+		oc.Endpoint.TokenURL = c.TokenURL
+	}
+	return oc
+}
 
-	// Set up a Transport using the config.
-	transport := &oauth.Transport{Config: config}
+// AuthCodeURL returns the URL of the page asking the user to authorize the
+// application.
+func (c *Config) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
+	return c.OAuth2().AuthCodeURL(state, opts...)
+}
 
-	// Try to pull the token from the cache; if this fails, we need to get one.
-	token, err := config.TokenCache.Token()
+// Exchange converts an authorization code into a token and saves it to the
+// profile.
+func (c *Config) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	tok, err := c.OAuth2().Exchange(ctx, code, opts...)
 	if err != nil {
-		if *clientId == "" || *clientSecret == "" {
-			flag.Usage()
-			fmt.Fprint(os.Stderr, usageMsg)
-			os.Exit(2)
-		}
-		if *code == "" {
-			// Get an authorization code from the data provider.
-			// ("Please ask the user if I can access this resource.")
-			url := config.AuthCodeURL("")
-			fmt.Println("Visit this URL to get a code, then run again with -code=YOUR_CODE\n")
-			fmt.Println(url)
-			os.Exit(0)
+		return nil, err
+	}
+	if err := c.saveToken(tok); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// Token returns the access token set in the TokenEnv environment variable
+// or, without one, the profile's saved token. It returns ErrNoToken if there
+// is neither.
+func (c *Config) Token() (*oauth2.Token, error) {
+	if v := os.Getenv(TokenEnv); v != "" {
+		return &oauth2.Token{AccessToken: v}, nil
+	}
+	store, err := c.store()
+	if err != nil {
+		return nil, err
+	}
+	return store.Load(c.ProfileName())
+}
+
+// ProfileName returns the profile in use: Profile, the ProfileEnv
+// environment variable or DefaultProfile.
+func (c *Config) ProfileName() string {
+	if c.Profile != "" {
+		return c.Profile
+	}
+	if v := os.Getenv(ProfileEnv); v != "" {
+		return v
+	}
+	return DefaultProfile
+}
+
+// TokenSource returns a TokenSource that returns tok until it expires, then
+// refreshes it and saves the new token to the profile.
+func (c *Config) TokenSource(ctx context.Context, tok *oauth2.Token) oauth2.TokenSource {
+	return &savingTokenSource{
+		src:  c.OAuth2().TokenSource(ctx, tok),
+		save: c.saveToken,
+		last: tok,
+	}
+}
+
+// Client returns an HTTP client authorizing requests with tok, refreshing
+// it when it expires.
+func (c *Config) Client(ctx context.Context, tok *oauth2.Token) *http.Client {
+	return oauth2.NewClient(ctx, c.TokenSource(ctx, tok))
+}
+
+// Authenticate returns a client for the saved token. Without one, it
+// exchanges code for a token, or returns an *AuthorizationRequiredError if
+// code is empty.
+func (c *Config) Authenticate(ctx context.Context, code string) (*http.Client, error) {
+	tok, err := c.Token()
+	if err == ErrNoToken {
+		if code == "" {
+			return nil, &AuthorizationRequiredError{URL: c.AuthCodeURL("")}
 		}
-		// Exchange the authorization code for an access token.
-		// ("Here's the code you gave the user, now give me a token!")
-		token, err = transport.Exchange(*code)
-		if err != nil {
-			log.Fatal("Exchange:", err)
+		tok, err = c.Exchange(ctx, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.Client(ctx, tok), nil
+}
+
+// RegisterFlags defines command-line flags setting c's fields on fs. They
+// are named after the flags of the original example commands: -id, -secret,
+// -scope, -redirect_url, -auth_url and -token_url, plus -profile.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ClientID, "id", c.ClientID, "Client ID")
+	fs.StringVar(&c.ClientSecret, "secret", c.ClientSecret, "Client Secret")
+	fs.StringVar(&c.RedirectURL, "redirect_url", orDefault(c.RedirectURL, OutOfBandRedirectURL), "Redirect URL")
+	fs.StringVar(&c.AuthURL, "auth_url", orDefault(c.AuthURL, defaultAuthURL), "Authentication URL")
+	fs.StringVar(&c.TokenURL, "token_url", orDefault(c.TokenURL, defaultTokenURL), "Token URL")
+	fs.StringVar(&c.Profile, "profile", c.Profile, "Token profile (default $"+ProfileEnv+" or "+DefaultProfile+")")
+	fs.Func("scope", "OAuth scope (default "+strings.Join(DefaultScopes, " ")+")", func(s string) error {
+		c.Scopes = strings.Fields(s)
+		return nil
+	})
+}
+
+func orDefault(value, def string) string {
+	if value != "" {
+		return value
+	}
+	return def
+}
+
+func (c *Config) store() (TokenStore, error) {
+	if c.Store != nil {
+		return c.Store, nil
+	}
+	return DefaultStore()
+}
+
+func (c *Config) saveToken(tok *oauth2.Token) error {
+	store, err := c.store()
+	if err != nil {
+		return err
+	}
+	return store.Save(c.ProfileName(), tok)
+}
+
+// AuthorizationRequiredError is returned by Config.Authenticate when the
+// user must authorize the application first.
+type AuthorizationRequiredError struct {
+	// URL is the page where the user obtains an authorization code.
+	URL string
+}
+
+func (e *AuthorizationRequiredError) Error() string {
+	return fmt.Sprintf("auth: authorization required, visit %v to get a code", e.URL)
+}
+
+// savingTokenSource saves every new token its source returns.
+type savingTokenSource struct {
+	src  oauth2.TokenSource
+	save func(*oauth2.Token) error
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil || tok.AccessToken != s.last.AccessToken {
+		if err := s.save(tok); err != nil {
+			return nil, err
 		}
-		// (The Exchange method will automatically cache the token.)
-		fmt.Printf("Token is cached in %v\n", config.TokenCache)
+		s.last = tok
+	}
+	return tok, nil
+}
+
+// tokenFile reads token files holding either oauth2.Token's JSON or the
+// cache files written by the goauth2 package this one replaced.
+type tokenFile struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+
+	LegacyAccessToken  string    `json:"AccessToken"`
+	LegacyRefreshToken string    `json:"RefreshToken"`
+	LegacyExpiry       time.Time `json:"Expiry"`
+}
+
+// ReadTokenFile reads a token saved by WriteTokenFile, or a cache file left
+// by the goauth2 package. It returns ErrNoToken if the file does not exist.
+func ReadTokenFile(path string) (*oauth2.Token, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Make the actual request using the cached token to authenticate.
-	// ("Here's the token, let me in!")
-	transport.Token = token
-	client := transport.Client()
+	var f tokenFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("auth: reading %v: %w", path, err)
+	}
+	if f.AccessToken == "" && f.LegacyAccessToken != "" {
+		f.AccessToken = f.LegacyAccessToken
+		f.RefreshToken = f.LegacyRefreshToken
+		f.Expiry = f.LegacyExpiry
+	}
+	if f.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+	return &oauth2.Token{
+		AccessToken:  f.AccessToken,
+		TokenType:    f.TokenType,
+		RefreshToken: f.RefreshToken,
+		Expiry:       f.Expiry,
+	}, nil
+}
 
-	return client
+// WriteTokenFile saves tok to path, readable only by the current user.
+func WriteTokenFile(path string, tok *oauth2.Token) error {
+	data, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, data)
 }
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenServer is a fake token endpoint handing out access tokens numbered
+// by the number of requests it received.
+func tokenServer(t *testing.T, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		r.ParseForm()
+		switch r.Form.Get("grant_type") {
+		case "authorization_code":
+			if r.Form.Get("code") != "the-code" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"bearer","refresh_token":"refresh","expires_in":3600}`, *requests)
+	}))
+}
+
+func TestConfig_Exchange(t *testing.T) {
+	var requests int
+	server := tokenServer(t, &requests)
+	defer server.Close()
+
+	dir := t.TempDir()
+	config := &Config{ClientID: "id", ClientSecret: "secret", TokenURL: server.URL, Store: &FileStore{Dir: dir}, Profile: "work"}
+
+	tok, err := config.Exchange(context.Background(), "the-code")
+	if err != nil {
+		t.Fatalf("Exchange returned error: %v", err)
+	}
+	if tok.AccessToken != "access-1" {
+		t.Errorf("Exchange returned %v, want access-1", tok.AccessToken)
+	}
+
+	saved, err := config.Token()
+	if err != nil {
+		t.Fatalf("Token returned error: %v", err)
+	}
+	if saved.AccessToken != "access-1" || saved.RefreshToken != "refresh" {
+		t.Errorf("Token returned %+v, want the exchanged token", saved)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "work.json"))
+	if err != nil {
+		t.Fatalf("token file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file permissions = %v, want 0600", perm)
+	}
+}
+
+func TestConfig_TokenSource_refresh(t *testing.T) {
+	var requests int
+	server := tokenServer(t, &requests)
+	defer server.Close()
+
+	store := &FileStore{Dir: t.TempDir()}
+	config := &Config{ClientID: "id", ClientSecret: "secret", TokenURL: server.URL, Store: store}
+	expired := &oauth2.Token{
+		AccessToken:  "old",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Hour),
+	}
+
+	ts := config.TokenSource(context.Background(), expired)
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatalf("Token returned error: %v", err)
+	}
+	if tok.AccessToken != "access-1" {
+		t.Errorf("Token returned %v, want the refreshed access-1", tok.AccessToken)
+	}
+
+	// the refreshed token is reused until it expires
+	if tok, _ = ts.Token(); tok.AccessToken != "access-1" || requests != 1 {
+		t.Errorf("second Token returned %v after %d requests, want access-1 after 1", tok.AccessToken, requests)
+	}
+
+	saved, err := store.Load(DefaultProfile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if saved.AccessToken != "access-1" {
+		t.Errorf("saved token = %v, want access-1", saved.AccessToken)
+	}
+}
+
+func TestConfig_Authenticate_authorizationRequired(t *testing.T) {
+	config := &Config{ClientID: "id", Store: &FileStore{Dir: t.TempDir()}}
+
+	_, err := config.Authenticate(context.Background(), "")
+	authErr, ok := err.(*AuthorizationRequiredError)
+	if !ok {
+		t.Fatalf("Authenticate returned %v, want an *AuthorizationRequiredError", err)
+	}
+	want := config.AuthCodeURL("")
+	if authErr.URL != want {
+		t.Errorf("AuthorizationRequiredError.URL = %v, want %v", authErr.URL, want)
+	}
+}
+
+func TestReadTokenFile_legacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	legacy := `{"AccessToken":"access","RefreshToken":"refresh","Expiry":"2014-01-02T03:04:05Z","Extra":null}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := ReadTokenFile(path)
+	if err != nil {
+		t.Fatalf("ReadTokenFile returned error: %v", err)
+	}
+	want := time.Date(2014, time.January, 2, 3, 4, 5, 0, time.UTC)
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" || !tok.Expiry.Equal(want) {
+		t.Errorf("ReadTokenFile returned %+v", tok)
+	}
+}
+
+func TestReadTokenFile_missing(t *testing.T) {
+	_, err := ReadTokenFile(filepath.Join(t.TempDir(), "missing.json"))
+	if err != ErrNoToken {
+		t.Errorf("ReadTokenFile returned %v, want ErrNoToken", err)
+	}
+}
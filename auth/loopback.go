@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	loopbackHost         = "127.0.0.1"
+	defaultCallbackPath  = "/callback"
+	loopbackSuccessPage  = "<html><body><p>Authorization complete. You can close this window.</p></body></html>"
+	loopbackFailurePage  = "<html><body><p>Authorization failed: %v</p></body></html>"
+	loopbackStateEntropy = 24
+)
+
+// LoopbackAuthorize runs the interactive authorization code flow. It starts
+// an HTTP listener on 127.0.0.1, calls open with the authorization URL (see
+// OpenBrowser), waits for Flowdock to redirect back with a code and exchanges
+// it for a token, which is saved to the profile.
+//
+// The request carries a random state and a PKCE code challenge. If
+// RedirectURL is an http://127.0.0.1 URL its port and path are used,
+// otherwise a free port is picked and the callback path is "/callback".
+func (c *Config) LoopbackAuthorize(ctx context.Context, open func(authURL string) error) (*oauth2.Token, error) {
+	addr, path := loopbackHost+":0", defaultCallbackPath
+	if u, err := url.Parse(c.RedirectURL); err == nil && u.Scheme == "http" && u.Hostname() == loopbackHost {
+		addr = u.Host
+		if u.Path != "" {
+			path = u.Path
+		}
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("auth: starting loopback listener: %w", err)
+	}
+	defer ln.Close()
+
+	flow := *c
+	flow.RedirectURL = "http://" + ln.Addr().String() + path
+
+	state, err := randomString(loopbackStateEntropy)
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var res result
+		switch {
+		case q.Get("state") != state:
+			res.err = errors.New("auth: authorization response has an invalid state")
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("auth: authorization denied: %v %v", q.Get("error"), q.Get("error_description"))
+		case q.Get("code") == "":
+			res.err = errors.New("auth: authorization response has no code")
+		default:
+			res.code = q.Get("code")
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if res.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, loopbackFailurePage, res.err)
+		} else {
+			fmt.Fprint(w, loopbackSuccessPage)
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(ln)
+	defer server.Close()
+
+	authURL := flow.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+	if err := open(authURL); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-results:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return flow.Exchange(ctx, res.code, oauth2.VerifierOption(verifier))
+	}
+}
+
+// OpenBrowser opens u in the user's default web browser.
+func OpenBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
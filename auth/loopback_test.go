@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authorizationServer is a fake OAuth2 authorization server that approves
+// every request unless deny is set, checking PKCE on the token exchange.
+type authorizationServer struct {
+	*httptest.Server
+	t          *testing.T
+	deny       bool
+	badState   bool
+	challenges map[string]string
+	redirects  map[string]string
+}
+
+func newAuthorizationServer(t *testing.T) *authorizationServer {
+	s := &authorizationServer{t: t, challenges: map[string]string{}, redirects: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", s.authorize)
+	mux.HandleFunc("/oauth/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *authorizationServer) config(store TokenStore) *Config {
+	return &Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		AuthURL:      s.URL + "/oauth/authorize",
+		TokenURL:     s.URL + "/oauth/token",
+		Store:        store,
+	}
+}
+
+func (s *authorizationServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != "id" {
+		s.t.Errorf("authorize request = %v, want a code request for client id", q)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		s.t.Errorf("authorize request has no S256 code challenge: %v", q)
+	}
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	if redirect.Hostname() != "127.0.0.1" {
+		s.t.Errorf("redirect_uri = %v, want a loopback address", redirect)
+	}
+	params := url.Values{"state": {q.Get("state")}}
+	if s.badState {
+		params.Set("state", "forged")
+	}
+	if s.deny {
+		params.Set("error", "access_denied")
+	} else {
+		code := fmt.Sprintf("code-%d", len(s.challenges)+1)
+		s.challenges[code] = q.Get("code_challenge")
+		s.redirects[code] = q.Get("redirect_uri")
+		params.Set("code", code)
+	}
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *authorizationServer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	code := r.Form.Get("code")
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenges[code] {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("redirect_uri") != s.redirects[code] {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"access_token":"access","token_type":"bearer","refresh_token":"refresh","expires_in":3600}`)
+}
+
+// browser returns an open function that behaves like a user approving the
+// request in a browser. Failures surface as LoopbackAuthorize timing out.
+func browser() func(string) error {
+	return func(authURL string) error {
+		go func() {
+			resp, err := http.Get(authURL)
+			if err != nil {
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+		return nil
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestConfig_LoopbackAuthorize(t *testing.T) {
+	server := newAuthorizationServer(t)
+	defer server.Close()
+
+	store := &FileStore{Dir: t.TempDir()}
+	tok, err := server.config(store).LoopbackAuthorize(testContext(t), browser())
+	if err != nil {
+		t.Fatalf("LoopbackAuthorize returned error: %v", err)
+	}
+	if tok.AccessToken != "access" {
+		t.Errorf("LoopbackAuthorize returned %v, want access", tok.AccessToken)
+	}
+
+	saved, err := store.Load(DefaultProfile)
+	if err != nil || saved.AccessToken != "access" {
+		t.Errorf("saved token = %v, %v; want access", saved, err)
+	}
+}
+
+func TestConfig_LoopbackAuthorize_redirectURL(t *testing.T) {
+	server := newAuthorizationServer(t)
+	defer server.Close()
+
+	config := server.config(&FileStore{Dir: t.TempDir()})
+	config.RedirectURL = "http://127.0.0.1:0/oauth/done"
+	var redirect string
+	_, err := config.LoopbackAuthorize(testContext(t), func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		redirect = u.Query().Get("redirect_uri")
+		return browser()(authURL)
+	})
+	if err != nil {
+		t.Fatalf("LoopbackAuthorize returned error: %v", err)
+	}
+	if !strings.HasSuffix(redirect, "/oauth/done") {
+		t.Errorf("redirect_uri = %v, want the configured path", redirect)
+	}
+}
+
+func TestConfig_LoopbackAuthorize_denied(t *testing.T) {
+	server := newAuthorizationServer(t)
+	defer server.Close()
+	server.deny = true
+
+	_, err := server.config(&FileStore{Dir: t.TempDir()}).LoopbackAuthorize(testContext(t), browser())
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("LoopbackAuthorize returned %v, want an access_denied error", err)
+	}
+}
+
+func TestConfig_LoopbackAuthorize_badState(t *testing.T) {
+	server := newAuthorizationServer(t)
+	defer server.Close()
+	server.badState = true
+
+	_, err := server.config(&FileStore{Dir: t.TempDir()}).LoopbackAuthorize(testContext(t), browser())
+	if err == nil || !strings.Contains(err.Error(), "state") {
+		t.Errorf("LoopbackAuthorize returned %v, want an invalid state error", err)
+	}
+}
+
+func TestConfig_LoopbackAuthorize_cancelled(t *testing.T) {
+	server := newAuthorizationServer(t)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := server.config(&FileStore{Dir: t.TempDir()}).LoopbackAuthorize(ctx, func(string) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("LoopbackAuthorize returned %v, want context.DeadlineExceeded", err)
+	}
+}
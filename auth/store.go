@@ -0,0 +1,329 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultProfile is used when neither Config.Profile nor ProfileEnv is
+	// set.
+	DefaultProfile = "default"
+
+	// ProfileEnv names the environment variable selecting the profile when
+	// Config.Profile is empty.
+	ProfileEnv = "FLOWDOCK_PROFILE"
+
+	// TokenEnv names the environment variable holding an access token that
+	// overrides any stored token, for CI jobs and containers.
+	TokenEnv = "FLOWDOCK_TOKEN"
+
+	// PassphraseEnv names the environment variable that, when set, makes
+	// DefaultStore encrypt tokens with its value.
+	PassphraseEnv = "FLOWDOCK_PASSPHRASE"
+
+	// DefaultIterations is the PBKDF2 iteration count used by
+	// EncryptedFileStore.
+	DefaultIterations = 600000
+)
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// A TokenStore saves tokens under profile names, so one user can hold
+// credentials for several organizations or bots ("work", "ops-bot", ...).
+type TokenStore interface {
+	// Load returns the profile's token, or ErrNoToken.
+	Load(profile string) (*oauth2.Token, error)
+
+	// Save stores tok as the profile's token.
+	Save(profile string, tok *oauth2.Token) error
+
+	// Delete removes the profile's token. Deleting a missing token is not
+	// an error.
+	Delete(profile string) error
+
+	// Profiles lists the profiles holding a token, sorted by name.
+	Profiles() ([]string, error)
+}
+
+// ConfigDir returns the directory holding Flowdock configuration:
+// $XDG_CONFIG_HOME/flowdock, or ~/.config/flowdock when XDG_CONFIG_HOME is
+// not set.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "flowdock"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "flowdock"), nil
+}
+
+// DefaultStore returns the store used when Config.Store is nil: an
+// EncryptedFileStore if the PassphraseEnv environment variable is set,
+// otherwise a FileStore, both under ConfigDir.
+func DefaultStore() (TokenStore, error) {
+	if v := os.Getenv(PassphraseEnv); v != "" {
+		return NewEncryptedFileStore([]byte(v))
+	}
+	return NewFileStore()
+}
+
+// FileStore keeps each profile's token in a JSON file, readable only by the
+// current user.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a FileStore keeping tokens in the "tokens"
+// subdirectory of ConfigDir.
+func NewFileStore() (*FileStore, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: filepath.Join(dir, "tokens")}, nil
+}
+
+// Load implements the TokenStore interface.
+func (s *FileStore) Load(profile string) (*oauth2.Token, error) {
+	path, err := profilePath(s.Dir, profile, ".json")
+	if err != nil {
+		return nil, err
+	}
+	return ReadTokenFile(path)
+}
+
+// Save implements the TokenStore interface.
+func (s *FileStore) Save(profile string, tok *oauth2.Token) error {
+	path, err := profilePath(s.Dir, profile, ".json")
+	if err != nil {
+		return err
+	}
+	return WriteTokenFile(path, tok)
+}
+
+// Delete implements the TokenStore interface.
+func (s *FileStore) Delete(profile string) error {
+	return deleteProfile(s.Dir, profile, ".json")
+}
+
+// Profiles implements the TokenStore interface.
+func (s *FileStore) Profiles() ([]string, error) {
+	return listProfiles(s.Dir, ".json")
+}
+
+// EncryptedFileStore keeps each profile's token in a file encrypted with
+// AES-256-GCM under a key derived from a passphrase with PBKDF2-SHA256.
+type EncryptedFileStore struct {
+	Dir        string
+	Passphrase []byte
+
+	// Iterations is the PBKDF2 iteration count used when saving. It
+	// defaults to DefaultIterations. Loading uses the count stored in the
+	// file.
+	Iterations int
+}
+
+// NewEncryptedFileStore returns an EncryptedFileStore keeping tokens in the
+// "tokens" subdirectory of ConfigDir.
+func NewEncryptedFileStore(passphrase []byte) (*EncryptedFileStore, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFileStore{Dir: filepath.Join(dir, "tokens"), Passphrase: passphrase}, nil
+}
+
+// encryptedFile is the on-disk format of EncryptedFileStore.
+type encryptedFile struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ErrBadPassphrase is returned when an encrypted token cannot be decrypted.
+var ErrBadPassphrase = errors.New("auth: wrong passphrase or corrupt token file")
+
+// Load implements the TokenStore interface.
+func (s *EncryptedFileStore) Load(profile string) (*oauth2.Token, error) {
+	path, err := profilePath(s.Dir, profile, ".enc")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f encryptedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("auth: reading %v: %w", path, err)
+	}
+	if f.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("auth: reading %v: unsupported key derivation %q", path, f.KDF)
+	}
+	aead, err := s.cipher(f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, []byte(profile))
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+
+	tok := new(oauth2.Token)
+	if err := json.Unmarshal(plain, tok); err != nil {
+		return nil, fmt.Errorf("auth: reading %v: %w", path, err)
+	}
+	return tok, nil
+}
+
+// Save implements the TokenStore interface.
+func (s *EncryptedFileStore) Save(profile string, tok *oauth2.Token) error {
+	path, err := profilePath(s.Dir, profile, ".enc")
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+
+	f := encryptedFile{
+		KDF:        "pbkdf2-sha256",
+		Iterations: s.Iterations,
+		Salt:       make([]byte, 16),
+	}
+	if f.Iterations == 0 {
+		f.Iterations = DefaultIterations
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := s.cipher(f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	// the profile name is authenticated so files cannot be swapped
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, []byte(profile))
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, data)
+}
+
+// Delete implements the TokenStore interface.
+func (s *EncryptedFileStore) Delete(profile string) error {
+	return deleteProfile(s.Dir, profile, ".enc")
+}
+
+// Profiles implements the TokenStore interface.
+func (s *EncryptedFileStore) Profiles() ([]string, error) {
+	return listProfiles(s.Dir, ".enc")
+}
+
+func (s *EncryptedFileStore) cipher(salt []byte, iterations int) (cipher.AEAD, error) {
+	if len(s.Passphrase) == 0 {
+		return nil, errors.New("auth: no passphrase for encrypted token store")
+	}
+	key, err := pbkdf2.Key(sha256.New, string(s.Passphrase), salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func profilePath(dir, profile, ext string) (string, error) {
+	if !profileName.MatchString(profile) {
+		return "", fmt.Errorf("auth: invalid profile name %q", profile)
+	}
+	return filepath.Join(dir, profile+ext), nil
+}
+
+func deleteProfile(dir, profile, ext string) error {
+	path, err := profilePath(dir, profile, ext)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func listProfiles(dir, ext string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasSuffix(name, ext) && profileName.MatchString(strings.TrimSuffix(name, ext)) {
+			profiles = append(profiles, strings.TrimSuffix(name, ext))
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// writePrivateFile replaces path with data through a temporary file, so a
+// crash never leaves a truncated token behind. The file is created with
+// 0600 permissions and its directory with 0700.
+func writePrivateFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func testToken() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  "access",
+		TokenType:    "bearer",
+		RefreshToken: "refresh",
+		Expiry:       time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// testStore exercises the TokenStore contract shared by every backend.
+func testStore(t *testing.T, store TokenStore) {
+	if _, err := store.Load("work"); err != ErrNoToken {
+		t.Errorf("Load of a missing profile returned %v, want ErrNoToken", err)
+	}
+
+	for _, profile := range []string{"work", "ops-bot"} {
+		if err := store.Save(profile, testToken()); err != nil {
+			t.Fatalf("Save(%v) returned error: %v", profile, err)
+		}
+	}
+
+	tok, err := store.Load("work")
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" || !tok.Expiry.Equal(testToken().Expiry) {
+		t.Errorf("Load returned %+v, want %+v", tok, testToken())
+	}
+
+	profiles, err := store.Profiles()
+	if err != nil {
+		t.Fatalf("Profiles returned error: %v", err)
+	}
+	if want := []string{"ops-bot", "work"}; !reflect.DeepEqual(profiles, want) {
+		t.Errorf("Profiles returned %v, want %v", profiles, want)
+	}
+
+	if err := store.Delete("work"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if err := store.Delete("work"); err != nil {
+		t.Errorf("second Delete returned error: %v", err)
+	}
+	if _, err := store.Load("work"); err != ErrNoToken {
+		t.Errorf("Load after Delete returned %v, want ErrNoToken", err)
+	}
+
+	if err := store.Save("../escape", testToken()); err == nil {
+		t.Errorf("Save with a path in the profile name expected an error")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tokens")
+	testStore(t, &FileStore{Dir: dir})
+
+	info, err := os.Stat(filepath.Join(dir, "ops-bot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file permissions = %v, want 0600", perm)
+	}
+	info, err = os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("token directory permissions = %v, want 0700", perm)
+	}
+}
+
+func TestNewFileStore(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	store, err := NewFileStore()
+	if err != nil {
+		t.Fatalf("NewFileStore returned error: %v", err)
+	}
+	if want := filepath.Join(dir, "flowdock", "tokens"); store.Dir != want {
+		t.Errorf("NewFileStore Dir = %v, want %v", store.Dir, want)
+	}
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	dir := t.TempDir()
+	testStore(t, &EncryptedFileStore{Dir: dir, Passphrase: []byte("s3cret"), Iterations: 1000})
+
+	data, err := os.ReadFile(filepath.Join(dir, "ops-bot.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "refresh") {
+		t.Errorf("encrypted file holds the plain token:\n%s", data)
+	}
+
+	wrong := &EncryptedFileStore{Dir: dir, Passphrase: []byte("guess")}
+	if _, err := wrong.Load("ops-bot"); err != ErrBadPassphrase {
+		t.Errorf("Load with the wrong passphrase returned %v, want ErrBadPassphrase", err)
+	}
+}
+
+func TestConfig_Token_env(t *testing.T) {
+	store := &FileStore{Dir: t.TempDir()}
+	store.Save("work", testToken())
+	config := &Config{Store: store}
+
+	t.Setenv(ProfileEnv, "work")
+	tok, err := config.Token()
+	if err != nil || tok.AccessToken != "access" {
+		t.Errorf("Token with %v set returned %v, %v; want the work token", ProfileEnv, tok, err)
+	}
+
+	t.Setenv(TokenEnv, "from-env")
+	tok, err = config.Token()
+	if err != nil || tok.AccessToken != "from-env" {
+		t.Errorf("Token with %v set returned %v, %v; want from-env", TokenEnv, tok, err)
+	}
+}
+
+func TestDefaultStore(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	t.Setenv(PassphraseEnv, "")
+	if store, err := DefaultStore(); err != nil {
+		t.Errorf("DefaultStore returned error: %v", err)
+	} else if _, ok := store.(*FileStore); !ok {
+		t.Errorf("DefaultStore returned %T, want *FileStore", store)
+	}
+
+	t.Setenv(PassphraseEnv, "s3cret")
+	if store, err := DefaultStore(); err != nil {
+		t.Errorf("DefaultStore returned error: %v", err)
+	} else if _, ok := store.(*EncryptedFileStore); !ok {
+		t.Errorf("DefaultStore returned %T, want *EncryptedFileStore", store)
+	}
+}
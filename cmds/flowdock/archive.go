@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/archive"
+	"github.com/wm/go-flowdock/archive/index"
+)
+
+var archiveCommand = cli.Command{
+	Name:  "archive",
+	Usage: "back up flows' messages, users and files to a directory",
+	Description: `Exports the given flows, or every flow you have joined, to the directory.
+   Running it again on the same directory only fetches the new messages.
+
+      flowdock archive backup/ acme/main acme/ops
+      flowdock archive --no-files backup/`,
+	ArgsUsage: "directory [org/flow...]",
+	Action:    action(archiveFlows),
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "no-files", Usage: "leave out the files posted to the flows"},
+		cli.BoolFlag{Name: "quiet, q", Usage: "do not report progress on stderr"},
+	},
+}
+
+// archiveResult reports what one run added to the archive of a flow.
+type archiveResult struct {
+	Flow          string `json:"flow"`
+	New           int    `json:"new"`
+	Messages      int    `json:"messages"`
+	Files         int    `json:"files"`
+	LastMessageID int    `json:"last_message_id"`
+}
+
+func archiveFlows(e *env, c *cli.Context) error {
+	if c.NArg() < 1 {
+		return usageError(c, "want a directory")
+	}
+	dir := c.Args().First()
+	opt := &archive.Options{SkipFiles: c.Bool("no-files")}
+	for _, arg := range c.Args().Tail() {
+		org, flow, err := e.Flow(arg)
+		if err != nil {
+			return usageError(c, "%v", err)
+		}
+		opt.Flows = append(opt.Flows, org+"/"+flow)
+	}
+	if !c.Bool("quiet") {
+		opt.Progress = func(flow string, n int) {
+			fmt.Fprintf(os.Stderr, "\r%v: %d new messages", flow, n)
+		}
+	}
+
+	before := make(map[string]int)
+	if m, err := archive.ReadManifest(dir); err == nil {
+		for name, state := range m.Flows {
+			before[name] = state.Messages
+		}
+	}
+
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	m, err := archive.Export(client, dir, opt)
+	if opt.Progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+
+	var results []archiveResult
+	for name, state := range m.Flows {
+		results = append(results, archiveResult{
+			Flow:          name,
+			New:           state.Messages - before[name],
+			Messages:      state.Messages,
+			Files:         state.Files,
+			LastMessageID: state.LastMessageID,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Flow < results[j].Flow })
+
+	rows := make([][]string, len(results))
+	for i, r := range results {
+		rows[i] = []string{r.Flow, strconv.Itoa(r.New), strconv.Itoa(r.Messages), strconv.Itoa(r.Files)}
+	}
+	return e.out.Print(results, []string{"FLOW", "NEW", "MESSAGES", "FILES"}, rows)
+}
+
+// searchArchive runs the search command against an archive. The --event,
+// --tags, --after and --before flags are added to the query.
+func searchArchive(e *env, c *cli.Context, dir string) error {
+	if c.NArg() < 1 {
+		return usageError(c, "want a query")
+	}
+	query := strings.Join(c.Args(), " ")
+	if events := splitList(c.String("event")); len(events) > 0 {
+		for i, event := range events {
+			events[i] = "event:" + event
+		}
+		query = "(" + query + ") (" + strings.Join(events, " OR ") + ")"
+	}
+	for _, flag := range []string{"after", "before"} {
+		if day := c.String(flag); day != "" {
+			query = "(" + query + ") " + flag + ":" + day
+		}
+	}
+	if tags := splitList(c.String("tags")); len(tags) > 0 {
+		for i, tag := range tags {
+			tags[i] = "tag:" + tag
+		}
+		if c.String("tag-mode") == "or" {
+			query = "(" + query + ") (" + strings.Join(tags, " OR ") + ")"
+		} else {
+			query = "(" + query + ") " + strings.Join(tags, " ")
+		}
+	}
+
+	ix, err := index.Open(dir)
+	if err != nil {
+		return err
+	}
+	res, err := ix.Search(query, &index.SearchOptions{Limit: c.Int("limit"), Newest: c.Bool("newest"), SnippetLength: 80})
+	if err != nil {
+		return usageError(c, "%v", err)
+	}
+
+	bold := isTerminal(c.App.Writer)
+	rows := make([][]string, len(res.Hits))
+	for i, hit := range res.Hits {
+		snippet := hit.Snippet
+		if bold {
+			for j := len(hit.Highlights) - 1; j >= 0; j-- {
+				h := hit.Highlights[j]
+				snippet = snippet[:h[0]] + "\x1b[1m" + snippet[h[0]:h[1]] + "\x1b[0m" + snippet[h[1]:]
+			}
+		}
+		rows[i] = []string{strconv.Itoa(hit.ID), hit.Sent.Local().Format(time.DateTime), hit.Flow, hit.User, snippet}
+	}
+	return e.out.Print(res, []string{"ID", "SENT", "FLOW", "USER", "CONTENT"}, rows)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/auth"
+	"github.com/wm/go-flowdock/flowdock"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the shared configuration file, holding one entry per
+// profile. Tokens are kept separately by the auth package under the same
+// profile names.
+type configFile struct {
+	// Profile is used when neither --profile nor $FLOWDOCK_PROFILE is set.
+	Profile  string              `yaml:"profile,omitempty"`
+	Profiles map[string]*profile `yaml:"profiles,omitempty"`
+}
+
+type profile struct {
+	ClientID     string `yaml:"client_id,omitempty"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	Org          string `yaml:"org,omitempty"`
+	Flow         string `yaml:"flow,omitempty"`
+	Output       string `yaml:"output,omitempty"`
+	APIURL       string `yaml:"api_url,omitempty"`
+	StreamURL    string `yaml:"stream_url,omitempty"`
+}
+
+func defaultConfigPath() string {
+	dir, err := auth.ConfigDir()
+	if err != nil {
+		return "config.yaml"
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	config := new(configFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("reading %v: %v", path, err)
+	}
+	return config, nil
+}
+
+// env is what a command runs with: the selected profile, merged with the
+// global flags, and the output printer. The API client is created on first
+// use so commands failing on their arguments never trigger authorization.
+type env struct {
+	profile profile
+	auth    *auth.Config
+	code    string
+	debug   bool
+	out     *printer
+
+	client *flowdock.Client
+}
+
+func newEnv(c *cli.Context) (*env, error) {
+	path := c.GlobalString("config")
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	file, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := c.GlobalString("profile")
+	if name == "" && os.Getenv(auth.ProfileEnv) == "" {
+		name = file.Profile
+	}
+	config := &auth.Config{Profile: name}
+	e := &env{auth: config, code: c.GlobalString("code"), debug: c.GlobalBool("debug")}
+	if p := file.Profiles[config.ProfileName()]; p != nil {
+		e.profile = *p
+	}
+
+	override(&e.profile.ClientID, c.GlobalString("id"))
+	override(&e.profile.ClientSecret, c.GlobalString("secret"))
+	override(&e.profile.Org, c.GlobalString("org"))
+	override(&e.profile.Output, c.GlobalString("output"))
+	override(&e.profile.APIURL, c.GlobalString("api-url"))
+	override(&e.profile.StreamURL, c.GlobalString("stream-url"))
+	config.ClientID = e.profile.ClientID
+	config.ClientSecret = e.profile.ClientSecret
+
+	e.out, err = newPrinter(c.App.Writer, e.profile.Output)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+// Client returns the API client, authorizing the application in the browser
+// if the profile has no token yet.
+func (e *env) Client() (*flowdock.Client, error) {
+	if e.client != nil {
+		return e.client, nil
+	}
+
+	ctx := context.Background()
+	httpClient, err := e.auth.Authenticate(ctx, e.code)
+	if _, ok := err.(*auth.AuthorizationRequiredError); ok {
+		if e.auth.ClientID == "" || e.auth.ClientSecret == "" {
+			return nil, fmt.Errorf("profile %v has no token; set client_id and client_secret in %v or pass --id and --secret to authorize", e.auth.ProfileName(), defaultConfigPath())
+		}
+		tok, err := e.auth.LoopbackAuthorize(ctx, openBrowser)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Token saved for profile %v\n", e.auth.ProfileName())
+		httpClient = e.auth.Client(ctx, tok)
+	} else if err != nil {
+		return nil, err
+	}
+
+	client, err := e.newClient(flowdock.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	e.client = client
+	return client, nil
+}
+
+// InboxClient returns a client without the profile's token, for the team
+// inbox API, which authenticates each request with a flow API token.
+func (e *env) InboxClient() (*flowdock.Client, error) {
+	return e.newClient()
+}
+
+// newClient returns a client for the profile's API URLs with opts.
+func (e *env) newClient(opts ...flowdock.Option) (*flowdock.Client, error) {
+	opts = append(opts, flowdock.WithUserAgent("flowdock-cli"))
+	if e.profile.APIURL != "" {
+		opts = append(opts, flowdock.WithRestURL(e.profile.APIURL))
+	}
+	if e.profile.StreamURL != "" {
+		opts = append(opts, flowdock.WithStreamURL(e.profile.StreamURL))
+	}
+	client, err := flowdock.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if e.debug {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		client.Use(flowdock.Tracing(), flowdock.Logging(logger))
+	}
+	return client, nil
+}
+
+// AccessToken returns the current access token, for the streaming API.
+func (e *env) AccessToken() (string, error) {
+	tok, err := e.auth.Token()
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+// Flow splits a flow argument into organization and flow names. The
+// organization may be left out ("main" rather than "acme/main") when the
+// profile or --org names one.
+func (e *env) Flow(arg string) (org, flow string, err error) {
+	if arg == "" {
+		arg = e.profile.Flow
+	}
+	if arg == "" {
+		return "", "", errors.New("no flow given")
+	}
+	if i := strings.IndexByte(arg, '/'); i >= 0 {
+		return arg[:i], arg[i+1:], nil
+	}
+	if e.profile.Org == "" {
+		return "", "", fmt.Errorf("flow %q has no organization; use org/flow or --org", arg)
+	}
+	return e.profile.Org, arg, nil
+}
+
+func openBrowser(url string) error {
+	fmt.Fprintln(os.Stderr, "Visit this URL to authorize the application:")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, url)
+	auth.OpenBrowser(url)
+	return nil
+}
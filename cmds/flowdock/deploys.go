@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var deploysCommand = cli.Command{
+	Name:  "deploys",
+	Usage: "report how often applications are deployed, from deploy announcements in a flow",
+	Description: `Deploys are counted from the messages a deploy tool posts to the flow,
+   usually to its team inbox. A message counts as a deploy of an application
+   when it has the --event type, every --tags tag, the --env tag and the
+   application's tag, none of the --exclude-tag tags, and content matching
+   --match. The flow's whole history in the date range is read.
+
+   With --from-env, the lead time of each deploy is the time since the first
+   deploy to that environment, e.g. staging, that had not yet been deployed.
+
+      flowdock deploys acme/ops web api --since 2024-01-01 --by week
+      flowdock deploys acme/ops web --from-env staging --summary
+      flowdock --output csv deploys acme/ops web > deploys.csv`,
+	ArgsUsage: "org/flow app...",
+	Action:    action(deploys),
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "env, e", Value: "production", Usage: "tag of the environment deployed to"},
+		cli.StringFlag{Name: "from-env", Usage: "tag of the environment deploys come from, to report lead times"},
+		cli.StringFlag{Name: "tags", Value: "deployment,deploy_end", Usage: "comma-separated tags every deploy message has"},
+		cli.StringFlag{Name: "exclude-tag", Usage: "comma-separated tags of messages that are not deploys"},
+		cli.StringFlag{Name: "event", Value: "mail", Usage: "event type of deploy messages, or empty for any"},
+		cli.StringFlag{Name: "match", Usage: "regular expression the message content must match"},
+		cli.StringFlag{Name: "since", Usage: "first day to report, as YYYY-MM-DD"},
+		cli.StringFlag{Name: "until", Usage: "last day to report, as YYYY-MM-DD (default today)"},
+		cli.StringFlag{Name: "by", Value: "month", Usage: "period to count deploys by: week or month"},
+		cli.BoolFlag{Name: "summary", Usage: "show one line per application instead of one per period"},
+	},
+}
+
+// deployRules decides which messages of a flow are deploys.
+type deployRules struct {
+	tags    []string
+	exclude []string
+	event   string
+	match   *regexp.Regexp
+	since   time.Time
+	until   time.Time
+}
+
+// deployReport is the report for one application.
+type deployReport struct {
+	App         string         `json:"app"`
+	Environment string         `json:"environment"`
+	Deploys     int            `json:"deploys"`
+	Period      string         `json:"period"`
+	Frequency   float64        `json:"frequency"`
+	LeadTime    *leadTime      `json:"lead_time,omitempty"`
+	Periods     []deployPeriod `json:"periods,omitempty"`
+}
+
+// deployPeriod counts the deploys in one week or month.
+type deployPeriod struct {
+	Period   string    `json:"period"`
+	Start    time.Time `json:"start"`
+	Deploys  int       `json:"deploys"`
+	LeadTime *leadTime `json:"lead_time,omitempty"`
+}
+
+// leadTime summarizes the lead times of a number of deploys.
+type leadTime struct {
+	Deploys int      `json:"deploys"`
+	Median  duration `json:"median"`
+	P90     duration `json:"p90"`
+}
+
+// duration is a time.Duration written as a string like "26h5m0s".
+type duration time.Duration
+
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).Round(time.Second).String()), nil
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = duration(v)
+	return err
+}
+
+func deploys(e *env, c *cli.Context) error {
+	if c.NArg() < 2 {
+		return usageError(c, "want a flow and at least one application")
+	}
+	org, flow, err := e.Flow(c.Args().First())
+	if err != nil {
+		return usageError(c, "%v", err)
+	}
+	by := c.String("by")
+	if by != "week" && by != "month" {
+		return usageError(c, "--by must be week or month, not %q", by)
+	}
+
+	rules := &deployRules{
+		tags:    splitList(c.String("tags")),
+		exclude: splitList(c.String("exclude-tag")),
+		event:   c.String("event"),
+		until:   time.Now(),
+	}
+	if m := c.String("match"); m != "" {
+		if rules.match, err = regexp.Compile(m); err != nil {
+			return usageError(c, "--match: %v", err)
+		}
+	}
+	if s := c.String("since"); s != "" {
+		if rules.since, err = time.ParseInLocation(time.DateOnly, s, time.Local); err != nil {
+			return usageError(c, "--since: want a date like 2024-01-31")
+		}
+	}
+	if s := c.String("until"); s != "" {
+		until, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+		if err != nil {
+			return usageError(c, "--until: want a date like 2024-01-31")
+		}
+		rules.until = until.AddDate(0, 0, 1)
+	}
+	if !rules.since.Before(rules.until) {
+		return usageError(c, "--since must not be after --until")
+	}
+
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	apps := append([]string(nil), c.Args().Tail()...)
+	sort.Strings(apps)
+
+	var reports []deployReport
+	for _, app := range apps {
+		times, err := rules.fetch(client, org, flow, app, c.String("env"))
+		if err != nil {
+			return err
+		}
+		var leads []time.Duration
+		if from := c.String("from-env"); from != "" {
+			sources, err := rules.fetch(client, org, flow, app, from)
+			if err != nil {
+				return err
+			}
+			leads = leadTimes(sources, times)
+		}
+		report := newDeployReport(app, c.String("env"), by, rules, times, leads)
+		if c.Bool("summary") {
+			report.Periods = nil
+		}
+		reports = append(reports, report)
+	}
+
+	if c.Bool("summary") {
+		header := []string{"APP", "DEPLOYS", "PER " + strings.ToUpper(by), "LEAD TIME", "LEAD TIME P90"}
+		rows := make([][]string, len(reports))
+		for i, r := range reports {
+			rows[i] = append([]string{r.App, strconv.Itoa(r.Deploys), strconv.FormatFloat(r.Frequency, 'f', 1, 64)}, leadTimeColumns(r.LeadTime)...)
+		}
+		return e.out.Print(reports, header, rows)
+	}
+	header := []string{"APP", strings.ToUpper(by), "DEPLOYS", "LEAD TIME", "LEAD TIME P90"}
+	var rows [][]string
+	for _, r := range reports {
+		for _, p := range r.Periods {
+			rows = append(rows, append([]string{r.App, p.Period, strconv.Itoa(p.Deploys)}, leadTimeColumns(p.LeadTime)...))
+		}
+	}
+	return e.out.Print(reports, header, rows)
+}
+
+// fetch returns the times of an application's deploys to env within the date
+// range, oldest first. It pages back through the flow's history until it
+// reaches the start of the range.
+func (r *deployRules) fetch(client *flowdock.Client, org, flow, app, env string) ([]time.Time, error) {
+	opt := &flowdock.MessagesListOptions{
+		Event:   r.event,
+		Tags:    append(append([]string{}, r.tags...), env, app),
+		TagMode: "and",
+		Limit:   100,
+	}
+
+	var times []time.Time
+	for {
+		messages, _, err := client.Messages.List(org, flow, opt)
+		if err != nil {
+			return nil, err
+		}
+		oldest, before := 0, false
+		for _, m := range messages {
+			if m.ID != nil && (oldest == 0 || *m.ID < oldest) {
+				oldest = *m.ID
+			}
+			if m.Sent == nil {
+				continue
+			}
+			sent := m.Sent.Local()
+			if sent.Before(r.since) {
+				before = true
+				continue
+			}
+			if sent.Before(r.until) && r.matches(m) {
+				times = append(times, sent)
+			}
+		}
+		if len(messages) < opt.Limit || oldest == 0 || before {
+			break
+		}
+		opt.UntilId = oldest
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+// matches reports whether m passes the rules the API cannot apply.
+func (r *deployRules) matches(m flowdock.Message) bool {
+	if m.Tags != nil {
+		for _, tag := range *m.Tags {
+			for _, ex := range r.exclude {
+				if tag == ex {
+					return false
+				}
+			}
+		}
+	}
+	if r.match != nil {
+		if m.Event == nil || m.RawContent == nil || !r.match.MatchString(m.Content().String()) {
+			return false
+		}
+	}
+	return true
+}
+
+// leadTimes returns, for each deploy in targets, the time since the first
+// deploy in sources after the previous target deploy. Deploys with no such
+// source deploy get a negative lead time. Both lists are oldest first.
+func leadTimes(sources, targets []time.Time) []time.Duration {
+	leads := make([]time.Duration, len(targets))
+	var prev time.Time
+	j := 0
+	for i, t := range targets {
+		for j < len(sources) && !sources[j].After(prev) {
+			j++
+		}
+		leads[i] = -1
+		if j < len(sources) && !sources[j].After(t) {
+			leads[i] = t.Sub(sources[j])
+		}
+		prev = t
+	}
+	return leads
+}
+
+func newDeployReport(app, env, by string, rules *deployRules, times []time.Time, leads []time.Duration) deployReport {
+	report := deployReport{App: app, Environment: env, Deploys: len(times), Period: by}
+
+	first := rules.since
+	if first.IsZero() && len(times) > 0 {
+		first = times[0]
+	}
+	if first.IsZero() {
+		return report
+	}
+	last := rules.until.Add(-time.Nanosecond)
+	if len(times) > 0 && times[len(times)-1].After(last) {
+		last = times[len(times)-1]
+	}
+
+	var all []time.Duration
+	i := 0
+	for start := periodStart(first, by); !start.After(last); start = nextPeriod(start, by) {
+		next := nextPeriod(start, by)
+		p := deployPeriod{Period: periodName(start, by), Start: start}
+		var periodLeads []time.Duration
+		for ; i < len(times) && times[i].Before(next); i++ {
+			p.Deploys++
+			if leads != nil && leads[i] >= 0 {
+				periodLeads = append(periodLeads, leads[i])
+			}
+		}
+		p.LeadTime = newLeadTime(periodLeads)
+		all = append(all, periodLeads...)
+		report.Periods = append(report.Periods, p)
+	}
+	report.Frequency = float64(report.Deploys) / float64(len(report.Periods))
+	report.LeadTime = newLeadTime(all)
+	return report
+}
+
+func newLeadTime(leads []time.Duration) *leadTime {
+	if len(leads) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration(nil), leads...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &leadTime{
+		Deploys: len(sorted),
+		Median:  duration(percentile(sorted, 50)),
+		P90:     duration(percentile(sorted, 90)),
+	}
+}
+
+// percentile returns the nearest-rank pth percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func leadTimeColumns(l *leadTime) []string {
+	if l == nil {
+		return []string{"", ""}
+	}
+	return []string{formatDuration(time.Duration(l.Median)), formatDuration(time.Duration(l.P90))}
+}
+
+// formatDuration writes d in days and hours, or hours and minutes when it is
+// under a day.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+	}
+	return fmt.Sprintf("%dh%02dm", d/time.Hour, d%time.Hour/time.Minute)
+}
+
+// periodStart returns the start of the week (from Monday) or month of t.
+func periodStart(t time.Time, by string) time.Time {
+	y, m, d := t.Date()
+	if by == "month" {
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	}
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+}
+
+func nextPeriod(start time.Time, by string) time.Time {
+	if by == "month" {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+// periodName names a month like 2024-01 and a week by its ISO week, like
+// 2024-W01.
+func periodName(start time.Time, by string) string {
+	if by == "month" {
+		return start.Format("2006-01")
+	}
+	y, w := start.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", y, w)
+}
@@ -0,0 +1,672 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wm/go-flowdock/auth"
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/flowdocktest"
+)
+
+// setup returns a fake server with an "acme/main" flow, and points the
+// configuration and tokens at a temporary directory.
+func setup(t *testing.T) *flowdocktest.Server {
+	srv := flowdocktest.NewServer()
+	t.Cleanup(srv.Close)
+
+	srv.AddOrganization("acme", "Acme")
+	bot := srv.AddUser("bot", "Bot", "bot@example.com")
+	if _, err := srv.AddFlow("acme", "main", *bot.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(auth.TokenEnv, "token")
+	t.Setenv(auth.ProfileEnv, "")
+	return srv
+}
+
+// run runs the command line against srv and returns its output.
+func run(t *testing.T, srv *flowdocktest.Server, args ...string) (string, error) {
+	var out bytes.Buffer
+	argv := append([]string{"flowdock", "--api-url", srv.REST.URL, "--stream-url", srv.Stream.URL}, args...)
+	err := newApp(&out).Run(argv)
+	return out.String(), err
+}
+
+func mustRun(t *testing.T, srv *flowdocktest.Server, args ...string) string {
+	out, err := run(t, srv, args...)
+	if err != nil {
+		t.Fatalf("%v returned error: %v", args, err)
+	}
+	return out
+}
+
+func writeConfig(t *testing.T, config string) {
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "flowdock")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlowsList(t *testing.T) {
+	srv := setup(t)
+
+	out := mustRun(t, srv, "flows", "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "acme/main") {
+		t.Errorf("flows list printed:\n%v", out)
+	}
+}
+
+func TestFlowsGet_json(t *testing.T) {
+	srv := setup(t)
+
+	out := mustRun(t, srv, "--output", "json", "flows", "get", "acme/main")
+	var flow flowdock.Flow
+	if err := json.Unmarshal([]byte(out), &flow); err != nil {
+		t.Fatalf("flows get printed invalid JSON: %v\n%v", err, out)
+	}
+	if str(flow.ParameterizedName) != "main" {
+		t.Errorf("flows get returned %+v", flow)
+	}
+
+	// the same flow by ID
+	out = mustRun(t, srv, "--output", "json", "flows", "get", str(flow.Id))
+	if !strings.Contains(out, `"parameterized_name": "main"`) {
+		t.Errorf("flows get by ID printed:\n%v", out)
+	}
+}
+
+func TestFlowsUpdate(t *testing.T) {
+	srv := setup(t)
+
+	mustRun(t, srv, "flows", "update", "acme/main", "--name", "Main room", "--open", "false")
+	out := mustRun(t, srv, "-o", "json", "flows", "get", "acme/main")
+	if !strings.Contains(out, `"name": "Main room"`) {
+		t.Errorf("flow not renamed:\n%v", out)
+	}
+
+	if _, err := run(t, srv, "flows", "update", "acme/main", "--open", "maybe"); err == nil {
+		t.Errorf("flows update --open maybe expected an error")
+	}
+	if _, err := run(t, srv, "flows", "update", "acme/main"); err == nil {
+		t.Errorf("flows update without changes expected an error")
+	}
+}
+
+func TestMessagesPostAndComment(t *testing.T) {
+	srv := setup(t)
+
+	mustRun(t, srv, "messages", "post", "--tags", "deploy,prod", "acme/main", "Deploy", "finished")
+	messages := srv.Messages("acme", "main")
+	if len(messages) != 1 || summary(messages[0], 100) != "Deploy finished" {
+		t.Fatalf("posted messages = %+v", messages)
+	}
+
+	mustRun(t, srv, "messages", "comment", "acme/main", num(messages[0].ID), "Nice")
+	messages = srv.Messages("acme", "main")
+	if len(messages) != 2 || str(messages[1].Event) != "comment" || *messages[1].MessageID != *messages[0].ID {
+		t.Errorf("comment = %+v", messages[len(messages)-1])
+	}
+
+	out := mustRun(t, srv, "messages", "list", "acme/main", "--event", "message")
+	if !strings.Contains(out, "Deploy finished") || strings.Contains(out, "Nice") {
+		t.Errorf("messages list printed:\n%v", out)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv := setup(t)
+	for _, text := range []string{"production deploy", "lunch?"} {
+		mustRun(t, srv, "messages", "post", "acme/main", text)
+	}
+
+	out := mustRun(t, srv, "search", "acme/main", "deploy")
+	if !strings.Contains(out, "production deploy") || strings.Contains(out, "lunch") {
+		t.Errorf("search printed:\n%v", out)
+	}
+	if _, err := run(t, srv, "search", "acme/main"); err == nil {
+		t.Errorf("search without words expected an error")
+	}
+}
+
+func TestUsers_yaml(t *testing.T) {
+	srv := setup(t)
+
+	out := mustRun(t, srv, "--output", "yaml", "users", "acme/main")
+	if !strings.Contains(out, "- id: 1\n  nick: bot\n") {
+		t.Errorf("users printed:\n%v", out)
+	}
+}
+
+func TestOrgs(t *testing.T) {
+	srv := setup(t)
+
+	out := mustRun(t, srv, "orgs")
+	if !strings.Contains(out, "acme") {
+		t.Errorf("orgs printed:\n%v", out)
+	}
+}
+
+func TestInbox(t *testing.T) {
+	srv := setup(t)
+	t.Setenv(auth.TokenEnv, "") // the flow token is enough
+
+	mustRun(t, srv, "inbox", srv.FlowToken("acme", "main"), "--subject", "Build passed", "--from-address", "ci@example.com", "--content", "All green")
+	messages := srv.Messages("acme", "main")
+	if len(messages) != 1 || str(messages[0].Event) != "mail" {
+		t.Errorf("inbox messages = %+v", messages)
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	srv := setup(t)
+	writeConfig(t, `
+profile: work
+profiles:
+  work:
+    org: acme
+    flow: main
+    output: json
+  other:
+    org: elsewhere
+`)
+
+	out := mustRun(t, srv, "flows", "get", "acme/main")
+	if !strings.HasPrefix(out, "{") {
+		t.Errorf("output from the work profile is not JSON:\n%v", out)
+	}
+
+	// the flow and its organization come from the profile
+	mustRun(t, srv, "messages", "post", "", "hello")
+	mustRun(t, srv, "messages", "post", "main", "again")
+	if n := len(srv.Messages("acme", "main")); n != 2 {
+		t.Errorf("posted %d messages, want 2", n)
+	}
+
+	if _, err := run(t, srv, "--profile", "other", "messages", "list", "main"); err == nil {
+		t.Errorf("messages list in an unknown organization expected an error")
+	}
+}
+
+func TestOutputFormat_invalid(t *testing.T) {
+	srv := setup(t)
+
+	if _, err := run(t, srv, "--output", "xml", "flows", "list"); err == nil {
+		t.Errorf("--output xml expected an error")
+	}
+}
+
+// tailAsync runs the command line in the background until srv has a stream
+// open, and returns a function waiting for its output.
+func tailAsync(t *testing.T, srv *flowdocktest.Server, args ...string) func() string {
+	var out string
+	var err error
+	done := make(chan struct{})
+	go func() {
+		out, err = run(t, srv, args...)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Streams() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("tail did not open a stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() string {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tail did not exit")
+		}
+		if err != nil {
+			t.Fatalf("tail returned error: %v", err)
+		}
+		return out
+	}
+}
+
+func addMessage(t *testing.T, srv *flowdocktest.Server, flow string, m flowdock.Message) *flowdock.Message {
+	org, name, _ := strings.Cut(flow, "/")
+	posted, err := srv.AddMessage(org, name, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return posted
+}
+
+func text(s string) flowdock.Message {
+	event := "message"
+	raw := json.RawMessage(strconv.Quote(s))
+	return flowdock.Message{Event: &event, RawContent: &raw}
+}
+
+func TestTail(t *testing.T) {
+	srv := setup(t)
+	srv.AddFlow("acme", "ops")
+	alice := srv.AddUser("alice", "Alice", "alice@example.com")
+
+	wait := tailAsync(t, srv, "tail", "--color", "never", "--max", "3", "--user", "bot,alice", "acme/main", "acme/ops")
+	parent := addMessage(t, srv, "acme/main", text("Deploying api"))
+	addMessage(t, srv, "acme/ops", text("pager is quiet"))
+	mustRun(t, srv, "messages", "comment", "acme/main", num(parent.ID), "done")
+	srv.SetCurrentUser(*alice.Id)
+	addMessage(t, srv, "acme/main", text("from alice"))
+	out := wait()
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	want := []string{
+		"acme/main  bot: Deploying api",
+		"acme/ops  bot: pager is quiet",
+		`acme/main  bot: ↳ bot "Deploying api": done`,
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("tail printed:\n%v", out)
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("tail line %d = %q, want suffix %q", i, line, want[i])
+		}
+	}
+}
+
+func TestTail_filters(t *testing.T) {
+	srv := setup(t)
+	alice := srv.AddUser("alice", "Alice", "alice@example.com")
+
+	wait := tailAsync(t, srv, "tail", "--color", "never", "--max", "1", "--user", "alice", "--tag", "deploy", "acme/main")
+	tagged := text("bot deploy")
+	tagged.Tags = &[]string{"deploy"}
+	addMessage(t, srv, "acme/main", tagged)
+	srv.SetCurrentUser(*alice.Id)
+	addMessage(t, srv, "acme/main", text("alice chat"))
+	tagged = text("alice deploy")
+	tagged.Tags = &[]string{"deploy"}
+	addMessage(t, srv, "acme/main", tagged)
+
+	if out := wait(); !strings.HasSuffix(out, "alice: alice deploy\n") || strings.Count(out, "\n") != 1 {
+		t.Errorf("tail printed:\n%v", out)
+	}
+}
+
+func TestTail_resume(t *testing.T) {
+	srv := setup(t)
+
+	wait := tailAsync(t, srv, "tail", "--color", "never", "--max", "1", "acme/main")
+	addMessage(t, srv, "acme/main", text("seen"))
+	wait()
+
+	// missed while not tailing
+	addMessage(t, srv, "acme/main", text("missed 1"))
+	addMessage(t, srv, "acme/main", text("missed 2"))
+
+	out := mustRun(t, srv, "tail", "--resume", "--max", "2", "--color", "never", "acme/main")
+	if strings.Contains(out, "seen") || !strings.Contains(out, "missed 1") || !strings.Contains(out, "missed 2") {
+		t.Errorf("tail --resume printed:\n%v", out)
+	}
+}
+
+func TestTail_resumeManyMissed(t *testing.T) {
+	srv := setup(t)
+
+	wait := tailAsync(t, srv, "tail", "--color", "never", "--max", "1", "acme/main")
+	addMessage(t, srv, "acme/main", text("seen"))
+	wait()
+
+	// more than a page of messages
+	for i := 1; i <= 150; i++ {
+		addMessage(t, srv, "acme/main", text(fmt.Sprintf("missed %d.", i)))
+	}
+
+	out := mustRun(t, srv, "tail", "--resume", "--max", "150", "--color", "never", "acme/main")
+	for _, want := range []string{"missed 1.", "missed 50.", "missed 51.", "missed 150."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("tail --resume did not print %q", want)
+		}
+	}
+	if strings.Contains(out, "seen") || strings.Index(out, "missed 1.") > strings.Index(out, "missed 150.") {
+		t.Errorf("tail --resume printed:\n%v", out)
+	}
+}
+
+func TestTail_json(t *testing.T) {
+	srv := setup(t)
+
+	wait := tailAsync(t, srv, "--output", "json", "tail", "--max", "1", "--all")
+	addMessage(t, srv, "acme/main", text("hello"))
+
+	var m flowdock.Message
+	if err := json.Unmarshal([]byte(wait()), &m); err != nil {
+		t.Fatalf("tail printed invalid JSON: %v", err)
+	}
+	if summary(m, 100) != "hello" {
+		t.Errorf("tail printed %+v", m)
+	}
+}
+
+func TestTailer_parentInSameFlow(t *testing.T) {
+	srv := setup(t)
+	tr := &tailer{client: srv.Client(), recent: map[string]flowdock.Message{}}
+	main, ops := "main-id", "ops-id"
+	for flow, content := range map[*string]string{&main: "Deploying api", &ops: "pager is quiet"} {
+		m := text(content)
+		id := 7
+		m.ID, m.FlowID = &id, flow
+		tr.remember(m)
+	}
+
+	parent := 7
+	comment := flowdock.Message{FlowID: &ops, MessageID: &parent}
+	if got := tr.parent(&tailFlow{org: "acme", name: "ops"}, comment); !strings.Contains(got, "pager is quiet") {
+		t.Errorf("parent of a comment in ops = %v, want the ops message", got)
+	}
+}
+
+func TestTail_csv(t *testing.T) {
+	srv := setup(t)
+
+	wait := tailAsync(t, srv, "--output", "csv", "tail", "--max", "1", "acme/main")
+	posted := addMessage(t, srv, "acme/main", text("hello, world"))
+
+	rows, err := csv.NewReader(strings.NewReader(wait())).ReadAll()
+	if err != nil {
+		t.Fatalf("tail printed invalid CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "ID" || rows[1][0] != num(posted.ID) || rows[1][2] != "acme/main" ||
+		rows[1][3] != "bot" || rows[1][5] != "hello, world" {
+		t.Errorf("tail printed %q", rows)
+	}
+
+	if _, err := run(t, srv, "--output", "yaml", "tail", "acme/main"); err == nil {
+		t.Error("tail --output yaml returned no error")
+	}
+}
+
+func TestSummary_commentWithoutText(t *testing.T) {
+	event := "comment"
+	raw := json.RawMessage(`{"title":"Deploying api"}`)
+	if got := summary(flowdock.Message{Event: &event, RawContent: &raw}, 40); got != "" {
+		t.Errorf("summary of a comment without text = %q", got)
+	}
+}
+
+func withStdin(t *testing.T, input string) {
+	old := stdin
+	stdin = strings.NewReader(input)
+	t.Cleanup(func() { stdin = old })
+}
+
+// contents returns the text of the flow's messages and comments.
+func contents(srv *flowdocktest.Server, org, flow string) []string {
+	var texts []string
+	for _, m := range srv.Messages(org, flow) {
+		texts = append(texts, m.Content().String())
+	}
+	return texts
+}
+
+func TestPost(t *testing.T) {
+	srv := setup(t)
+
+	mustRun(t, srv, "post", "--tags", "ci", "acme/main", "build", "passed")
+	withStdin(t, "func main() {}\n")
+	mustRun(t, srv, "post", "--code", "--lang", "go", "acme/main")
+	parent := srv.Messages("acme", "main")[0]
+	mustRun(t, srv, "post", "--reply", num(parent.ID), "acme/main", "thanks")
+
+	messages := srv.Messages("acme", "main")
+	if !reflect.DeepEqual(*messages[0].Tags, []string{"ci"}) {
+		t.Errorf("tags = %v, want [ci]", *messages[0].Tags)
+	}
+	want := []string{"build passed", "```go\nfunc main() {}\n```", "thanks"}
+	if got := contents(srv, "acme", "main"); !reflect.DeepEqual(got, want) {
+		t.Errorf("posted %q, want %q", got, want)
+	}
+	if *messages[2].MessageID != *parent.ID {
+		t.Errorf("reply went to message %v, want %v", *messages[2].MessageID, *parent.ID)
+	}
+}
+
+func TestPost_file(t *testing.T) {
+	srv := setup(t)
+	path := filepath.Join(t.TempDir(), "report.csv")
+	os.WriteFile(path, []byte("a,b\n"), 0600)
+
+	mustRun(t, srv, "post", "--file", path, "acme/main", "Weekly report")
+	messages := srv.Messages("acme", "main")
+	if len(messages) != 2 || str(messages[1].Event) != "file" || summary(messages[1], 100) != "report.csv" {
+		t.Errorf("posted %+v", messages)
+	}
+}
+
+func TestPost_tee(t *testing.T) {
+	srv := setup(t)
+	srv.RateLimit(1, 0)
+
+	// lines arrive slower than they are posted
+	r, w := io.Pipe()
+	stdin = r
+	t.Cleanup(func() { stdin = os.Stdin })
+	go func() {
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "step %d\n", i)
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Close()
+	}()
+
+	out := mustRun(t, srv, "post", "--tee", "--interval", "10ms", "acme/main")
+	if out != "step 1\nstep 2\nstep 3\n" {
+		t.Errorf("tee printed %q, want the input", out)
+	}
+
+	// every line arrives once despite the rate limit, as one thread
+	texts := contents(srv, "acme", "main")
+	if got := strings.Join(texts, "\n"); got != "step 1\nstep 2\nstep 3" {
+		t.Errorf("posted %q", texts)
+	}
+	messages := srv.Messages("acme", "main")
+	if len(messages) < 2 {
+		t.Errorf("posted %d messages, want a thread", len(messages))
+	}
+	for _, m := range messages[1:] {
+		if str(m.Event) != "comment" || *m.MessageID != *messages[0].ID {
+			t.Errorf("message %v is not a comment on %v", num(m.ID), num(messages[0].ID))
+		}
+	}
+}
+
+func TestPost_teeLongLine(t *testing.T) {
+	srv := setup(t)
+	line := strings.Repeat("é", 9000)
+	withStdin(t, line+"\n")
+
+	mustRun(t, srv, "post", "--tee", "acme/main")
+	texts := contents(srv, "acme", "main")
+	for _, text := range texts {
+		if len(text) > maxBatch || !utf8.ValidString(text) {
+			t.Errorf("posted %d bytes, valid UTF-8: %v", len(text), utf8.ValidString(text))
+		}
+	}
+	if got := strings.Join(texts, ""); got != line {
+		t.Errorf("posted %d parts holding %d of the line's %d bytes", len(texts), len(got), len(line))
+	}
+}
+
+func TestPost_teeCommand(t *testing.T) {
+	srv := setup(t)
+
+	out, err := run(t, srv, "post", "--tee", "acme/main", "--", "sh", "-c", "echo building; exit 3")
+	if err != exitStatus(3) {
+		t.Errorf("post --tee returned %v, want exit status 3", err)
+	}
+	if out != "building\n" {
+		t.Errorf("tee printed %q", out)
+	}
+	want := "$ sh -c \"echo building; exit 3\"\nbuilding\n[exit status 3]"
+	if got := strings.Join(contents(srv, "acme", "main"), "\n"); got != want {
+		t.Errorf("posted %q, want %q", got, want)
+	}
+}
+
+// deploy adds a deploy announcement to acme/main like a deploy tool would
+// send to the team inbox.
+func deploy(t *testing.T, srv *flowdocktest.Server, app, env string, sent time.Time, tags ...string) {
+	event := "mail"
+	raw := json.RawMessage(`{"subject":"Deployed ` + app + ` to ` + env + `"}`)
+	tags = append([]string{"deployment", "deploy_end", env, app}, tags...)
+	addMessage(t, srv, "acme/main", flowdock.Message{Event: &event, RawContent: &raw, Tags: &tags, Sent: &flowdock.Time{Time: sent}})
+}
+
+func day(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(12 * time.Hour)
+}
+
+func TestDeploys(t *testing.T) {
+	srv := setup(t)
+	deploy(t, srv, "web", "production", day("2023-12-20"))
+	deploy(t, srv, "web", "staging", day("2024-01-05"))
+	deploy(t, srv, "web", "production", day("2024-01-10"))
+	deploy(t, srv, "web", "production", day("2024-01-20"))
+	deploy(t, srv, "web", "production", day("2024-01-25"), "preproduction")
+	deploy(t, srv, "api", "production", day("2024-02-14"))
+	deploy(t, srv, "web", "production", day("2024-03-05"))
+
+	out := mustRun(t, srv, "deploys", "acme/main", "web", "api", "--since", "2024-01-01", "--until", "2024-03-31", "--exclude-tag", "preproduction")
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		got = append(got, strings.Join(strings.Fields(line), " "))
+	}
+	want := []string{
+		"APP MONTH DEPLOYS LEAD TIME LEAD TIME P90",
+		"api 2024-01 0",
+		"api 2024-02 1",
+		"api 2024-03 0",
+		"web 2024-01 2",
+		"web 2024-02 0",
+		"web 2024-03 1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deploys printed\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDeploys_emptyRange(t *testing.T) {
+	srv := setup(t)
+	if _, err := run(t, srv, "--output", "json", "deploys", "acme/main", "web", "--since", "2024-03-01", "--until", "2024-02-01"); err == nil {
+		t.Error("deploys with --since after --until returned no error")
+	}
+	if _, err := run(t, srv, "deploys", "acme/main", "web", "--since", "2999-01-01"); err == nil {
+		t.Error("deploys with --since in the future returned no error")
+	}
+	if _, err := run(t, srv, "deploys", "acme/main", "web", "--since", "2024-03-01", "--until", "2024-03-01"); err != nil {
+		t.Errorf("deploys of one day returned error: %v", err)
+	}
+}
+
+func TestDeploys_paging(t *testing.T) {
+	srv := setup(t)
+	for i := 0; i < 10; i++ {
+		deploy(t, srv, "web", "production", day("2023-12-20").Add(time.Duration(i)*time.Hour))
+	}
+	for i := 0; i < 250; i++ {
+		deploy(t, srv, "web", "production", day("2024-01-02").Add(time.Duration(i)*time.Hour))
+	}
+
+	out := mustRun(t, srv, "--output", "csv", "deploys", "acme/main", "web", "--since", "2024-01-01", "--until", "2024-01-31")
+	want := "APP,MONTH,DEPLOYS,LEAD TIME,LEAD TIME P90\nweb,2024-01,250,,\n"
+	if out != want {
+		t.Errorf("deploys printed\n%v\nwant\n%v", out, want)
+	}
+}
+
+func TestDeploys_leadTime(t *testing.T) {
+	srv := setup(t)
+	deploy(t, srv, "web", "staging", day("2024-01-01"))
+	deploy(t, srv, "web", "production", day("2024-01-02"))
+	deploy(t, srv, "web", "staging", day("2024-01-03"))
+	deploy(t, srv, "web", "staging", day("2024-01-04"))
+	deploy(t, srv, "web", "production", day("2024-01-05"))
+	deploy(t, srv, "web", "production", day("2024-01-06"))
+
+	out := mustRun(t, srv, "--output", "json", "deploys", "acme/main", "web", "--from-env", "staging", "--by", "week", "--summary", "--since", "2024-01-01", "--until", "2024-01-07")
+	var got []deployReport
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Deploys != 3 || got[0].Frequency != 3 || got[0].Periods != nil {
+		t.Fatalf("deploys printed %v", out)
+	}
+	lead := got[0].LeadTime
+	if lead == nil || lead.Deploys != 2 || time.Duration(lead.Median) != 24*time.Hour || time.Duration(lead.P90) != 48*time.Hour {
+		t.Errorf("lead time is %+v, want 2 deploys, median 24h and p90 48h", lead)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	srv := setup(t)
+	addMessage(t, srv, "acme/main", text("first"))
+	dir := t.TempDir()
+
+	mustRun(t, srv, "archive", "-q", dir, "acme/main")
+	addMessage(t, srv, "acme/main", text("second"))
+	out := mustRun(t, srv, "--org", "acme", "archive", "-q", dir, "main")
+
+	want := "FLOW       NEW  MESSAGES  FILES\nacme/main  1    2         0\n"
+	if out != want {
+		t.Errorf("archive printed\n%v\nwant\n%v", out, want)
+	}
+}
+
+func TestSearch_archive(t *testing.T) {
+	srv := setup(t)
+	addMessage(t, srv, "acme/main", text("deploy failed"))
+	addMessage(t, srv, "acme/main", text("deploy done"))
+	dir := t.TempDir()
+	mustRun(t, srv, "archive", "-q", dir)
+
+	out := mustRun(t, srv, "search", "--archive", dir, "deploy", "-failed")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], "acme/main  bot   deploy done") {
+		t.Errorf("search printed\n%v", out)
+	}
+}
+
+func TestMessagesList_query(t *testing.T) {
+	srv := setup(t)
+	old := text("last year")
+	old.Sent = &flowdock.Time{Time: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)}
+	addMessage(t, srv, "acme/main", old)
+	addMessage(t, srv, "acme/main", text("this year"))
+
+	out := mustRun(t, srv, "messages", "list", "acme/main", "--before", "2024-01-01")
+	if !strings.Contains(out, "last year") || strings.Contains(out, "this year") {
+		t.Errorf("messages list --before printed\n%v", out)
+	}
+
+	if _, err := run(t, srv, "messages", "list", "acme/main", "--event", "message,nope"); err == nil || !strings.Contains(err.Error(), `unknown event "nope"`) {
+		t.Errorf("messages list with an unknown event returned %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var flowsCommand = cli.Command{
+	Name:  "flows",
+	Usage: "list, show, create and update flows",
+	Subcommands: []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "list the flows you are a member of",
+			Action: action(flowsList),
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "all, a", Usage: "include flows you can join"},
+				cli.BoolFlag{Name: "users", Usage: "include each flow's users (json and yaml output)"},
+			},
+		},
+		{
+			Name:      "get",
+			Usage:     "show a flow by org/flow or by ID",
+			ArgsUsage: "org/flow|id",
+			Action:    action(flowsGet),
+		},
+		{
+			Name:      "create",
+			Usage:     "create a flow",
+			ArgsUsage: "org name",
+			Action:    action(flowsCreate),
+		},
+		{
+			Name:      "update",
+			Usage:     "change a flow's settings",
+			ArgsUsage: "org/flow",
+			Action:    action(flowsUpdate),
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name", Usage: "new display name"},
+				cli.StringFlag{Name: "open", Usage: "true or false"},
+				cli.StringFlag{Name: "disabled", Usage: "true or false"},
+				cli.StringFlag{Name: "access-mode", Usage: "invitation, link or organization"},
+			},
+		},
+	},
+}
+
+func flowsList(e *env, c *cli.Context) error {
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	flows, _, err := client.Flows.List(c.Bool("all"), &flowdock.FlowsListOptions{User: c.Bool("users")})
+	if err != nil {
+		return err
+	}
+	return e.out.Print(flows, flowHeader, flowRows(flows...))
+}
+
+func flowsGet(e *env, c *cli.Context) error {
+	if c.NArg() != 1 {
+		return usageError(c, "want one flow")
+	}
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+
+	var flow *flowdock.Flow
+	if arg := c.Args().First(); strings.Contains(arg, "/") {
+		org, name, _ := e.Flow(arg)
+		flow, _, err = client.Flows.Get(org, name)
+	} else {
+		flow, _, err = client.Flows.GetById(arg)
+	}
+	if err != nil {
+		return err
+	}
+	return e.out.Print(flow, flowHeader, flowRows(*flow))
+}
+
+func flowsCreate(e *env, c *cli.Context) error {
+	if c.NArg() != 2 {
+		return usageError(c, "want an organization and a flow name")
+	}
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	flow, _, err := client.Flows.Create(c.Args().Get(0), &flowdock.FlowsCreateOptions{Name: c.Args().Get(1)})
+	if err != nil {
+		return err
+	}
+	return e.out.Print(flow, flowHeader, flowRows(*flow))
+}
+
+func flowsUpdate(e *env, c *cli.Context) error {
+	if c.NArg() != 1 {
+		return usageError(c, "want one flow")
+	}
+	org, name, err := e.Flow(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	update := new(flowdock.Flow)
+	if c.IsSet("name") {
+		v := c.String("name")
+		update.Name = &v
+	}
+	if c.IsSet("access-mode") {
+		v := c.String("access-mode")
+		update.AccessMode = &v
+	}
+	if update.Open, err = boolFlag(c, "open"); err != nil {
+		return err
+	}
+	if update.Disabled, err = boolFlag(c, "disabled"); err != nil {
+		return err
+	}
+	if *update == (flowdock.Flow{}) {
+		return usageError(c, "nothing to update")
+	}
+
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	flow, _, err := client.Flows.Update(org, name, update)
+	if err != nil {
+		return err
+	}
+	return e.out.Print(flow, flowHeader, flowRows(*flow))
+}
+
+// boolFlag returns the value of a true/false flag, or nil if it was not
+// given.
+func boolFlag(c *cli.Context, name string) (*bool, error) {
+	if !c.IsSet(name) {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(c.String(name))
+	if err != nil {
+		return nil, usageError(c, "--%v: want true or false, got %q", name, c.String(name))
+	}
+	return &v, nil
+}
+
+var flowHeader = []string{"ID", "FLOW", "NAME", "OPEN", "JOINED", "ACCESS"}
+
+func flowRows(flows ...flowdock.Flow) [][]string {
+	rows := make([][]string, len(flows))
+	for i, f := range flows {
+		path := str(f.ParameterizedName)
+		if f.Organization != nil {
+			path = str(f.Organization.ParameterizedName) + "/" + path
+		}
+		rows[i] = []string{str(f.Id), path, str(f.Name), yesNo(f.Open), yesNo(f.Joined), str(f.AccessMode)}
+	}
+	return rows
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var inboxCommand = cli.Command{
+	Name:      "inbox",
+	Usage:     "post to a flow's team inbox; the content is read from stdin if --content is not given",
+	ArgsUsage: "flow-api-token",
+	Action:    action(inbox),
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "subject, s", Usage: "subject line"},
+		cli.StringFlag{Name: "content", Usage: "HTML body"},
+		cli.StringFlag{Name: "from-address", Usage: "sender's email address"},
+		cli.StringFlag{Name: "from-name", Usage: "sender's name"},
+		cli.StringFlag{Name: "source", Value: "flowdock-cli", Usage: "name of the sending application"},
+		cli.StringFlag{Name: "reply-to", Usage: "reply email address"},
+		cli.StringFlag{Name: "project", Usage: "project name shown with the message"},
+		cli.StringFlag{Name: "link", Usage: "link to the item in the sending application"},
+		cli.StringFlag{Name: "tags", Usage: "comma-separated tags"},
+	},
+}
+
+func inbox(e *env, c *cli.Context) error {
+	if c.NArg() != 1 {
+		return usageError(c, "want the flow's API token")
+	}
+	opt := &flowdock.InboxCreateOptions{
+		Source:      c.String("source"),
+		FromAddress: c.String("from-address"),
+		FromName:    c.String("from-name"),
+		Subject:     c.String("subject"),
+		Content:     c.String("content"),
+		ReplyTo:     c.String("reply-to"),
+		Project:     c.String("project"),
+		Link:        c.String("link"),
+		Tags:        splitList(c.String("tags")),
+	}
+	if opt.Subject == "" || opt.FromAddress == "" {
+		return usageError(c, "--subject and --from-address are required")
+	}
+	if opt.Content == "" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		opt.Content = string(data)
+	}
+
+	client, err := e.InboxClient()
+	if err != nil {
+		return err
+	}
+	msg, _, err := client.Inbox.Create(c.Args().First(), opt)
+	if err != nil {
+		return err
+	}
+	return e.out.Print(msg, messageHeader, messageRows(*msg))
+}
@@ -0,0 +1,104 @@
+// Command flowdock is a command-line client for the Flowdock API.
+//
+// Credentials and defaults are read from profiles in
+// $XDG_CONFIG_HOME/flowdock/config.yaml:
+//
+//	profile: work
+//	profiles:
+//	  work:
+//	    client_id: ...
+//	    client_secret: ...
+//	    org: acme
+//	    flow: main
+//
+// The first command run for a profile opens the browser to authorize the
+// application; the token is then saved and refreshed automatically.
+//
+// Examples:
+//
+//	flowdock flows list
+//	flowdock messages list acme/main --tags deploy
+//	flowdock messages post main "Deploy finished"
+//	flowdock --output yaml users acme/main
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codegangsta/cli"
+)
+
+// stdin is read by commands taking their input from standard input.
+var stdin io.Reader = os.Stdin
+
+func main() {
+	err := newApp(os.Stdout).Run(os.Args)
+	if status, ok := err.(exitStatus); ok {
+		os.Exit(int(status))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "flowdock:", err)
+		os.Exit(1)
+	}
+}
+
+func newApp(out io.Writer) *cli.App {
+	app := cli.NewApp()
+	app.Name = "flowdock"
+	app.Usage = "work with Flowdock flows, messages and users"
+	app.Writer = out
+
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "profile, p", Usage: "profile to use (default $FLOWDOCK_PROFILE or the config file's profile)"},
+		cli.StringFlag{Name: "output, o", Usage: "output format: table, csv, json or yaml (default table)"},
+		cli.StringFlag{Name: "org", Usage: "organization of flows given without one"},
+		cli.StringFlag{Name: "config", Usage: "configuration file (default " + defaultConfigPath() + ")"},
+		cli.StringFlag{Name: "id", Usage: "OAuth client ID"},
+		cli.StringFlag{Name: "secret", Usage: "OAuth client secret"},
+		cli.StringFlag{Name: "code", Usage: "authorization code, instead of authorizing in the browser"},
+		cli.StringFlag{Name: "api-url", Usage: "REST API URL", EnvVar: "FLOWDOCK_API_URL"},
+		cli.StringFlag{Name: "stream-url", Usage: "streaming API URL", EnvVar: "FLOWDOCK_STREAM_URL"},
+		cli.BoolFlag{Name: "debug", Usage: "log API requests to stderr", EnvVar: "FLOWDOCK_DEBUG"},
+	}
+
+	app.Commands = []cli.Command{
+		flowsCommand,
+		messagesCommand,
+		usersCommand,
+		orgsCommand,
+		postCommand,
+		inboxCommand,
+		tailCommand,
+		searchCommand,
+		deploysCommand,
+		archiveCommand,
+	}
+	return app
+}
+
+// action adapts a command implementation to a cli action, setting up its
+// environment first.
+func action(f func(e *env, c *cli.Context) error) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		e, err := newEnv(c)
+		if err != nil {
+			return err
+		}
+		return f(e, c)
+	}
+}
+
+// exitStatus makes the command exit with a status without printing an
+// error, like the status of a command run by post --tee.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+// usageError reports a command invoked with the wrong arguments.
+func usageError(c *cli.Context, format string, args ...interface{}) error {
+	return fmt.Errorf("%v: %v (see %v --help)", c.Command.FullName(), fmt.Sprintf(format, args...), c.Command.FullName())
+}
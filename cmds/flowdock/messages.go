@@ -0,0 +1,233 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var messageListFlags = []cli.Flag{
+	cli.StringFlag{Name: "event", Usage: "only messages of these comma-separated event types (message, comment, mail, ...)"},
+	cli.StringFlag{Name: "tags", Usage: "only messages with these comma-separated tags"},
+	cli.StringFlag{Name: "tag-mode", Usage: "match all (and) or any (or) of the tags"},
+	cli.IntFlag{Name: "limit, n", Value: 30, Usage: "number of messages"},
+	cli.IntFlag{Name: "since-id", Usage: "only messages after this ID"},
+	cli.IntFlag{Name: "until-id", Usage: "only messages before this ID"},
+	cli.StringFlag{Name: "after", Usage: "only messages sent on or after this day, as YYYY-MM-DD"},
+	cli.StringFlag{Name: "before", Usage: "only messages sent before this day, as YYYY-MM-DD"},
+}
+
+var messagesCommand = cli.Command{
+	Name:  "messages",
+	Usage: "list, post and comment on messages",
+	Subcommands: []cli.Command{
+		{
+			Name:      "list",
+			Usage:     "list a flow's recent messages",
+			ArgsUsage: "[org/flow]",
+			Action:    action(messagesList),
+			Flags:     append([]cli.Flag{cli.StringFlag{Name: "search", Usage: "only messages containing these words"}}, messageListFlags...),
+		},
+		{
+			Name:      "post",
+			Usage:     "post a message; the text is read from stdin if not given",
+			ArgsUsage: "org/flow [text...]",
+			Action:    action(messagesPost),
+			Flags:     []cli.Flag{cli.StringFlag{Name: "tags", Usage: "comma-separated tags"}},
+		},
+		{
+			Name:      "comment",
+			Usage:     "comment on a message; the text is read from stdin if not given",
+			ArgsUsage: "org/flow message-id [text...]",
+			Action:    action(messagesComment),
+			Flags:     []cli.Flag{cli.StringFlag{Name: "tags", Usage: "comma-separated tags"}},
+		},
+	},
+}
+
+var searchCommand = cli.Command{
+	Name:  "search",
+	Usage: "search a flow's messages, online or in an archive",
+	Description: `Without --archive, Flowdock searches the flow for messages containing all
+   of the words.
+
+   With --archive, every flow in an archive made by "flowdock archive" is
+   searched offline. The query can use phrases, OR, NOT and grouping, and
+   filter on tag:, user:, event:, flow:, after: and before:.
+
+      flowdock search --archive backup/ '"deploy failed" -staging user:alice after:2024-01-01'`,
+	ArgsUsage: "org/flow words... | --archive dir query...",
+	Action:    action(search),
+	Flags: append([]cli.Flag{
+		cli.StringFlag{Name: "archive", Usage: "search the archive in this directory instead of Flowdock"},
+		cli.BoolFlag{Name: "newest", Usage: "with --archive, show the newest hits first instead of the best"},
+	}, messageListFlags...),
+}
+
+func messagesList(e *env, c *cli.Context) error {
+	org, flow, err := e.Flow(c.Args().First())
+	if err != nil {
+		return usageError(c, "%v", err)
+	}
+	q, err := messageQuery(c)
+	if err != nil {
+		return err
+	}
+	return listMessages(e, org, flow, q.Search(c.String("search")))
+}
+
+func search(e *env, c *cli.Context) error {
+	if dir := c.String("archive"); dir != "" {
+		return searchArchive(e, c, dir)
+	}
+	if c.NArg() < 2 {
+		return usageError(c, "want a flow and the words to search for")
+	}
+	org, flow, err := e.Flow(c.Args().First())
+	if err != nil {
+		return usageError(c, "%v", err)
+	}
+	q, err := messageQuery(c)
+	if err != nil {
+		return err
+	}
+	return listMessages(e, org, flow, q.Search(strings.Join(c.Args().Tail(), " ")))
+}
+
+// messageQuery builds the query given by the messageListFlags.
+func messageQuery(c *cli.Context) (*flowdock.Query, error) {
+	q := flowdock.NewQuery().
+		Events(splitList(c.String("event"))...).
+		Limit(c.Int("limit")).
+		SinceID(c.Int("since-id")).
+		UntilID(c.Int("until-id"))
+	switch tags := splitList(c.String("tags")); c.String("tag-mode") {
+	case "", "and", "all":
+		q.AllTags(tags...)
+	case "or", "any":
+		q.AnyTags(tags...)
+	default:
+		return nil, usageError(c, "--tag-mode: want and or or")
+	}
+	for _, flag := range []string{"after", "before"} {
+		if c.String(flag) == "" {
+			continue
+		}
+		day, err := time.ParseInLocation(time.DateOnly, c.String(flag), time.Local)
+		if err != nil {
+			return nil, usageError(c, "--%v: want a date like 2024-01-31", flag)
+		}
+		if flag == "after" {
+			q.SentAfter(day)
+		} else {
+			q.SentBefore(day)
+		}
+	}
+	if _, err := q.Options(); err != nil {
+		return nil, usageError(c, "%v", err)
+	}
+	return q, nil
+}
+
+func listMessages(e *env, org, flow string, q *flowdock.Query) error {
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	messages, _, err := client.Messages.Query(org, flow, q)
+	if err != nil {
+		return err
+	}
+	return e.out.Print(messages, messageHeader, messageRows(messages...))
+}
+
+func messagesPost(e *env, c *cli.Context) error {
+	if c.NArg() < 1 {
+		return usageError(c, "want a flow")
+	}
+	return createMessage(e, c, c.Args().First(), 0, c.Args().Tail())
+}
+
+func messagesComment(e *env, c *cli.Context) error {
+	if c.NArg() < 2 {
+		return usageError(c, "want a flow and a message ID")
+	}
+	id, err := strconv.Atoi(c.Args().Get(1))
+	if err != nil {
+		return usageError(c, "invalid message ID %q", c.Args().Get(1))
+	}
+	return createMessage(e, c, c.Args().First(), id, c.Args()[2:])
+}
+
+// createMessage posts words as a message, or as a comment on the message
+// with ID parent if it is not zero.
+func createMessage(e *env, c *cli.Context, flowArg string, parent int, words []string) error {
+	org, name, err := e.Flow(flowArg)
+	if err != nil {
+		return usageError(c, "%v", err)
+	}
+	text := strings.Join(words, " ")
+	if len(words) == 0 {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimRight(string(data), "\n")
+	}
+	if text == "" {
+		return usageError(c, "empty message")
+	}
+
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	flow, _, err := client.Flows.Get(org, name)
+	if err != nil {
+		return err
+	}
+
+	opt := &flowdock.MessagesCreateOptions{
+		FlowID:  str(flow.Id),
+		Content: text,
+		Tags:    splitList(c.String("tags")),
+	}
+	var msg *flowdock.Message
+	if parent != 0 {
+		opt.Event = "comment"
+		opt.MessageID = parent
+		msg, _, err = client.Messages.CreateComment(opt)
+	} else {
+		opt.Event = "message"
+		msg, _, err = client.Messages.Create(opt)
+	}
+	if err != nil {
+		return err
+	}
+	return e.out.Print(msg, messageHeader, messageRows(*msg))
+}
+
+var messageHeader = []string{"ID", "SENT", "USER", "EVENT", "CONTENT"}
+
+func messageRows(messages ...flowdock.Message) [][]string {
+	rows := make([][]string, len(messages))
+	for i, m := range messages {
+		rows[i] = []string{num(m.ID), timestamp(m.Sent), str(m.UserID), str(m.Event), summary(m, 60)}
+	}
+	return rows
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"gopkg.in/yaml.v3"
+)
+
+// printer writes command results in the format chosen with --output.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case "":
+		format = "table"
+	case "table", "csv", "json", "yaml":
+	default:
+		return nil, fmt.Errorf("unknown output format %q (want table, csv, json or yaml)", format)
+	}
+	return &printer{w: w, format: format}, nil
+}
+
+// Print writes v as JSON or YAML, or writes header and rows as a table or
+// CSV.
+func (p *printer) Print(v interface{}, header []string, rows [][]string) error {
+	switch p.format {
+	case "json":
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		return writeYAML(p.w, v)
+	case "csv":
+		cw := csv.NewWriter(p.w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeYAML writes v as YAML using its JSON field names, in the same order
+// as the JSON output.
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle drops the flow style and quoting the JSON input gave the node.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func num(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func yesNo(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	if *b {
+		return "yes"
+	}
+	return "no"
+}
+
+func timestamp(t *flowdock.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// summary returns the message content on a single line, shortened to n
+// characters.
+func summary(m flowdock.Message, n int) string {
+	if m.Event == nil || m.RawContent == nil {
+		return ""
+	}
+	s := strings.Join(strings.Fields(m.Content().String()), " ")
+	if r := []rune(s); len(r) > n {
+		s = string(r[:n-1]) + "…"
+	}
+	return s
+}
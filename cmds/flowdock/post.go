@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var postCommand = cli.Command{
+	Name:  "post",
+	Usage: "post text, files or a command's output to a flow",
+	Description: `The message text is taken from the arguments, or read from stdin when
+   there are none and no files are attached.
+
+   With --tee, stdin is copied to stdout and posted as a thread as it
+   arrives: the first batch of lines starts the thread and later batches are
+   comments on it. Arguments after the flow are run as a command instead of
+   reading stdin, and its status becomes flowdock's:
+
+      make deploy 2>&1 | flowdock post --tee acme/ops
+      flowdock post --tee --code acme/ops -- make deploy`,
+	ArgsUsage: "org/flow [text...|command...]",
+	Action:    action(post),
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "tags, t", Usage: "comma-separated tags"},
+		cli.IntFlag{Name: "reply, r", Usage: "post as a comment on this message ID"},
+		cli.BoolFlag{Name: "code, c", Usage: "format the text as a code block"},
+		cli.StringFlag{Name: "lang", Usage: "language of the code block, for highlighting"},
+		cli.StringSliceFlag{Name: "file, f", Usage: "attach a file (repeatable)"},
+		cli.BoolFlag{Name: "tee", Usage: "copy stdin or a command's output to stdout and stream it into a thread"},
+		cli.DurationFlag{Name: "interval", Value: defaultTeeInterval, Usage: "with --tee, how often to post new output"},
+	},
+}
+
+func post(e *env, c *cli.Context) error {
+	if c.NArg() < 1 {
+		return usageError(c, "want a flow")
+	}
+	org, name, err := e.Flow(c.Args().First())
+	if err != nil {
+		return usageError(c, "%v", err)
+	}
+	words := c.Args().Tail()
+	if len(words) > 0 && words[0] == "--" {
+		words = words[1:]
+	}
+	files := c.StringSlice("file")
+	if c.Bool("tee") && len(files) > 0 {
+		return usageError(c, "--file cannot be used with --tee")
+	}
+
+	text := strings.Join(words, " ")
+	if !c.Bool("tee") && len(words) == 0 && len(files) == 0 {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		text = strings.TrimRight(string(data), "\n")
+		if text == "" {
+			return usageError(c, "empty message")
+		}
+	}
+
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	flow, _, err := client.Flows.Get(org, name)
+	if err != nil {
+		return err
+	}
+	tags := splitList(c.String("tags"))
+
+	if c.Bool("tee") {
+		t := &threadPoster{
+			client:   client,
+			flowID:   str(flow.Id),
+			parent:   c.Int("reply"),
+			tags:     tags,
+			code:     c.Bool("code"),
+			lang:     c.String("lang"),
+			interval: c.Duration("interval"),
+			warn:     os.Stderr,
+		}
+		if len(words) > 0 {
+			return t.run(words, c.App.Writer)
+		}
+		return t.tee(stdin, c.App.Writer)
+	}
+
+	var posted []flowdock.Message
+	if text != "" {
+		if c.Bool("code") {
+			text = codeBlock(text, c.String("lang"))
+		}
+		opt := &flowdock.MessagesCreateOptions{FlowID: str(flow.Id), Content: text, Tags: tags}
+		var msg *flowdock.Message
+		if id := c.Int("reply"); id != 0 {
+			opt.Event = "comment"
+			opt.MessageID = id
+			msg, _, err = client.Messages.CreateComment(opt)
+		} else {
+			opt.Event = "message"
+			msg, _, err = client.Messages.Create(opt)
+		}
+		if err != nil {
+			return err
+		}
+		posted = append(posted, *msg)
+	}
+	for _, path := range files {
+		msg, err := uploadFile(client, org, name, path, tags)
+		if err != nil {
+			return err
+		}
+		posted = append(posted, *msg)
+	}
+	return e.out.Print(posted, messageHeader, messageRows(posted...))
+}
+
+func uploadFile(client *flowdock.Client, org, flow, path string, tags []string) (*flowdock.Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	opt := &flowdock.MessagesUploadOptions{FileName: filepath.Base(path), Tags: tags}
+	msg, _, err := client.Messages.Upload(org, flow, f, opt)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// codeBlock fences text as Markdown code.
+func codeBlock(text, lang string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + text + "\n" + fence
+}
+
+// quoteCommand returns args as they would be typed in a shell.
+func quoteCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]#~") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
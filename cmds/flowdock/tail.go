@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/auth"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var tailCommand = cli.Command{
+	Name:      "tail",
+	Usage:     "follow new messages in one or more flows",
+	ArgsUsage: "[org/flow...]",
+	Action:    action(tail),
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "all, a", Usage: "follow every flow you have joined"},
+		cli.StringFlag{Name: "event", Usage: "only these comma-separated event types"},
+		cli.StringFlag{Name: "exclude-event", Value: "activity.user,user-edit,tag-change,action", Usage: "hide these comma-separated event types"},
+		cli.StringFlag{Name: "tag", Usage: "only messages with one of these comma-separated tags"},
+		cli.StringFlag{Name: "user", Usage: "only messages from these comma-separated nicks"},
+		cli.BoolFlag{Name: "resume, r", Usage: "first show the messages sent since the last tail of the same flows"},
+		cli.StringFlag{Name: "color", Value: "auto", Usage: "colour flow names: auto, always or never"},
+		cli.IntFlag{Name: "max", Usage: "exit after showing this many messages"},
+	},
+}
+
+// tailer follows a set of flows, printing the messages that pass its
+// filters.
+type tailer struct {
+	client *flowdock.Client
+	w      io.Writer
+	json   *json.Encoder
+	csv    *csv.Writer
+	color  bool
+
+	flows  map[string]*tailFlow        // by flow ID
+	recent map[string]flowdock.Message // by recentKey
+	order  []string
+	shown  int
+	state  tailState
+
+	events, excluded, tags, users map[string]bool
+}
+
+type tailFlow struct {
+	org, name string
+	color     string
+}
+
+func (f *tailFlow) String() string {
+	return f.org + "/" + f.name
+}
+
+// recentMessages is the number of messages kept to show the parent of a
+// comment without asking the API.
+const recentMessages = 500
+
+var flowColors = []string{"36", "33", "35", "32", "34", "31", "96", "93", "95", "92", "94", "91"}
+
+func tail(e *env, c *cli.Context) error {
+	t := &tailer{
+		w:        c.App.Writer,
+		flows:    map[string]*tailFlow{},
+		recent:   map[string]flowdock.Message{},
+		events:   set(c.String("event")),
+		excluded: set(c.String("exclude-event")),
+		tags:     set(c.String("tag")),
+		users:    set(c.String("user")),
+	}
+	switch e.out.format {
+	case "json":
+		t.json = json.NewEncoder(t.w)
+	case "csv":
+		t.csv = csv.NewWriter(t.w)
+		t.csv.Write([]string{"ID", "SENT", "FLOW", "USER", "EVENT", "CONTENT"})
+	case "yaml":
+		return usageError(c, "--output yaml is not supported, use table, csv or json")
+	}
+	switch c.String("color") {
+	case "always":
+		t.color = true
+	case "auto":
+		t.color = isTerminal(t.w)
+	case "never":
+	default:
+		return usageError(c, "--color: want auto, always or never")
+	}
+	if c.Bool("all") && c.NArg() > 0 {
+		return usageError(c, "give flows or --all, not both")
+	}
+
+	var names []string
+	if !c.Bool("all") {
+		args := c.Args()
+		if len(args) == 0 {
+			args = []string{""}
+		}
+		for _, arg := range args {
+			org, flow, err := e.Flow(arg)
+			if err != nil {
+				return usageError(c, "%v", err)
+			}
+			names = append(names, org+"/"+flow)
+		}
+	}
+
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+	t.client = client
+	if err := t.loadFlows(names); err != nil {
+		return err
+	}
+
+	// the requests above refreshed an expired token before it is used in
+	// the stream URL
+	token, err := e.AccessToken()
+	if err != nil {
+		return err
+	}
+
+	statePath, err := tailStatePath(e.auth.ProfileName())
+	if err != nil {
+		return err
+	}
+	if c.Bool("resume") {
+		if t.state, err = readTailState(statePath); err != nil {
+			return err
+		}
+	} else {
+		t.state = tailState{}
+	}
+	defer func() {
+		if err := t.state.write(statePath); err != nil {
+			fmt.Fprintln(os.Stderr, "flowdock: saving tail position:", err)
+		}
+	}()
+
+	var filter []string
+	for _, f := range t.flows {
+		filter = append(filter, f.String())
+	}
+	stream, es, err := client.Messages.StreamFlows(token, &flowdock.StreamOptions{Filter: filter})
+	if err != nil {
+		return err
+	}
+	defer es.Close()
+
+	max := c.Int("max")
+	if c.Bool("resume") {
+		if err := t.backfill(max); err != nil {
+			return err
+		}
+	}
+	// stop cleanly on ^C so the position is saved
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	for max == 0 || t.shown < max {
+		select {
+		case <-interrupt:
+			return nil
+		case m, ok := <-stream:
+			if !ok {
+				return nil
+			}
+			if err := t.handle(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadFlows looks up the flows to follow, or all joined flows if names is
+// empty, and gives each a colour.
+func (t *tailer) loadFlows(names []string) error {
+	var flows []flowdock.Flow
+	if len(names) == 0 {
+		all, _, err := t.client.Flows.List(false, nil)
+		if err != nil {
+			return err
+		}
+		for _, f := range all {
+			if f.Joined == nil || *f.Joined {
+				flows = append(flows, f)
+			}
+		}
+		if len(flows) == 0 {
+			return fmt.Errorf("you have not joined any flows")
+		}
+	}
+	for _, name := range names {
+		org, flow, _ := strings.Cut(name, "/")
+		f, _, err := t.client.Flows.Get(org, flow)
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		flows = append(flows, *f)
+	}
+
+	for i, f := range flows {
+		tf := &tailFlow{name: str(f.ParameterizedName), color: flowColors[i%len(flowColors)]}
+		if f.Organization != nil {
+			tf.org = str(f.Organization.ParameterizedName)
+		}
+		t.flows[str(f.Id)] = tf
+	}
+	return nil
+}
+
+// nick returns the nick of the message's author. The client's directory
+// looks up users who joined after the tail started.
+func (t *tailer) nick(m flowdock.Message) string {
+	id := str(m.UserID)
+	if n, err := strconv.Atoi(id); err == nil && n != 0 {
+		if u, err := t.client.Directory.User(n); err == nil && u.Nick != nil {
+			return *u.Nick
+		}
+	}
+	if m.ExternalUserName != nil {
+		return *m.ExternalUserName
+	}
+	if id == "" || id == "0" {
+		return "-"
+	}
+	return id
+}
+
+// backfill shows the messages each flow received since the saved position,
+// oldest first.
+func (t *tailer) backfill(max int) error {
+	for _, f := range t.flows {
+		since := t.state[f.String()]
+		if since == 0 {
+			continue
+		}
+		messages, err := t.missed(f, since)
+		if err != nil {
+			return fmt.Errorf("%v: %v", f, err)
+		}
+		for _, m := range messages {
+			if max != 0 && t.shown == max {
+				return nil
+			}
+			if err := t.handle(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missed pages back through the flow until it reaches the message with ID
+// since, and returns the newer ones oldest first.
+func (t *tailer) missed(f *tailFlow, since int) ([]flowdock.Message, error) {
+	opt := &flowdock.MessagesListOptions{Limit: 100}
+	var messages []flowdock.Message
+	for {
+		page, _, err := t.client.Messages.List(f.org, f.name, opt)
+		if err != nil {
+			return nil, err
+		}
+		oldest := 0
+		for _, m := range page {
+			if m.ID == nil {
+				continue
+			}
+			if oldest == 0 || *m.ID < oldest {
+				oldest = *m.ID
+			}
+			if *m.ID > since {
+				messages = append(messages, m)
+			}
+		}
+		if len(page) < opt.Limit || oldest == 0 || oldest <= since {
+			break
+		}
+		opt.UntilId = oldest
+	}
+	sort.Slice(messages, func(i, j int) bool { return *messages[i].ID < *messages[j].ID })
+	return messages, nil
+}
+
+// handle shows m if it passes the filters and was not shown before.
+func (t *tailer) handle(m flowdock.Message) error {
+	if m.ID == nil || m.FlowID == nil {
+		return nil
+	}
+	f := t.flows[*m.FlowID]
+	if f == nil {
+		return nil
+	}
+	if *m.ID <= t.state[f.String()] {
+		return nil
+	}
+	t.state[f.String()] = *m.ID
+	t.remember(m)
+
+	if !t.match(m) {
+		return nil
+	}
+	t.shown++
+	if t.json != nil {
+		return t.json.Encode(m)
+	}
+	if t.csv != nil {
+		t.csv.Write([]string{strconv.Itoa(*m.ID), timestamp(m.Sent), f.String(), t.nick(m), str(m.Event), summary(m, 400)})
+		t.csv.Flush()
+		return t.csv.Error()
+	}
+
+	name := f.String()
+	if t.color {
+		name = "\x1b[" + f.color + "m" + name + "\x1b[0m"
+	}
+	text := summary(m, 400)
+	if str(m.Event) == "comment" {
+		text = "↳ " + t.parent(f, m) + ": " + text
+	} else if str(m.Event) != "message" {
+		text = "[" + str(m.Event) + "] " + text
+	}
+	_, err := fmt.Fprintf(t.w, "%v  %v  %v: %v\n", timestamp(m.Sent), name, t.nick(m), text)
+	return err
+}
+
+func (t *tailer) match(m flowdock.Message) bool {
+	event := str(m.Event)
+	if len(t.events) > 0 && !t.events[event] || t.excluded[event] && !t.events[event] {
+		return false
+	}
+	if len(t.users) > 0 && !t.users[t.nick(m)] {
+		return false
+	}
+	if len(t.tags) > 0 {
+		if m.Tags == nil {
+			return false
+		}
+		for _, tag := range *m.Tags {
+			if t.tags[strings.TrimPrefix(tag, "#")] {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// recentKey identifies a message among the recent ones. Message IDs are
+// only unique within a flow.
+func recentKey(flowID string, id int) string {
+	return flowID + "/" + strconv.Itoa(id)
+}
+
+// remember keeps m to show it as the parent of later comments.
+func (t *tailer) remember(m flowdock.Message) {
+	key := recentKey(str(m.FlowID), *m.ID)
+	t.recent[key] = m
+	t.order = append(t.order, key)
+	if len(t.order) > recentMessages {
+		delete(t.recent, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+// parent describes the message a comment belongs to: the start of its text
+// if it is known or can be fetched, otherwise the title Flowdock sent with
+// the comment.
+func (t *tailer) parent(f *tailFlow, comment flowdock.Message) string {
+	id := parentID(comment)
+	if id != 0 {
+		m, ok := t.recent[recentKey(str(comment.FlowID), id)]
+		if !ok {
+			if p, _, err := t.client.Messages.Get(f.org, f.name, id); err == nil && p.ID != nil {
+				m, ok = *p, true
+				m.FlowID = comment.FlowID
+				t.remember(m)
+			}
+		}
+		if ok {
+			return fmt.Sprintf("%v %q", t.nick(m), summary(m, 40))
+		}
+	}
+	if comment.RawContent != nil {
+		var content flowdock.CommentContent
+		if json.Unmarshal(*comment.RawContent, &content) == nil && content.Title != nil {
+			return strconv.Quote(*content.Title)
+		}
+	}
+	return "comment"
+}
+
+// parentID returns the ID of the message a comment belongs to, from its
+// message field or its "influx:<id>" tag.
+func parentID(m flowdock.Message) int {
+	if m.MessageID != nil {
+		return *m.MessageID
+	}
+	if m.Tags != nil {
+		for _, tag := range *m.Tags {
+			if v, ok := strings.CutPrefix(tag, "influx:"); ok {
+				id, _ := strconv.Atoi(v)
+				return id
+			}
+		}
+	}
+	return 0
+}
+
+// tailState records the last message seen in each flow ("org/flow"), so
+// tail --resume can show what was missed.
+type tailState map[string]int
+
+func tailStatePath(profile string) (string, error) {
+	dir, err := auth.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tail", profile+".json"), nil
+}
+
+func readTailState(path string) (tailState, error) {
+	state := tailState{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("reading %v: %v", path, err)
+	}
+	return state, nil
+}
+
+// write merges s into the saved state, keeping the positions of flows not
+// followed this time.
+func (s tailState) write(path string) error {
+	saved, err := readTailState(path)
+	if err != nil {
+		saved = tailState{}
+	}
+	for flow, id := range s {
+		if id > saved[flow] {
+			saved[flow] = id
+		}
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func set(list string) map[string]bool {
+	m := map[string]bool{}
+	for _, item := range splitList(list) {
+		m[item] = true
+	}
+	return m
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+const (
+	defaultTeeInterval = 5 * time.Second
+
+	// maxBatch is the most text posted in one message, leaving room for the
+	// code fence within Flowdock's message size limit.
+	maxBatch = 8000
+)
+
+// threadPoster posts lines of output to a flow as a thread. Lines are
+// collected and posted every interval, or sooner when a batch is full. The
+// first batch starts the thread unless parent is set; later batches are
+// comments on it. While Flowdock is rate limiting, lines keep collecting and
+// are posted once the Retry-After delay has passed.
+type threadPoster struct {
+	client   *flowdock.Client
+	flowID   string
+	parent   int
+	tags     []string
+	code     bool
+	lang     string
+	interval time.Duration
+	warn     io.Writer
+
+	pending   []string
+	size      int
+	notBefore time.Time
+	err       error
+}
+
+// run runs args, copying its output to out and posting it. The command's
+// exit status is returned as an exitStatus.
+func (t *threadPoster) run(args []string, out io.Writer) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	cmd.Stdin = stdin
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	t.add("$ " + quoteCommand(args))
+	waitErr := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		waitErr <- err
+	}()
+	return t.copy(pr, out, func() error {
+		err := <-waitErr
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			t.add(fmt.Sprintf("[%v]", exit.ProcessState))
+			return exitStatus(exit.ExitCode())
+		}
+		return err
+	})
+}
+
+// tee copies r to out, posting each line.
+func (t *threadPoster) tee(r io.Reader, out io.Writer) error {
+	return t.copy(r, out, func() error { return nil })
+}
+
+// copy copies r to out line by line, posting the lines, until r ends. Then
+// it calls done, posts what is left and returns done's error, or the error
+// that stopped posting.
+func (t *threadPoster) copy(r io.Reader, out io.Writer, done func() error) error {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				io.WriteString(out, line)
+				lines <- strings.TrimRight(line, "\r\n")
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				readErr <- err
+				close(lines)
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				err := done()
+				if rerr := <-readErr; err == nil {
+					err = rerr
+				}
+				t.drain()
+				if err == nil {
+					err = t.err
+				}
+				return err
+			}
+			t.add(line)
+			if t.size >= maxBatch {
+				t.flush()
+			}
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+func (t *threadPoster) add(line string) {
+	// lines too long for one message are posted in parts, split between
+	// runes
+	for len(line) > maxBatch {
+		i := maxBatch
+		for !utf8.RuneStart(line[i]) {
+			i--
+		}
+		t.pending = append(t.pending, line[:i])
+		t.size += i + 1
+		line = line[i:]
+	}
+	t.pending = append(t.pending, line)
+	t.size += len(line) + 1
+}
+
+// flush posts the pending lines, unless posting stopped on an error or
+// Flowdock asked to wait.
+func (t *threadPoster) flush() {
+	for len(t.pending) > 0 && t.err == nil && !time.Now().Before(t.notBefore) {
+		n, size := 0, 0
+		for n < len(t.pending) && (n == 0 || size+len(t.pending[n])+1 <= maxBatch) {
+			size += len(t.pending[n]) + 1
+			n++
+		}
+		text := strings.Join(t.pending[:n], "\n")
+
+		resp, err := t.post(text)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			t.notBefore = time.Now().Add(retryAfter(resp, t.interval))
+			return
+		}
+		if err != nil {
+			t.err = err
+			fmt.Fprintln(t.warn, "flowdock: posting output stopped:", err)
+			return
+		}
+		t.pending = t.pending[n:]
+		t.size -= size
+	}
+}
+
+// drain posts everything still pending, waiting out rate limits.
+func (t *threadPoster) drain() {
+	for len(t.pending) > 0 && t.err == nil {
+		time.Sleep(time.Until(t.notBefore))
+		t.flush()
+	}
+}
+
+func (t *threadPoster) post(text string) (*http.Response, error) {
+	if t.code {
+		text = codeBlock(text, t.lang)
+	}
+	opt := &flowdock.MessagesCreateOptions{FlowID: t.flowID, Content: text, Tags: t.tags}
+	if t.parent != 0 {
+		opt.Event = "comment"
+		opt.MessageID = t.parent
+		_, resp, err := t.client.Messages.CreateComment(opt)
+		return resp, err
+	}
+	opt.Event = "message"
+	msg, resp, err := t.client.Messages.Create(opt)
+	if err == nil && msg.ID != nil {
+		t.parent = *msg.ID
+	}
+	return resp, err
+}
+
+// retryAfter returns the delay requested by a 429 response's Retry-After
+// header, or def if it has none.
+func retryAfter(resp *http.Response, def time.Duration) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return time.Until(at)
+	}
+	return def
+}
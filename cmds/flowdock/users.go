@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/codegangsta/cli"
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+var usersCommand = cli.Command{
+	Name:      "users",
+	Usage:     "list the users you can see, or a flow's users",
+	ArgsUsage: "[org/flow]",
+	Action:    action(users),
+}
+
+var orgsCommand = cli.Command{
+	Name:      "orgs",
+	Usage:     "list your organizations, or show one",
+	ArgsUsage: "[org]",
+	Action:    action(orgs),
+}
+
+func users(e *env, c *cli.Context) error {
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+
+	var users []flowdock.User
+	if c.NArg() == 0 {
+		users, _, err = client.Users.All()
+	} else {
+		org, flow, ferr := e.Flow(c.Args().First())
+		if ferr != nil {
+			return usageError(c, "%v", ferr)
+		}
+		users, _, err = client.Users.List(org, flow)
+	}
+	if err != nil {
+		return err
+	}
+	return e.out.Print(users, userHeader, userRows(users...))
+}
+
+func orgs(e *env, c *cli.Context) error {
+	client, err := e.Client()
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() > 0 {
+		org, _, err := client.Organizations.GetByParameterizedName(c.Args().First())
+		if err != nil {
+			return err
+		}
+		return e.out.Print(org, orgHeader, orgRows(*org))
+	}
+	orgs, _, err := client.Organizations.All()
+	if err != nil {
+		return err
+	}
+	return e.out.Print(orgs, orgHeader, orgRows(orgs...))
+}
+
+var userHeader = []string{"ID", "NICK", "NAME", "EMAIL"}
+
+func userRows(users ...flowdock.User) [][]string {
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		rows[i] = []string{num(u.Id), str(u.Nick), str(u.Name), str(u.Email)}
+	}
+	return rows
+}
+
+var orgHeader = []string{"ID", "ORG", "NAME", "USERS"}
+
+func orgRows(orgs ...flowdock.Organization) [][]string {
+	rows := make([][]string, len(orgs))
+	for i, o := range orgs {
+		var count string
+		if o.UserCount != nil {
+			count = strconv.FormatInt(*o.UserCount, 10)
+		}
+		rows[i] = []string{num(o.Id), str(o.ParameterizedName), str(o.Name), count}
+	}
+	return rows
+}
@@ -0,0 +1,131 @@
+package flowdock
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DeliveryRetention is how long Deliveries keeps a sent message, waiting for
+// a stream to echo it and then for it to be looked up.
+const DeliveryRetention = 10 * time.Minute
+
+// ErrNotPending is returned by Deliveries.Wait for a UUID no message was
+// created with, or one forgotten after DeliveryRetention.
+var ErrNotPending = errors.New("flowdock: no message pending with this UUID")
+
+// Deliveries matches the messages created by MessagesService to their echo
+// in the streams opened by the same client, to tell when a message was
+// delivered to the flow. Messages are identified by their UUID, which
+// MessagesService.Create assigns if it is missing:
+//
+//	opt := &flowdock.MessagesCreateOptions{FlowID: flowID, Content: "build failed"}
+//	_, _, err := client.Messages.Create(opt)
+//	...
+//	m, err := client.Deliveries.Wait(ctx, opt.UUID)
+//
+// Only messages echoed by a stream of their flow, opened before they were
+// created, are seen as delivered.
+type Deliveries struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*delivery
+}
+
+type delivery struct {
+	created time.Time
+	done    chan struct{}
+	message Message
+}
+
+func newDeliveries() *Deliveries {
+	return &Deliveries{now: time.Now, pending: map[string]*delivery{}}
+}
+
+// add starts waiting for the message with the UUID, forgetting those sent
+// longer than DeliveryRetention ago.
+func (d *Deliveries) add(uuid string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	for id, p := range d.pending {
+		if now.Sub(p.created) > DeliveryRetention {
+			delete(d.pending, id)
+		}
+	}
+	if _, ok := d.pending[uuid]; !ok {
+		d.pending[uuid] = &delivery{created: now, done: make(chan struct{})}
+	}
+}
+
+// Update marks a pending message with the UUID of m as delivered. Streams
+// opened by MessagesService call it for every message they receive.
+func (d *Deliveries) Update(m Message) {
+	if m.UUID == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pending[*m.UUID]
+	if !ok {
+		return
+	}
+	select {
+	case <-p.done:
+	default:
+		p.message = m
+		close(p.done)
+	}
+}
+
+// Delivered returns the echo of the message created with the UUID, if a
+// stream has received it.
+func (d *Deliveries) Delivered(uuid string) (Message, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pending[uuid]
+	if !ok {
+		return Message{}, false
+	}
+	select {
+	case <-p.done:
+		return p.message, true
+	default:
+		return Message{}, false
+	}
+}
+
+// Wait waits for a stream to echo the message created with the UUID and
+// returns the echo, or ctx's error if it is done first.
+func (d *Deliveries) Wait(ctx context.Context, uuid string) (Message, error) {
+	d.mu.Lock()
+	p, ok := d.pending[uuid]
+	d.mu.Unlock()
+	if !ok {
+		return Message{}, ErrNotPending
+	}
+
+	select {
+	case <-p.done:
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return p.message, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
+// NewUUID returns a random (version 4) UUID, to identify a message.
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("flowdock: reading random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
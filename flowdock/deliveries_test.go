@@ -0,0 +1,104 @@
+package flowdock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := NewUUID()
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("NewUUID returned %q, want a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("NewUUID returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestMessagesService_Create_uuid(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var uuids []string
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ UUID string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if uuids = append(uuids, body.UUID); len(uuids) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+
+	client.Use(Retry(RetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}))
+	opt := &MessagesCreateOptions{FlowID: "org:flow", Content: "build failed"}
+	if _, _, err := client.Messages.Create(opt); err != nil {
+		t.Fatalf("Messages.Create returned error: %v", err)
+	}
+	if !uuidPattern.MatchString(opt.UUID) {
+		t.Errorf("Messages.Create assigned UUID %q", opt.UUID)
+	}
+	if len(uuids) != 2 || uuids[0] != opt.UUID || uuids[1] != opt.UUID {
+		t.Errorf("server got UUIDs %q, want %q retried", uuids, opt.UUID)
+	}
+
+	given := &MessagesCreateOptions{FlowID: "org:flow", Content: "build failed", UUID: "mine"}
+	client.Messages.Create(given)
+	if given.UUID != "mine" || uuids[2] != "mine" {
+		t.Errorf("Messages.Create replaced the UUID with %q", uuids[2])
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	d := newDeliveries()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	if _, err := d.Wait(context.Background(), "a"); err != ErrNotPending {
+		t.Errorf("Wait for an unknown UUID returned %v, want ErrNotPending", err)
+	}
+
+	d.add("a")
+	if _, ok := d.Delivered("a"); ok {
+		t.Error("Delivered reported a message before its echo")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.Wait(ctx, "a"); err != context.DeadlineExceeded {
+		t.Errorf("Wait returned %v, want context.DeadlineExceeded", err)
+	}
+
+	id, other := 7, "b"
+	d.Update(Message{ID: &id})
+	d.Update(Message{ID: &id, UUID: &other})
+	uuid := "a"
+	go d.Update(Message{ID: &id, UUID: &uuid})
+	m, err := d.Wait(context.Background(), "a")
+	if err != nil || *m.ID != 7 {
+		t.Errorf("Wait returned %+v, %v; want the echo", m, err)
+	}
+	if m, ok := d.Delivered("a"); !ok || *m.ID != 7 {
+		t.Errorf("Delivered returned %+v, %v; want the echo", m, ok)
+	}
+	d.Update(Message{UUID: &uuid}) // a second echo changes nothing
+	if m, _ := d.Delivered("a"); m.ID == nil {
+		t.Error("a second echo replaced the delivered message")
+	}
+
+	now = now.Add(DeliveryRetention + time.Second)
+	d.add("c")
+	if _, err := d.Wait(context.Background(), "a"); err != ErrNotPending {
+		t.Errorf("Wait after DeliveryRetention returned %v, want ErrNotPending", err)
+	}
+}
@@ -0,0 +1,368 @@
+package flowdock
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDirectoryTTL is how long a Directory keeps users and flows before
+// loading them again, unless its TTL is set.
+const DefaultDirectoryTTL = 10 * time.Minute
+
+// ErrNotFound is returned by Directory lookups that match no user or flow.
+var ErrNotFound = errors.New("flowdock: not found")
+
+// Directory caches the users and flows visible to the authenticated user, to
+// show nicks and flow names for the IDs in messages without asking the API
+// each time.
+//
+// Users and flows are loaded on the first lookup and again when they are
+// older than the TTL. Users and flows missing from the lists are fetched
+// one at a time when looked up by ID, and IDs that match none are not asked
+// for again until the TTL has passed. Lookups do not hold up each other or
+// Update while they wait for the API, and concurrent lookups of the same
+// users, flows or ID share one request. The user-edit and flow-change events
+// of streams opened by MessagesService update the directory as they arrive.
+type Directory struct {
+	// TTL is how long loaded users and flows are used, DefaultDirectoryTTL
+	// when zero.
+	TTL time.Duration
+
+	client *Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	users       map[int]*User
+	usersLoaded time.Time
+	flows       map[string]*Flow
+	flowsLoaded time.Time
+	missing     map[string]time.Time // by fetch key, when found missing
+	calls       map[string]*dirCall  // by fetch key
+}
+
+// dirCall is a request of a Directory in progress, which the lookups
+// needing the same result wait for.
+type dirCall struct {
+	done chan struct{}
+	v    interface{}
+	err  error
+}
+
+func newDirectory(c *Client) *Directory {
+	return &Directory{client: c, now: time.Now}
+}
+
+// User returns the user with the given ID.
+func (d *Directory) User(id int) (*User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.loadUsers(); err != nil {
+		return nil, err
+	}
+	if u, ok := d.users[id]; ok {
+		return copyUser(u), nil
+	}
+
+	v, err := d.fetchMissing("user/"+strconv.Itoa(id), func() (interface{}, error) {
+		u, resp, err := d.client.Users.Get(id)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return u, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	u := v.(*User)
+	if d.users != nil {
+		d.users[id] = u
+	}
+	return copyUser(u), nil
+}
+
+// UserByNick returns the user with the given nick, ignoring case.
+func (d *Directory) UserByNick(nick string) (*User, error) {
+	return d.findUser(func(u *User) bool { return u.Nick != nil && strings.EqualFold(*u.Nick, nick) })
+}
+
+// UserByEmail returns the user with the given email address, ignoring case.
+func (d *Directory) UserByEmail(email string) (*User, error) {
+	return d.findUser(func(u *User) bool { return u.Email != nil && strings.EqualFold(*u.Email, email) })
+}
+
+func (d *Directory) findUser(match func(*User) bool) (*User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.loadUsers(); err != nil {
+		return nil, err
+	}
+	for _, u := range d.users {
+		if match(u) {
+			return copyUser(u), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Nick returns the nick of the user with the given ID, as found in
+// Message.UserID. It returns the ID itself if the user cannot be found.
+func (d *Directory) Nick(userID string) string {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return userID
+	}
+	u, err := d.User(id)
+	if err != nil || u.Nick == nil {
+		return userID
+	}
+	return *u.Nick
+}
+
+// Flow returns the flow with the given ID.
+func (d *Directory) Flow(id string) (*Flow, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.loadFlows(); err != nil {
+		return nil, err
+	}
+	if f, ok := d.flows[id]; ok {
+		return copyFlow(f), nil
+	}
+
+	v, err := d.fetchMissing("flow/"+id, func() (interface{}, error) {
+		f, resp, err := d.client.Flows.GetById(id)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return f, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	f := v.(*Flow)
+	if d.flows != nil {
+		d.flows[id] = f
+	}
+	return copyFlow(f), nil
+}
+
+// FlowByName returns the flow with the given parameterized names of its
+// organization and itself.
+func (d *Directory) FlowByName(org, flow string) (*Flow, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.loadFlows(); err != nil {
+		return nil, err
+	}
+	for _, f := range d.flows {
+		if f.ParameterizedName != nil && *f.ParameterizedName == flow &&
+			f.Organization != nil && f.Organization.ParameterizedName != nil && *f.Organization.ParameterizedName == org {
+			return copyFlow(f), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// FlowName returns "org/flow" for the flow with the given ID, as found in
+// Message.FlowID. It returns the ID itself if the flow cannot be found.
+func (d *Directory) FlowName(flowID string) string {
+	f, err := d.Flow(flowID)
+	if err != nil || f.ParameterizedName == nil {
+		return flowID
+	}
+	if f.Organization == nil || f.Organization.ParameterizedName == nil {
+		return *f.ParameterizedName
+	}
+	return *f.Organization.ParameterizedName + "/" + *f.ParameterizedName
+}
+
+// Update applies a user-edit or flow-change event to the cached users and
+// flows. Other messages are ignored.
+func (d *Directory) Update(m Message) {
+	if m.Event == nil || m.RawContent == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch *m.Event {
+	case "user-edit":
+		var content struct {
+			User User `json:"user"`
+		}
+		if json.Unmarshal(*m.RawContent, &content) != nil || m.UserID == nil {
+			return
+		}
+		id, err := strconv.Atoi(*m.UserID)
+		if err != nil || d.users == nil {
+			return
+		}
+		if u, ok := d.users[id]; ok {
+			mergeUser(u, &content.User)
+		}
+	case "flow-change":
+		f := new(Flow)
+		if json.Unmarshal(*m.RawContent, f) != nil || f.Id == nil || d.flows == nil {
+			return
+		}
+		if old, ok := d.flows[*f.Id]; ok && f.Organization == nil {
+			f.Organization = old.Organization
+		}
+		d.flows[*f.Id] = f
+	}
+}
+
+// Invalidate drops the cached users and flows, to load them again on the
+// next lookup.
+func (d *Directory) Invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users, d.flows, d.missing = nil, nil, nil
+}
+
+func (d *Directory) ttl() time.Duration {
+	if d.TTL > 0 {
+		return d.TTL
+	}
+	return DefaultDirectoryTTL
+}
+
+// fetch calls get with d.mu released, or waits for the call with the same
+// key in progress, and returns its result. d.mu must be held, and is held
+// again when fetch returns.
+func (d *Directory) fetch(key string, get func() (interface{}, error)) (interface{}, error) {
+	if c, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		<-c.done
+		d.mu.Lock()
+		return c.v, c.err
+	}
+	c := &dirCall{done: make(chan struct{})}
+	if d.calls == nil {
+		d.calls = make(map[string]*dirCall)
+	}
+	d.calls[key] = c
+	d.mu.Unlock()
+	c.v, c.err = get()
+	d.mu.Lock()
+	delete(d.calls, key)
+	close(c.done)
+	return c.v, c.err
+}
+
+// fetchMissing fetches a user or flow missing from the lists, and
+// remembers for the TTL when get returns ErrNotFound. d.mu must be held.
+func (d *Directory) fetchMissing(key string, get func() (interface{}, error)) (interface{}, error) {
+	if at, ok := d.missing[key]; ok && d.now().Sub(at) < d.ttl() {
+		return nil, ErrNotFound
+	}
+	v, err := d.fetch(key, get)
+	if err == ErrNotFound {
+		if d.missing == nil {
+			d.missing = make(map[string]time.Time)
+		}
+		d.missing[key] = d.now()
+	}
+	return v, err
+}
+
+// usersFresh reports whether the loaded users are younger than the TTL.
+// d.mu must be held.
+func (d *Directory) usersFresh() bool {
+	return d.users != nil && d.now().Sub(d.usersLoaded) < d.ttl()
+}
+
+// flowsFresh reports whether the loaded flows are younger than the TTL.
+// d.mu must be held.
+func (d *Directory) flowsFresh() bool {
+	return d.flows != nil && d.now().Sub(d.flowsLoaded) < d.ttl()
+}
+
+// loadUsers loads the users if they are missing or stale. d.mu must be held.
+func (d *Directory) loadUsers() error {
+	if d.usersFresh() {
+		return nil
+	}
+	v, err := d.fetch("users", func() (interface{}, error) {
+		users, _, err := d.client.Users.All()
+		return users, err
+	})
+	if err != nil {
+		return err
+	}
+	if d.usersFresh() {
+		return nil // stored by a lookup that shared the request
+	}
+	users := v.([]User)
+	d.users = make(map[int]*User, len(users))
+	for i := range users {
+		if users[i].Id != nil {
+			d.users[*users[i].Id] = &users[i]
+		}
+	}
+	d.usersLoaded = d.now()
+	return nil
+}
+
+// loadFlows loads the flows if they are missing or stale. d.mu must be held.
+func (d *Directory) loadFlows() error {
+	if d.flowsFresh() {
+		return nil
+	}
+	v, err := d.fetch("flows", func() (interface{}, error) {
+		flows, _, err := d.client.Flows.List(true, nil)
+		return flows, err
+	})
+	if err != nil {
+		return err
+	}
+	if d.flowsFresh() {
+		return nil // stored by a lookup that shared the request
+	}
+	flows := v.([]Flow)
+	d.flows = make(map[string]*Flow, len(flows))
+	for i := range flows {
+		if flows[i].Id != nil {
+			d.flows[*flows[i].Id] = &flows[i]
+		}
+	}
+	d.flowsLoaded = d.now()
+	return nil
+}
+
+// mergeUser copies the fields set in update to u.
+func mergeUser(u, update *User) {
+	if update.Nick != nil {
+		u.Nick = update.Nick
+	}
+	if update.Name != nil {
+		u.Name = update.Name
+	}
+	if update.Email != nil {
+		u.Email = update.Email
+	}
+	if update.Avatar != nil {
+		u.Avatar = update.Avatar
+	}
+	if update.Status != nil {
+		u.Status = update.Status
+	}
+	if update.Disabled != nil {
+		u.Disabled = update.Disabled
+	}
+}
+
+func copyUser(u *User) *User {
+	c := *u
+	return &c
+}
+
+func copyFlow(f *Flow) *Flow {
+	c := *f
+	return &c
+}
@@ -0,0 +1,179 @@
+package flowdock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDirectory(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var loads int
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		loads++
+		fmt.Fprint(w, `[{"id": 1, "nick": "alice", "email": "alice@example.com"}, {"id": 2, "nick": "bob"}]`)
+	})
+	mux.HandleFunc("/users/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 3, "nick": "carol"}`)
+	})
+	var misses int
+	mux.HandleFunc("/users/4", func(w http.ResponseWriter, r *http.Request) {
+		misses++
+		http.Error(w, "Not found", http.StatusNotFound)
+	})
+
+	d := client.Directory
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	if u, err := d.User(1); err != nil || *u.Nick != "alice" {
+		t.Errorf("Directory.User(1) = %+v, %v", u, err)
+	}
+	if u, err := d.UserByNick("BOB"); err != nil || *u.Id != 2 {
+		t.Errorf("Directory.UserByNick = %+v, %v", u, err)
+	}
+	if u, err := d.UserByEmail("alice@example.com"); err != nil || *u.Id != 1 {
+		t.Errorf("Directory.UserByEmail = %+v, %v", u, err)
+	}
+	if _, err := d.UserByNick("dave"); err != ErrNotFound {
+		t.Errorf("Directory.UserByNick of an unknown nick returned %v, want ErrNotFound", err)
+	}
+	if nick := d.Nick("3"); nick != "carol" {
+		t.Errorf("Directory.Nick of a user missing from the list = %v, want carol", nick)
+	}
+	for i := 0; i < 2; i++ {
+		if nick := d.Nick("4"); nick != "4" {
+			t.Errorf("Directory.Nick of an unknown user = %v, want 4", nick)
+		}
+	}
+	if misses != 1 {
+		t.Errorf("unknown user fetched %d times, want once", misses)
+	}
+	if loads != 1 {
+		t.Errorf("users loaded %d times, want once", loads)
+	}
+
+	now = now.Add(DefaultDirectoryTTL)
+	d.User(1)
+	if loads != 2 {
+		t.Errorf("users loaded %d times after the TTL, want twice", loads)
+	}
+}
+
+func TestDirectory_flows(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/all", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"id": "f1", "parameterized_name": "main", "organization": {"parameterized_name": "acme"}}]`)
+	})
+	mux.HandleFunc("/flows/find", func(w http.ResponseWriter, r *http.Request) {
+		testFormValues(t, r, values{"id": "f2"})
+		fmt.Fprint(w, `{"id": "f2", "parameterized_name": "ops", "organization": {"parameterized_name": "acme"}}`)
+	})
+
+	d := client.Directory
+	if f, err := d.FlowByName("acme", "main"); err != nil || *f.Id != "f1" {
+		t.Errorf("Directory.FlowByName = %+v, %v", f, err)
+	}
+	if name := d.FlowName("f2"); name != "acme/ops" {
+		t.Errorf("Directory.FlowName of a flow missing from the list = %v, want acme/ops", name)
+	}
+	if _, err := d.FlowByName("acme", "nope"); err != ErrNotFound {
+		t.Errorf("Directory.FlowByName of an unknown flow returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestDirectory_Update(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "nick": "alice", "email": "alice@example.com"}]`)
+	})
+	mux.HandleFunc("/flows/all", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": "f1", "name": "Main", "parameterized_name": "main", "organization": {"parameterized_name": "acme"}}]`)
+	})
+
+	d := client.Directory
+	d.User(1)
+	d.Flow("f1")
+
+	event := func(name, user, content string) Message {
+		raw := json.RawMessage(content)
+		return Message{Event: &name, UserID: &user, RawContent: &raw}
+	}
+	d.Update(event("user-edit", "1", `{"user": {"nick": "ally"}}`))
+	d.Update(event("flow-change", "1", `{"id": "f1", "name": "Renamed", "parameterized_name": "main"}`))
+	d.Update(event("message", "1", `"ignored"`))
+
+	u, _ := d.User(1)
+	if *u.Nick != "ally" || *u.Email != "alice@example.com" {
+		t.Errorf("Directory.User after user-edit = %+v", u)
+	}
+	if name := d.FlowName("f1"); name != "acme/main" {
+		t.Errorf("Directory.FlowName after flow-change = %v, want acme/main", name)
+	}
+	if f, _ := d.Flow("f1"); *f.Name != "Renamed" {
+		t.Errorf("Directory.Flow after flow-change has name %v, want Renamed", *f.Name)
+	}
+}
+
+func TestDirectory_slowLookup(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "nick": "alice"}]`)
+	})
+	started, release := make(chan bool), make(chan bool)
+	var gets int32
+	mux.HandleFunc("/users/3", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&gets, 1) == 1 {
+			close(started)
+		}
+		<-release
+		fmt.Fprint(w, `{"id": 3, "nick": "carol"}`)
+	})
+
+	d := client.Directory
+	d.User(1)
+
+	nicks := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() { nicks <- d.Nick("3") }()
+	}
+	<-started
+
+	updated := make(chan bool)
+	go func() {
+		name, user, raw := "user-edit", "1", json.RawMessage(`{"user": {"nick": "ally"}}`)
+		d.Update(Message{Event: &name, UserID: &user, RawContent: &raw})
+		close(updated)
+	}()
+	select {
+	case <-updated:
+	case <-time.After(time.Second):
+		t.Fatal("Directory.Update waited for a lookup in progress")
+	}
+	if nick := d.Nick("1"); nick != "ally" {
+		t.Errorf("Directory.Nick during a lookup = %v, want ally", nick)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if nick := <-nicks; nick != "carol" {
+			t.Errorf("Directory.Nick = %v, want carol", nick)
+		}
+	}
+	if n := atomic.LoadInt32(&gets); n != 1 {
+		t.Errorf("user fetched %d times by concurrent lookups, want once", n)
+	}
+}
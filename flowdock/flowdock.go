@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/google/go-querystring/query"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -42,6 +43,19 @@ type Client struct {
 	Users         *UsersService
 	Organizations *OrganizationsService
 	Inbox         *InboxService
+
+	// Directory caches users and flows for lookups by ID or name.
+	Directory *Directory
+
+	// Deliveries tells when created messages are echoed by streams.
+	Deliveries *Deliveries
+
+	// StreamObserver, if set, is told about the health of streams opened
+	// afterwards.
+	StreamObserver StreamObserver
+
+	// Middleware run by Do, see Use.
+	middleware []Middleware
 }
 
 func newClient(httpClient *http.Client, baseURL, streamURL *url.URL) *Client {
@@ -57,13 +71,16 @@ func newClient(httpClient *http.Client, baseURL, streamURL *url.URL) *Client {
 	c.Inbox = &InboxService{client: c}
 	c.Users = &UsersService{client: c}
 	c.Organizations = &OrganizationsService{client: c}
+	c.Directory = newDirectory(c)
+	c.Deliveries = newDeliveries()
 	return c
 }
 
 // NewClient returns a new Flowdock API client. If a nil httpClient is provided,
 // http.DefaultClient will be used.  To use API methods which require
 // authentication, provide an http.Client that will perform the authentication
-// for you (such as that provided by the goauth2 library).
+// for you (such as that provided by the goauth2 library). See New for more
+// options.
 func NewClient(httpClient *http.Client) *Client {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
@@ -92,6 +109,10 @@ func (c *Client) baseRequest(method, urlStr string, baseURL url.URL, body interf
 
 	u := baseURL.ResolveReference(rel)
 
+	if v := reflect.ValueOf(body); v.Kind() == reflect.Ptr && v.IsNil() {
+		body = nil
+	}
+
 	buf := new(bytes.Buffer)
 	if body != nil {
 		err := json.NewEncoder(buf).Encode(body)
@@ -105,6 +126,9 @@ func (c *Client) baseRequest(method, urlStr string, baseURL url.URL, body interf
 		return nil, err
 	}
 
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
 	req.Header.Add("Accept", defaultMediaType)
 	req.Header.Add("User-Agent", c.UserAgent)
 	return req, nil
@@ -128,11 +152,13 @@ func (c *Client) NewStreamRequest(method, urlStr string, body interface{}) (*htt
 	return c.baseRequest(method, urlStr, *c.StreamURL, body)
 }
 
-// Do sends an API request and returns the API response. The API response is
-// decoded and stored in the value pointed to by v, or returned as an error if
-// an API error has occurred.
+// Do sends an API request through the client's middleware and returns the API
+// response. The API response is decoded and stored in the value pointed to by
+// v, or returned as an error if an API error has occurred. If v implements the
+// io.Writer interface, the raw response body will be written to v, without
+// attempting to first decode it.
 func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
-	resp, err := c.client.Do(req)
+	resp, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
@@ -146,7 +172,9 @@ func (c *Client) Do(req *http.Request, v interface{}) (*http.Response, error) {
 		return resp, err
 	}
 
-	if v != nil {
+	if w, ok := v.(io.Writer); ok {
+		_, err = io.Copy(w, resp.Body)
+	} else if v != nil {
 		err = json.NewDecoder(resp.Body).Decode(v)
 	}
 	return resp, err
@@ -182,6 +210,40 @@ func CheckResponse(r *http.Response) error {
 	return errorResponse
 }
 
+// EncodeError is returned by service methods whose URL, options or request
+// body cannot be encoded. No request is sent.
+type EncodeError struct {
+	Method string // HTTP method of the request
+	URL    string // URL of the request, relative to RestURL and without options
+	Err    error  // error encoding the request
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("flowdock: encoding %v %v: %v", e.Method, e.URL, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error { return e.Err }
+
+// call sends a service method's request to the REST API and decodes the
+// response into v, as Do does. The parameters in query, which may be nil,
+// are added to urlStr as by addOptions and body, if not nil, is sent JSON
+// encoded. Errors building the request are returned as an *EncodeError.
+func (c *Client) call(method, urlStr string, query, body, v interface{}) (*http.Response, error) {
+	u := urlStr
+	if query != nil {
+		var err error
+		if u, err = addOptions(urlStr, query); err != nil {
+			return nil, &EncodeError{Method: method, URL: urlStr, Err: err}
+		}
+	}
+
+	req, err := c.NewRequest(method, u, body)
+	if err != nil {
+		return nil, &EncodeError{Method: method, URL: urlStr, Err: err}
+	}
+	return c.Do(req, v)
+}
+
 // addOptions adds the parameters in opt as URL query parameters to s. opt must
 // be a struct whose fields may contain "url" tags.
 func addOptions(s string, opt interface{}) (string, error) {
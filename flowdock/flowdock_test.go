@@ -1,6 +1,8 @@
 package flowdock
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -35,9 +37,7 @@ func setup() {
 	streamServer = httptest.NewServer(mux)
 
 	// flowdock client configured to use test server
-	client = NewClient(nil)
-	client.RestURL, _ = url.Parse(server.URL)
-	client.StreamURL, _ = url.Parse(streamServer.URL)
+	client, _ = New(WithRestURL(server.URL), WithStreamURL(streamServer.URL))
 }
 
 // teardown closes the test HTTP server.
@@ -72,6 +72,26 @@ func testFormValues(t *testing.T, r *http.Request, values values) {
 	}
 }
 
+// testJSONBody checks the request has a JSON body equal to want, and no
+// query string.
+func testJSONBody(t *testing.T, r *http.Request, want string) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Request Content-Type = %q, want application/json", ct)
+	}
+	if r.URL.RawQuery != "" {
+		t.Errorf("Request query = %q, want none", r.URL.RawQuery)
+	}
+
+	var got, wantBody interface{}
+	if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+		t.Fatalf("Request body is not JSON: %v", err)
+	}
+	json.Unmarshal([]byte(want), &wantBody)
+	if !reflect.DeepEqual(got, wantBody) {
+		t.Errorf("Request body = %v, want %v", got, wantBody)
+	}
+}
+
 func TestNewClient(t *testing.T) {
 	c := NewClient(nil)
 
@@ -137,6 +157,83 @@ func testURLParseError(t *testing.T, err error) {
 	}
 }
 
+var errEncode = errors.New("cannot encode")
+
+type failingQuery struct{}
+
+func (failingQuery) EncodeValues(key string, v *url.Values) error { return errEncode }
+
+type failingBody struct{}
+
+func (failingBody) MarshalJSON() ([]byte, error) { return nil, errEncode }
+
+func TestCall(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/org/flow", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PUT")
+		testFormValues(t, r, values{"user": "true"})
+		fmt.Fprint(w, `{"id":"org:flow"}`)
+	})
+
+	flow := new(Flow)
+	_, err := client.call("PUT", "flows/org/flow", &FlowsListOptions{User: true}, nil, flow)
+	if err != nil {
+		t.Fatalf("call returned error: %v", err)
+	}
+	if *flow.Id != "org:flow" {
+		t.Errorf("call decoded %+v", flow)
+	}
+}
+
+func TestCall_encodeErrors(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("call sent %v %v despite an encoding error", r.Method, r.URL)
+	})
+
+	tests := []struct {
+		name       string
+		url        string
+		query      interface{}
+		body       interface{}
+		wantErr    error
+		wantErrMsg string
+	}{
+		{"failing option", "flows", struct {
+			Since failingQuery `url:"since"`
+		}{}, nil, errEncode, "flowdock: encoding POST flows: cannot encode"},
+		{"options not a struct", "flows", 7, nil, nil, "flowdock: encoding POST flows: query: Values() expects struct input. Got int"},
+		{"failing body", "messages", nil, failingBody{}, errEncode, ""},
+		{"unsupported body", "messages", nil, map[string]interface{}{"ch": make(chan int)}, nil, ""},
+		{"bad URL", ":", nil, nil, nil, ""},
+		{"bad URL with options", ":", &FlowsListOptions{}, nil, nil, ""},
+	}
+	for _, tt := range tests {
+		resp, err := client.call("POST", tt.url, tt.query, tt.body, nil)
+		var encodeErr *EncodeError
+		if !errors.As(err, &encodeErr) {
+			t.Errorf("%v: call returned %v, want an *EncodeError", tt.name, err)
+			continue
+		}
+		if resp != nil {
+			t.Errorf("%v: call returned a response", tt.name)
+		}
+		if encodeErr.Method != "POST" || encodeErr.URL != tt.url {
+			t.Errorf("%v: EncodeError is for %v %v, want POST %v", tt.name, encodeErr.Method, encodeErr.URL, tt.url)
+		}
+		if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%v: call returned %v, want it to wrap %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantErrMsg != "" && err.Error() != tt.wantErrMsg {
+			t.Errorf("%v: call returned %q, want %q", tt.name, err, tt.wantErrMsg)
+		}
+	}
+}
+
 func TestDo(t *testing.T) {
 	setup()
 	defer teardown()
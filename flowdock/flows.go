@@ -47,7 +47,7 @@ type FlowsGetOptions struct {
 // FlowsCreateOptions specifies the optional parameters to the
 // FlowsService.Create method.
 type FlowsCreateOptions struct {
-	Name string `url:"name"`
+	Name string `json:"name"`
 }
 
 // Lists the flows that the authenticated user is a member of.
@@ -60,18 +60,8 @@ func (s *FlowsService) List(all bool, opt *FlowsListOptions) ([]Flow, *http.Resp
 		u += "/all"
 	}
 
-	u, err := addOptions(u, opt)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	flows := new([]Flow)
-	resp, err := s.client.Do(req, flows)
+	resp, err := s.client.call("GET", u, opt, nil, flows)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -87,13 +77,8 @@ func (s *FlowsService) List(all bool, opt *FlowsListOptions) ([]Flow, *http.Resp
 func (s *FlowsService) Get(org, flowName string) (*Flow, *http.Response, error) {
 	u := fmt.Sprintf("flows/%v/%v", org, flowName)
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	flow := new(Flow)
-	resp, err := s.client.Do(req, flow)
+	resp, err := s.client.call("GET", u, nil, nil, flow)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -108,18 +93,8 @@ func (s *FlowsService) Get(org, flowName string) (*Flow, *http.Response, error)
 // Flowdock API docs: https://www.flowdock.com/api/flows
 func (s *FlowsService) GetById(id string) (*Flow, *http.Response, error) {
 	u := "flows/find"
-	u, err := addOptions(u, FlowsGetOptions{Id: id})
-	if err != nil {
-		return nil, nil, err
-	}
-
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	flow := new(Flow)
-	resp, err := s.client.Do(req, flow)
+	resp, err := s.client.call("GET", u, FlowsGetOptions{Id: id}, nil, flow)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -132,15 +107,8 @@ func (s *FlowsService) GetById(id string) (*Flow, *http.Response, error) {
 // Flowdock API docs: https://www.flowdock.com/api/flows
 func (s *FlowsService) Create(orgName string, opt *FlowsCreateOptions) (*Flow, *http.Response, error) {
 	u := fmt.Sprintf("flows/%v", orgName)
-
-	u, err := addOptions(u, opt)
-	req, err := s.client.NewRequest("POST", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	flow := new(Flow)
-	resp, err := s.client.Do(req, flow)
+	resp, err := s.client.call("POST", u, nil, opt, flow)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -153,16 +121,11 @@ func (s *FlowsService) Create(orgName string, opt *FlowsCreateOptions) (*Flow, *
 // Flowdock API docs: https://www.flowdock.com/api/flows
 func (s *FlowsService) Update(orgName, flowName string, flow *Flow) (*Flow, *http.Response, error) {
 	u := fmt.Sprintf("flows/%v/%v", orgName, flowName)
-	req, err := s.client.NewRequest("PUT", u, flow)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	flow = new(Flow)
-	resp, err := s.client.Do(req, flow)
+	updated := new(Flow)
+	resp, err := s.client.call("PUT", u, nil, flow, updated)
 	if err != nil {
 		return nil, resp, err
 	}
 
-	return flow, resp, err
+	return updated, resp, err
 }
@@ -111,7 +111,7 @@ func TestFlowsService_Create(t *testing.T) {
 
 	mux.HandleFunc("/flows/org", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "POST")
-		testFormValues(t, r, values{"name": "flow"})
+		testJSONBody(t, r, `{"name":"flow"}`)
 		fmt.Fprint(w, `{"id":"org:flow"}`)
 	})
 
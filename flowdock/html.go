@@ -0,0 +1,348 @@
+package flowdock
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// htmlBlocks are the elements starting a paragraph of their own.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "pre": true, "blockquote": true, "table": true, "hr": true, "dl": true,
+	"section": true, "article": true, "header": true, "footer": true, "address": true, "figure": true,
+}
+
+// htmlText renders an HTML fragment, like the body of a team inbox message,
+// as plain text. Paragraphs are separated by blank lines, list items start
+// with "- " or their number, links are followed by their URL, inline code
+// is quoted with backticks, preformatted text is indented by four spaces
+// and quotes start with "> ". Scripts, styles and comments are dropped.
+//
+// It reads the tags leniently, as mail bodies are rarely valid HTML, and
+// keeps text it cannot make sense of as is.
+func htmlText(s string) string {
+	w := new(textWriter)
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			w.text(s)
+			break
+		}
+		w.text(s[:i])
+		s = s[i:]
+
+		name, attrs, closing, n := parseTag(s)
+		if n == 0 {
+			w.text("<")
+			s = s[1:]
+			continue
+		}
+		s = s[n:]
+		if !closing && (name == "script" || name == "style") {
+			// skip the element's raw text
+			end := strings.Index(strings.ToLower(s), "</"+name)
+			if end < 0 {
+				break
+			}
+			s = s[end:]
+			continue
+		}
+		w.tag(name, attrs, closing)
+	}
+	if w.pre > 0 {
+		w.flushPre() // unclosed <pre>
+	}
+	// keep the indentation of a <pre> at the start
+	return strings.TrimRightFunc(w.b.String(), unicode.IsSpace)
+}
+
+// parseTag parses the tag, comment or declaration at the start of s, which
+// starts with "<". It returns the tag's lowercase name, its attributes,
+// whether it closes an element and its length, or a length of 0 if s does
+// not start with a tag.
+func parseTag(s string) (name string, attrs map[string]string, closing bool, n int) {
+	if strings.HasPrefix(s, "<!--") {
+		end := strings.Index(s[4:], "-->")
+		if end < 0 {
+			return "", nil, false, len(s)
+		}
+		return "", nil, false, 4 + end + 3
+	}
+	i := 1
+	if i < len(s) && (s[i] == '!' || s[i] == '?') {
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return "", nil, false, len(s)
+		}
+		return "", nil, false, end + 1
+	}
+	if i < len(s) && s[i] == '/' {
+		closing = true
+		i++
+	}
+	start := i
+	for i < len(s) && isNameByte(s[i]) {
+		i++
+	}
+	if i == start || i > start && !isLetter(s[start]) {
+		return "", nil, false, 0
+	}
+	name = strings.ToLower(s[start:i])
+
+	attrs = map[string]string{}
+	for {
+		for i < len(s) && (isSpace(s[i]) || s[i] == '/') {
+			i++
+		}
+		if i >= len(s) {
+			return "", nil, false, 0
+		}
+		if s[i] == '>' {
+			return name, attrs, closing, i + 1
+		}
+		start = i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		if i >= len(s) || s[i] != '=' {
+			attrs[key] = ""
+			continue
+		}
+		i++
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return "", nil, false, 0
+			}
+			attrs[key] = html.UnescapeString(s[i+1 : i+1+end])
+			i += end + 2
+			continue
+		}
+		start = i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+			i++
+		}
+		attrs[key] = html.UnescapeString(s[start:i])
+	}
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameByte(c byte) bool {
+	return isLetter(c) || '0' <= c && c <= '9' || c == '-'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// textWriter lays out the text of an HTML fragment. Words are written with
+// a single space between them, and the line breaks due before the next word
+// are only written with it, so that trailing breaks are dropped.
+type textWriter struct {
+	b        strings.Builder
+	breaks   int    // line breaks due before the next word
+	space    bool   // a space is due before the next word
+	quotes   int    // depth of blockquotes
+	lists    []int  // next number of each open list, 0 if unordered
+	bullet   string // marker of the list item starting on the next line
+	pre      int
+	preText  strings.Builder
+	links    []link
+	rowCells int
+}
+
+// flushPre writes the preformatted text read so far, indented by four
+// spaces.
+func (w *textWriter) flushPre() {
+	code := strings.TrimRight(strings.TrimPrefix(w.preText.String(), "\n"), " \t\r\n")
+	w.preText.Reset()
+	for i, line := range strings.Split(code, "\n") {
+		if i > 0 {
+			w.block(1)
+		}
+		w.word(strings.TrimRight("    "+line, " \t\r"))
+	}
+	w.block(2)
+}
+
+// link is an open <a> element.
+type link struct {
+	href  string
+	start int // length of the text written before the link
+}
+
+// block ends the current line and, for paragraphs, leaves a blank line.
+func (w *textWriter) block(lines int) {
+	if w.b.Len() > 0 && lines > w.breaks {
+		w.breaks = lines
+	}
+	w.space = false
+}
+
+// prefix returns the start of the lines inside the current quotes and
+// lists.
+func (w *textWriter) prefix() string {
+	p := strings.Repeat("> ", w.quotes)
+	if len(w.lists) > 1 {
+		p += strings.Repeat("  ", len(w.lists)-1)
+	}
+	return p
+}
+
+// word writes s after the space or line breaks it is due.
+func (w *textWriter) word(s string) {
+	if w.breaks > 0 {
+		quote := strings.TrimRight(strings.Repeat("> ", w.quotes), " ")
+		w.b.WriteString("\n")
+		for i := 1; i < w.breaks; i++ {
+			w.b.WriteString(quote + "\n")
+		}
+		w.breaks = 0
+	}
+	if s := w.b.String(); s == "" || strings.HasSuffix(s, "\n") {
+		w.b.WriteString(w.prefix())
+		if w.bullet != "" {
+			w.b.WriteString(w.bullet)
+			w.bullet = ""
+		} else if len(w.lists) > 0 {
+			w.b.WriteString("  ")
+		}
+	} else if w.space {
+		w.b.WriteString(" ")
+	}
+	w.space = false
+	w.b.WriteString(s)
+}
+
+func (w *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	s = html.UnescapeString(s)
+	if w.pre > 0 {
+		w.preText.WriteString(s)
+		return
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 || strings.TrimLeftFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+	for i, word := range words {
+		if i > 0 {
+			w.space = true
+		}
+		w.word(word)
+	}
+	if len(words) > 0 && strings.TrimRightFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+}
+
+func (w *textWriter) tag(name string, attrs map[string]string, closing bool) {
+	if w.pre > 0 && name != "pre" {
+		if name == "br" {
+			w.preText.WriteString("\n")
+		}
+		return
+	}
+	if closing && (name == "ul" || name == "ol") && len(w.lists) > 0 {
+		w.lists = w.lists[:len(w.lists)-1]
+	}
+	if htmlBlocks[name] {
+		lines := 2
+		if len(w.lists) > 0 {
+			lines = 1 // inside a list item
+		}
+		w.block(lines)
+	}
+
+	switch name {
+	case "br":
+		w.breaks++
+		w.space = false
+	case "tr", "dt", "dd":
+		w.block(1)
+		w.rowCells = 0
+	case "td", "th":
+		if !closing {
+			if w.rowCells > 0 {
+				w.space = true
+				w.word("|")
+				w.space = true
+			}
+			w.rowCells++
+		}
+	case "ul":
+		if !closing {
+			w.lists = append(w.lists, 0)
+		}
+	case "ol":
+		if !closing {
+			w.lists = append(w.lists, 1)
+		}
+	case "li":
+		if closing || len(w.lists) == 0 {
+			break
+		}
+		w.block(1)
+		w.bullet = "- "
+		if n := w.lists[len(w.lists)-1]; n > 0 {
+			w.bullet = strconv.Itoa(n) + ". "
+			w.lists[len(w.lists)-1]++
+		}
+	case "blockquote":
+		if closing && w.quotes > 0 {
+			w.quotes--
+		} else if !closing {
+			w.quotes++
+		}
+	case "pre":
+		if !closing {
+			w.pre++
+			break
+		}
+		if w.pre == 0 {
+			break
+		}
+		w.pre--
+		w.flushPre()
+	case "code", "kbd", "samp", "tt":
+		if closing {
+			w.space = false
+		}
+		w.word("`")
+		w.space = false
+	case "img":
+		if alt := strings.TrimSpace(attrs["alt"]); alt != "" && !closing {
+			w.text(alt)
+		}
+	case "a":
+		if !closing {
+			w.links = append(w.links, link{href: strings.TrimSpace(attrs["href"]), start: w.b.Len()})
+			break
+		}
+		if len(w.links) == 0 {
+			break
+		}
+		l := w.links[len(w.links)-1]
+		w.links = w.links[:len(w.links)-1]
+		text := strings.TrimSpace(w.b.String()[l.start:])
+		if l.href == "" || strings.HasPrefix(l.href, "#") || text == l.href || "mailto:"+text == l.href {
+			break
+		}
+		space := w.space
+		if text == "" {
+			w.word(l.href)
+		} else {
+			w.space = true
+			w.word("(" + l.href + ")")
+		}
+		w.space = space
+	}
+}
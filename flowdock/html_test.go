@@ -0,0 +1,36 @@
+package flowdock
+
+import "testing"
+
+func TestHtmlText(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{"plain  text\n spread  over\tlines", "plain text spread over lines"},
+		{"<p>First</p><p>Second<br>line</p>", "First\n\nSecond\nline"},
+		{"<div>Fish &amp; chips &lt;3&nbsp;</div>", "Fish & chips <3"},
+		{"<b>Build</b> <i>passed</i>, a<b>b</b>c", "Build passed, abc"},
+		{"<ul><li>one</li><li>two<ul><li>nested</li></ul></li></ul>after",
+			"- one\n- two\n  - nested\n\nafter"},
+		{"<ol><li>first<li>second</ol>", "1. first\n2. second"},
+		{`See <a href="https://example.com/build/1">the build</a>.`, "See the build (https://example.com/build/1)."},
+		{`<a href="https://example.com">https://example.com</a> <a href='mailto:a@example.com'>a@example.com</a> <a href="#top">top</a>`,
+			"https://example.com a@example.com top"},
+		{`<a href=https://example.com/logo><img src="logo.png"></a>`, "https://example.com/logo"},
+		{"Run <code>make test</code> first", "Run `make test` first"},
+		{"<p>Log:</p><pre>\n$ make\nok   flowdock  <b>0.2s</b>\n</pre><p>Done</p>",
+			"Log:\n\n    $ make\n    ok   flowdock  0.2s\n\nDone"},
+		{"<pre>code\nline2", "    code\n    line2"},
+		{"<blockquote><p>quoted</p><p>twice</p></blockquote>reply", "> quoted\n>\n> twice\n\nreply"},
+		{"<table><tr><th>App</th><th>Env</th></tr><tr><td>web</td><td>prod</td></tr></table>", "App | Env\nweb | prod"},
+		{"<html><head><style>p { color: red }</style><script>alert('<p>')</script></head><body><!-- hi --><p>Body</p></body></html>", "Body"},
+		{"a < b and <3 <notclosed", "a < b and <3 <notclosed"},
+		{`<img alt="chart" src="c.png"> <IMG ALT='Status: OK'>`, "chart Status: OK"},
+	}
+	for _, tt := range tests {
+		if got := htmlText(tt.html); got != tt.want {
+			t.Errorf("htmlText(%q) = %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
@@ -16,15 +16,15 @@ type InboxService struct {
 // InboxCreateOptions specifies the optional parameters to the
 // InboxCreate method.
 type InboxCreateOptions struct {
-	Source      string   `url:"source,omitempty"`
-	FromAddress string   `url:"from_address,omitempty"`
-	Subject     string   `url:"subject,omitempty"`
-	Content     string   `url:"content,omitempty"`
-	FromName    string   `url:"from_name,omitempty"`
-	ReplyTo     string   `url:"reply_to,omitempty"`
-	Project     string   `url:"project,omitempty"`
-	Tags        []string `url:"tags,comma,omitempty"`
-	Link        string   `url:"link,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	FromAddress string   `json:"from_address,omitempty"`
+	Subject     string   `json:"subject,omitempty"`
+	Content     string   `json:"content,omitempty"`
+	FromName    string   `json:"from_name,omitempty"`
+	ReplyTo     string   `json:"reply_to,omitempty"`
+	Project     string   `json:"project,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Link        string   `json:"link,omitempty"`
 }
 
 // Create an Inbox mail message for the specified flow api token
@@ -32,15 +32,8 @@ type InboxCreateOptions struct {
 // Flowdock API docs: https://www.flowdock.com/api/team-inbox
 func (s *InboxService) Create(flowApiToken string, opt *InboxCreateOptions) (*Message, *http.Response, error) {
 	u := fmt.Sprintf("v1/messages/team_inbox/%v", flowApiToken)
-
-	u, err := addOptions(u, opt)
-	req, err := s.client.NewRequest("POST", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	message := new(Message)
-	resp, err := s.client.Do(req, message)
+	resp, err := s.client.call("POST", u, nil, opt, message)
 	if err != nil {
 		return nil, resp, err
 	}
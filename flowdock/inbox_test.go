@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -13,9 +14,7 @@ func TestInboxService_Create(t *testing.T) {
 
 	mux.HandleFunc("/v1/messages/team_inbox/xxx", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "POST")
-		testFormValues(t, r, values{"subject": "a subject",
-			"content": "Howdy-Doo @Jackie #awesome",
-		})
+		testJSONBody(t, r, `{"subject":"a subject","content":"Howdy-Doo @Jackie #awesome"}`)
 		fmt.Fprint(w, `{}`)
 	})
 
@@ -33,3 +32,26 @@ func TestInboxService_Create(t *testing.T) {
 		t.Errorf("Messages.Create returned \n%+v \nwant \n%+v", message, want)
 	}
 }
+
+func TestInboxService_Create_html(t *testing.T) {
+	setup()
+	defer teardown()
+
+	content := "<table>" + strings.Repeat(`<tr><td class="build">#1024</td><td>passed &amp; deployed</td></tr>`, 2000) + "</table>"
+	mux.HandleFunc("/v1/messages/team_inbox/xxx", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		testJSONBody(t, r, fmt.Sprintf(`{"source":"CI","from_address":"ci@example.com","subject":"Build report","content":%q,"tags":["ci"]}`, content))
+		fmt.Fprint(w, `{}`)
+	})
+
+	opt := InboxCreateOptions{
+		Source:      "CI",
+		FromAddress: "ci@example.com",
+		Subject:     "Build report",
+		Content:     content,
+		Tags:        []string{"ci"},
+	}
+	if _, _, err := client.Inbox.Create("xxx", &opt); err != nil {
+		t.Errorf("Inbox.Create returned error: %v", err)
+	}
+}
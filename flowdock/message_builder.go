@@ -0,0 +1,263 @@
+package flowdock
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxContentLength is the most characters Flowdock accepts in the content
+// of a message.
+const MaxContentLength = 8096
+
+// MessageBuilder builds a chat message or comment in Flowdock-flavoured
+// Markdown. Text passed to its methods is escaped, so it shows as written;
+// Markdown adds content as is. Like Query, each method checks its arguments
+// and the first invalid one is reported by Options.
+//
+//	b := flowdock.NewMessage().FlowByName("acme", "ops").
+//		Bold("Deploy failed").Text(" on ").Link("build 1024", buildURL).Paragraph().
+//		Code("", log).
+//		Mention("alice").Text(" can you take a look?").
+//		Tags("deploy", "prod")
+//	opt, err := b.Options()
+//	message, _, err := client.Messages.Create(opt)
+type MessageBuilder struct {
+	flowID  string
+	parent  int
+	content strings.Builder
+	tags    []string
+	err     error
+}
+
+// NewMessage returns a builder for a message with no content.
+func NewMessage() *MessageBuilder {
+	return new(MessageBuilder)
+}
+
+func (b *MessageBuilder) fail(format string, args ...interface{}) *MessageBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("flowdock: "+format, args...)
+	}
+	return b
+}
+
+// Flow posts the message to the flow with this ID.
+func (b *MessageBuilder) Flow(id string) *MessageBuilder {
+	if id == "" {
+		return b.fail("empty flow ID")
+	}
+	b.flowID = id
+	return b
+}
+
+// FlowByName posts the message to the flow with this parameterized name in
+// the organization.
+func (b *MessageBuilder) FlowByName(org, flow string) *MessageBuilder {
+	if org == "" || flow == "" || strings.Contains(org, ":") {
+		return b.fail("invalid flow %q in organization %q", flow, org)
+	}
+	b.flowID = org + ":" + flow
+	return b
+}
+
+// ReplyTo makes the message a comment on the message with this ID.
+func (b *MessageBuilder) ReplyTo(messageID int) *MessageBuilder {
+	if messageID <= 0 {
+		return b.fail("invalid message ID %d", messageID)
+	}
+	b.parent = messageID
+	return b
+}
+
+// Tags adds tags to the message. A leading "#" is dropped.
+func (b *MessageBuilder) Tags(tags ...string) *MessageBuilder {
+	for _, tag := range tags {
+		tag = strings.TrimPrefix(tag, "#")
+		if err := checkTags([]string{tag}); err != nil {
+			return b.fail("%v", err)
+		}
+		if !contains(b.tags, tag, true) {
+			b.tags = append(b.tags, tag)
+		}
+	}
+	return b
+}
+
+// Text adds plain text.
+func (b *MessageBuilder) Text(s string) *MessageBuilder {
+	b.content.WriteString(escapeMarkdown(s))
+	return b
+}
+
+// Markdown adds s without escaping it.
+func (b *MessageBuilder) Markdown(s string) *MessageBuilder {
+	b.content.WriteString(s)
+	return b
+}
+
+// Bold adds text shown in bold.
+func (b *MessageBuilder) Bold(s string) *MessageBuilder {
+	if s == "" {
+		return b
+	}
+	b.content.WriteString("**" + escapeMarkdown(s) + "**")
+	return b
+}
+
+// Link adds a link to rawURL, an absolute URL, showing text.
+func (b *MessageBuilder) Link(text, rawURL string) *MessageBuilder {
+	u, err := url.Parse(rawURL)
+	if err != nil || !u.IsAbs() {
+		return b.fail("invalid link URL %q", rawURL)
+	}
+	if text == "" {
+		text = rawURL
+	}
+	target := strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(u.String())
+	b.content.WriteString("[" + escapeMarkdown(text) + "](" + target + ")")
+	return b
+}
+
+// Mention adds a mention of the user with this nick, notifying them.
+func (b *MessageBuilder) Mention(nick string) *MessageBuilder {
+	nick = strings.TrimPrefix(nick, "@")
+	if nick == "" || strings.IndexFunc(nick, unicode.IsSpace) >= 0 {
+		return b.fail("invalid nick %q", nick)
+	}
+	b.content.WriteString("@" + nick)
+	return b
+}
+
+// Line ends the current line.
+func (b *MessageBuilder) Line() *MessageBuilder {
+	b.content.WriteString("\n")
+	return b
+}
+
+// Paragraph ends the current paragraph.
+func (b *MessageBuilder) Paragraph() *MessageBuilder {
+	b.block()
+	return b
+}
+
+// Quote adds a block quoting text.
+func (b *MessageBuilder) Quote(text string) *MessageBuilder {
+	b.block()
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" {
+			b.content.WriteString(">\n")
+		} else {
+			b.content.WriteString("> " + escapeMarkdown(line) + "\n")
+		}
+	}
+	b.content.WriteString("\n")
+	return b
+}
+
+// Code adds a fenced block of code, highlighted as language if it is not
+// empty.
+func (b *MessageBuilder) Code(language, code string) *MessageBuilder {
+	if strings.ContainsAny(language, "` \n") {
+		return b.fail("invalid code language %q", language)
+	}
+	// the fence must be longer than any run of backticks in the code
+	fence, run := "```", 0
+	for _, r := range code {
+		if r != '`' {
+			run = 0
+		} else if run++; run >= len(fence) {
+			fence += "`"
+		}
+	}
+	b.block()
+	b.content.WriteString(fence + language + "\n" + strings.TrimRight(code, "\n") + "\n" + fence + "\n\n")
+	return b
+}
+
+// List adds a bulleted list of items.
+func (b *MessageBuilder) List(items ...string) *MessageBuilder {
+	b.block()
+	for _, item := range items {
+		item = strings.ReplaceAll(escapeMarkdown(item), "\n", "\n  ")
+		b.content.WriteString("- " + item + "\n")
+	}
+	b.content.WriteString("\n")
+	return b
+}
+
+// block starts a new paragraph unless the content is empty or already
+// ends one.
+func (b *MessageBuilder) block() {
+	s := b.content.String()
+	switch {
+	case s == "" || strings.HasSuffix(s, "\n\n"):
+	case strings.HasSuffix(s, "\n"):
+		b.content.WriteString("\n")
+	default:
+		b.content.WriteString("\n\n")
+	}
+}
+
+// String returns the content built so far.
+func (b *MessageBuilder) String() string {
+	return strings.TrimRight(b.content.String(), "\n")
+}
+
+// Options returns the parameters of MessagesService.Create for the message,
+// or the first invalid argument given to the builder. The message must have
+// a flow and content of at most MaxContentLength characters.
+func (b *MessageBuilder) Options() (*MessagesCreateOptions, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.flowID == "" {
+		return nil, fmt.Errorf("flowdock: message has no flow")
+	}
+	content := b.String()
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("flowdock: message has no content")
+	}
+	if n := utf8.RuneCountInString(content); n > MaxContentLength {
+		return nil, fmt.Errorf("flowdock: message content has %d characters, over the limit of %d", n, MaxContentLength)
+	}
+
+	opt := &MessagesCreateOptions{
+		FlowID:  b.flowID,
+		Event:   "message",
+		Content: content,
+		Tags:    b.tags,
+	}
+	if b.parent != 0 {
+		opt.Event = "comment"
+		opt.MessageID = b.parent
+	}
+	return opt, nil
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+)
+
+// escapeMarkdown escapes the characters of s that Markdown would format,
+// including those starting a heading or quote at the start of a line.
+func escapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, ">") || isHeading(trimmed) {
+			lines[i] = line[:len(line)-len(trimmed)] + `\` + trimmed
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isHeading reports whether line is a Markdown heading rather than, say, a
+// line starting with a hashtag.
+func isHeading(line string) bool {
+	rest := strings.TrimLeft(line, "#")
+	return rest != line && (rest == "" || rest[0] == ' ')
+}
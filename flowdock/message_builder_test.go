@@ -0,0 +1,123 @@
+package flowdock
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	b := NewMessage().FlowByName("acme", "ops").
+		Bold("Deploy failed").Text(" on ").Link("build #1024", "https://ci.example.com/builds/1024").Paragraph().
+		Quote("error: exit status 1\n\nrolled back").
+		Code("go", "fmt.Println(`hi`)\n").
+		List("web_1", "worker [2]").
+		Mention("@alice").Text(" can you *look*?").
+		Tags("#deploy", "prod", "Deploy")
+
+	opt, err := b.Options()
+	if err != nil {
+		t.Fatalf("Options returned error: %v", err)
+	}
+	content := "**Deploy failed** on [build #1024](https://ci.example.com/builds/1024)\n\n" +
+		"> error: exit status 1\n>\n> rolled back\n\n" +
+		"```go\nfmt.Println(`hi`)\n```\n\n" +
+		"- web\\_1\n- worker \\[2\\]\n\n" +
+		"@alice can you \\*look\\*?"
+	want := &MessagesCreateOptions{
+		FlowID:  "acme:ops",
+		Event:   "message",
+		Content: content,
+		Tags:    []string{"deploy", "prod"},
+	}
+	if !reflect.DeepEqual(opt, want) {
+		t.Errorf("Options returned\n%+v\nwant\n%+v", opt, want)
+	}
+}
+
+func TestMessageBuilder_reply(t *testing.T) {
+	opt, err := NewMessage().Flow("0a1b2c").ReplyTo(42).Text("+1").Options()
+	if err != nil {
+		t.Fatalf("Options returned error: %v", err)
+	}
+	want := &MessagesCreateOptions{FlowID: "0a1b2c", Event: "comment", MessageID: 42, Content: "+1"}
+	if !reflect.DeepEqual(opt, want) {
+		t.Errorf("Options returned %+v, want %+v", opt, want)
+	}
+}
+
+func TestMessageBuilder_Code_fence(t *testing.T) {
+	code := "Use ``` to start a block, or ````."
+	got := NewMessage().Text("Markdown:").Code("", code).String()
+	want := "Markdown:\n\n`````\n" + code + "\n`````"
+	if got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := map[string]string{
+		"snake_case *and* [links]": `snake\_case \*and\* \[links\]`,
+		"# Heading\n## also":       "\\# Heading\n\\## also",
+		"#deploy tag":              "#deploy tag",
+		"> not a quote":            `\> not a quote`,
+		`C:\path`:                  `C:\\path`,
+		"`code`":                   "\\`code\\`",
+	}
+	for in, want := range tests {
+		if got := escapeMarkdown(in); got != want {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMessageBuilder_invalid(t *testing.T) {
+	tests := map[string]*MessageBuilder{
+		"no flow":        NewMessage().Text("hi"),
+		"empty flow":     NewMessage().Flow("").Text("hi"),
+		"bad flow name":  NewMessage().FlowByName("acme", "").Text("hi"),
+		"no content":     NewMessage().Flow("f").Line(),
+		"bad parent":     NewMessage().Flow("f").ReplyTo(0).Text("hi"),
+		"bad tag":        NewMessage().Flow("f").Text("hi").Tags("two words"),
+		"bad link":       NewMessage().Flow("f").Link("docs", "/relative"),
+		"bad nick":       NewMessage().Flow("f").Mention("@"),
+		"bad language":   NewMessage().Flow("f").Code("go lang", "x"),
+		"content length": NewMessage().Flow("f").Text(strings.Repeat("é", MaxContentLength+1)),
+	}
+	for name, b := range tests {
+		if opt, err := b.Options(); err == nil {
+			t.Errorf("%v: Options returned %+v, want an error", name, opt)
+		}
+	}
+
+	// exactly the limit, counted in characters rather than bytes
+	if _, err := NewMessage().Flow("f").Text(strings.Repeat("é", MaxContentLength)).Options(); err != nil {
+		t.Errorf("Options returned error for content at the limit: %v", err)
+	}
+}
+
+func TestMessagesService_Create_builder(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		testJSONBody(t, r, `{"flow":"org:flow","event":"comment","message":7,"content":"**done**","tags":["ops"],"uuid":"u1"}`)
+		fmt.Fprint(w, `{"id":8}`)
+	})
+
+	opt, err := NewMessage().FlowByName("org", "flow").ReplyTo(7).Bold("done").Tags("ops").Options()
+	if err != nil {
+		t.Fatalf("Options returned error: %v", err)
+	}
+	opt.UUID = "u1"
+	message, _, err := client.Messages.Create(opt)
+	if err != nil {
+		t.Fatalf("Messages.Create returned error: %v", err)
+	}
+	if *message.ID != 8 {
+		t.Errorf("Messages.Create returned %+v", message)
+	}
+}
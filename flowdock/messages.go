@@ -1,10 +1,20 @@
 package flowdock
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/bernerdschaefer/eventsource"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -28,33 +38,103 @@ type MessagesListOptions struct {
 	Search  string   `url:"search,omitempty"`
 }
 
+// StreamOptions specifies the optional parameters to the
+// MessagesService.StreamFlows method.
+type StreamOptions struct {
+	// Filter lists the flows to follow as "org/flow" names.
+	Filter []string `url:"filter,comma,omitempty"`
+
+	// User includes private messages to the authenticated user.
+	User bool `url:"user,int,omitempty"`
+
+	// Active sets the user's presence while streaming: "true" for active,
+	// "idle", or empty to not change it.
+	Active string `url:"active,omitempty"`
+}
+
 // Stream the messages for the given flow.
 //
 // Flowdock API docs: https://flowdock.com/api/streaming and
 // https://www.flowdock.com/api/messages
 func (s *MessagesService) Stream(token, org, flow string) (chan Message, *eventsource.EventSource, error) {
-	retryDuration := 3 * time.Second
-
 	u := fmt.Sprintf("flows/%v/%v?access_token=%v", org, flow, token)
+	return s.stream(u, org+"/"+flow)
+}
+
+// StreamFlows streams the messages of several flows over one connection.
+//
+// Flowdock API docs: https://flowdock.com/api/streaming
+func (s *MessagesService) StreamFlows(token string, opt *StreamOptions) (chan Message, *eventsource.EventSource, error) {
+	u, err := addOptions("flows", opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	name := "all"
+	if opt != nil && len(opt.Filter) > 0 {
+		name = strings.Join(opt.Filter, ",")
+	}
+	return s.stream(u+sep+"access_token="+url.QueryEscape(token), name)
+}
+
+// stream follows the event stream at u. The channel is closed once the
+// EventSource is closed. Events that are not messages are dropped and
+// reported to the client's StreamObserver as decode errors.
+func (s *MessagesService) stream(u, name string) (chan Message, *eventsource.EventSource, error) {
+	retryDuration := 3 * time.Second
 
 	req, err := s.client.NewStreamRequest("GET", u, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	obs := s.client.StreamObserver
+	if obs != nil {
+		// the EventSource sends the request again to reconnect
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GetConn:              func(string) { obs.StreamState(name, StreamConnecting) },
+			GotFirstResponseByte: func() { obs.StreamState(name, StreamConnected) },
+		}))
+	}
 
 	messageCh := make(chan Message)
 	es := eventsource.New(req, retryDuration)
 
 	go func() {
+		defer close(messageCh)
 		for {
 			event, err := es.Read()
-
 			if err != nil {
-				// TODO panic or add error channel!
+				// Read fails once the EventSource is closed, or for good when
+				// the server answers with a status other than 200 or 5xx or
+				// with another content type than an event stream
+				if obs != nil {
+					if err != eventsource.ErrClosed {
+						obs.StreamError(name, err)
+					}
+					obs.StreamState(name, StreamClosed)
+				}
+				return
 			}
 
 			m := new(Message)
-			err = json.Unmarshal([]byte(event.Data), m)
+			if err := json.Unmarshal([]byte(event.Data), m); err != nil {
+				if obs != nil {
+					obs.StreamDecodeError(name, err)
+				}
+				continue
+			}
+			if obs != nil {
+				var lag time.Duration
+				if m.Sent != nil {
+					lag = time.Since(m.Sent.Time)
+				}
+				obs.StreamMessage(name, *m, lag)
+			}
+			s.client.Directory.Update(*m)
+			s.client.Deliveries.Update(*m)
 			messageCh <- *m
 		}
 	}()
@@ -62,24 +142,28 @@ func (s *MessagesService) Stream(token, org, flow string) (chan Message, *events
 	return messageCh, es, err
 }
 
-// Lists the messages for the given flow.
+// Get a single message.
 //
 // Flowdock API docs: https://www.flowdock.com/api/messages
-func (s *MessagesService) List(org, flow string, opt *MessagesListOptions) ([]Message, *http.Response, error) {
-	u := fmt.Sprintf("flows/%v/%v/messages", org, flow)
-
-	u, err := addOptions(u, opt)
+func (s *MessagesService) Get(org, flow string, id int) (*Message, *http.Response, error) {
+	u := fmt.Sprintf("flows/%v/%v/messages/%v", org, flow, id)
+	message := new(Message)
+	resp, err := s.client.call("GET", u, nil, nil, message)
 	if err != nil {
-		return nil, nil, err
+		return nil, resp, err
 	}
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
+	return message, resp, err
+}
+
+// Lists the messages for the given flow.
+//
+// Flowdock API docs: https://www.flowdock.com/api/messages
+func (s *MessagesService) List(org, flow string, opt *MessagesListOptions) ([]Message, *http.Response, error) {
+	u := fmt.Sprintf("flows/%v/%v/messages", org, flow)
 
 	messages := new([]Message)
-	resp, err := s.client.Do(req, messages)
+	resp, err := s.client.call("GET", u, opt, nil, messages)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -90,32 +174,49 @@ func (s *MessagesService) List(org, flow string, opt *MessagesListOptions) ([]Me
 // MessagesCreateOptions specifies the optional parameters to the
 // MessageService.Create method.
 type MessagesCreateOptions struct {
-	FlowID           string   `url:"flow,omitempty"`
-	MessageID        int      `url:"message,omitempty"`
-	Event            string   `url:"event,omitempty"`
-	Content          string   `url:"content,omitempty"`
-	Tags             []string `url:"tags,comma,omitempty"`
-	UUID             string   `url:"uuid,omitempty"`
-	ExternalUserName string   `url:"external_user_name,omitempty"`
-	Subject          string   `url:"subject,omitempty"`
-	FromAddress      string   `url:"from_address,omitempty"`
-	Source           string   `url:"source,omitempty"`
-}
-
-// Create a comment for the specified organization
+	FlowID           string   `json:"flow,omitempty"`
+	MessageID        int      `json:"message,omitempty"`
+	Event            string   `json:"event,omitempty"`
+	Content          string   `json:"content,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	UUID             string   `json:"uuid,omitempty"`
+	ExternalUserName string   `json:"external_user_name,omitempty"`
+	Subject          string   `json:"subject,omitempty"`
+	FromAddress      string   `json:"from_address,omitempty"`
+	Source           string   `json:"source,omitempty"`
+}
+
+// Create a comment for the specified organization. Like Create, it assigns
+// opt a UUID if it has none.
 //
 // Flowdock API docs: https://www.flowdock.com/api/messages
 func (s *MessagesService) CreateComment(opt *MessagesCreateOptions) (*Message, *http.Response, error) {
-	u := "comments"
+	return s.create("comments", opt)
+}
 
-	u, err := addOptions(u, opt)
-	req, err := s.client.NewRequest("POST", u, nil)
-	if err != nil {
-		return nil, nil, err
+// Create a message for the specified organization.
+//
+// If opt has no UUID, a new one is assigned to it, and sending opt again
+// repeats it. Streams echo the UUID, so client.Deliveries tells when the
+// message arrived. The API does not document whether it drops a message
+// resent with a UUID it has seen, so Retry only resends it after a 429.
+//
+// Flowdock API docs: https://www.flowdock.com/api/messages
+func (s *MessagesService) Create(opt *MessagesCreateOptions) (*Message, *http.Response, error) {
+	return s.create("messages", opt)
+}
+
+func (s *MessagesService) create(u string, opt *MessagesCreateOptions) (*Message, *http.Response, error) {
+	if opt == nil {
+		opt = new(MessagesCreateOptions)
+	}
+	if opt.UUID == "" {
+		opt.UUID = NewUUID()
 	}
+	s.client.Deliveries.add(opt.UUID)
 
 	message := new(Message)
-	resp, err := s.client.Do(req, message)
+	resp, err := s.client.call("POST", u, nil, opt, message)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -123,17 +224,68 @@ func (s *MessagesService) CreateComment(opt *MessagesCreateOptions) (*Message, *
 	return message, resp, err
 }
 
-// Create a message for the specified organization
+// MessagesUploadOptions specifies the parameters to the
+// MessagesService.Upload method.
+type MessagesUploadOptions struct {
+	// FileName is the name the file is shown with.
+	FileName string
+
+	// ContentType defaults to the type registered for FileName's extension,
+	// or application/octet-stream.
+	ContentType string
+
+	Tags []string
+	UUID string
+}
+
+// Upload a file to the flow, posting it as a message with the "file" event.
+// A nil opt uploads the file with no name, tags or UUID.
 //
 // Flowdock API docs: https://www.flowdock.com/api/messages
-func (s *MessagesService) Create(opt *MessagesCreateOptions) (*Message, *http.Response, error) {
-	u := "messages"
+func (s *MessagesService) Upload(org, flow string, file io.Reader, opt *MessagesUploadOptions) (*Message, *http.Response, error) {
+	u := fmt.Sprintf("flows/%v/%v/messages", org, flow)
+	if opt == nil {
+		opt = new(MessagesUploadOptions)
+	}
+
+	contentType := opt.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(opt.FileName))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	mw.WriteField("event", "file")
+	if len(opt.Tags) > 0 {
+		mw.WriteField("tags", strings.Join(opt.Tags, ","))
+	}
+	if opt.UUID != "" {
+		mw.WriteField("uuid", opt.UUID)
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="content"; filename="%v"`, escapeQuotes(opt.FileName)))
+	h.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
 
-	u, err := addOptions(u, opt)
 	req, err := s.client.NewRequest("POST", u, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Body = ioutil.NopCloser(body)
+	req.ContentLength = int64(body.Len())
 
 	message := new(Message)
 	resp, err := s.client.Do(req, message)
@@ -144,6 +296,24 @@ func (s *MessagesService) Create(opt *MessagesCreateOptions) (*Message, *http.Re
 	return message, resp, err
 }
 
+// Download the file of a "file" message, writing it to w. path is the
+// FileContent.Path of the message, or of its thumbnail.
+//
+// Flowdock API docs: https://www.flowdock.com/api/messages
+func (s *MessagesService) Download(path string, w io.Writer) (*http.Response, error) {
+	req, err := s.client.NewRequest("GET", strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "*/*")
+
+	return s.client.Do(req, w)
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(s)
+}
+
 // Message represents a Flowdock chat message.
 type Message struct {
 	ID               *int             `json:"id,omitempty"`
@@ -170,6 +340,10 @@ func (m *Message) Content() (content Content) {
 		content = &CommentContent{}
 	case "vcs":
 		content = &VcsContent{}
+	case "mail":
+		content = &MailContent{}
+	case "file":
+		content = &FileContent{}
 	default:
 		content = new(JsonContent)
 	}
@@ -2,6 +2,8 @@ package flowdock
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // Content should be implemented by any value that is parsed into
@@ -47,55 +49,492 @@ type CommentContent struct {
 
 // Return the string version of a CommentContent
 //
-// It returns the *CommentContent.Text
+// It returns the *CommentContent.Text, or "" if the comment has none.
 func (c *CommentContent) String() string {
+	if c.Text == nil {
+		return ""
+	}
 	return *c.Text
 }
 
-// VCS (i.e. Github)
+// VcsContent represents a Message's Content when Message.Event is "vcs": the
+// payload of a GitHub webhook, with Event set to the name of the webhook's
+// event, such as "push" or "pull_request". Which fields are set depends on
+// the event.
 type VcsContent struct {
-	Issue struct {
-		Url *string `json:"url"`
-	} `json:"issue,omitempty"`
-	PullRequest struct {
-		Url *string `json:"url"`
-	} `json:"pull_request,omitempty"`
-	Pusher struct {
-		Name *string `json:"name"`
-	} `json:"pusher,omitempty"`
-	Sender struct {
-		Login *string `json:"login"`
-	} `json:"sender,omitempty"`
-	Repository struct {
-		Name *string `json:"name"`
-	} `json:"repository,omitempty"`
-	Event      *string `json:"event,omitempty"`
-	CompareUrl *string `json:"compare,omitempty"`
+	Event      *string       `json:"event,omitempty"`
+	Action     *string       `json:"action,omitempty"`
+	Repository VcsRepository `json:"repository,omitempty"`
+	Sender     VcsUser       `json:"sender,omitempty"`
+
+	// push events
+	Ref        *string     `json:"ref,omitempty"`
+	Before     *string     `json:"before,omitempty"`
+	After      *string     `json:"after,omitempty"`
+	Created    *bool       `json:"created,omitempty"`
+	Deleted    *bool       `json:"deleted,omitempty"`
+	Forced     *bool       `json:"forced,omitempty"`
+	CompareUrl *string     `json:"compare,omitempty"`
+	Pusher     VcsUser     `json:"pusher,omitempty"`
+	Commits    []VcsCommit `json:"commits,omitempty"`
+	HeadCommit *VcsCommit  `json:"head_commit,omitempty"`
+
+	// issues, pull_request, issue_comment, pull_request_review and
+	// pull_request_review_comment events
+	Issue       VcsIssue       `json:"issue,omitempty"`
+	PullRequest VcsPullRequest `json:"pull_request,omitempty"`
+	Comment     *VcsComment    `json:"comment,omitempty"`
+	Review      *VcsReview     `json:"review,omitempty"`
+
+	// status events
+	Sha         *string `json:"sha,omitempty"`
+	State       *string `json:"state,omitempty"`
+	Description *string `json:"description,omitempty"`
+	TargetUrl   *string `json:"target_url,omitempty"`
+	Context     *string `json:"context,omitempty"`
+
+	// check_run and check_suite events
+	CheckRun   *VcsCheck `json:"check_run,omitempty"`
+	CheckSuite *VcsCheck `json:"check_suite,omitempty"`
+}
+
+// VcsRepository is the repository of a VcsContent.
+type VcsRepository struct {
+	Name     *string `json:"name"`
+	FullName *string `json:"full_name,omitempty"`
+	Url      *string `json:"url,omitempty"`
+	HtmlUrl  *string `json:"html_url,omitempty"`
+}
+
+// VcsUser is a GitHub account, identified by Login, or the author of a
+// commit, identified by Name, Email and, if it has one, the Username of
+// their account.
+type VcsUser struct {
+	Login    *string `json:"login,omitempty"`
+	Name     *string `json:"name,omitempty"`
+	Email    *string `json:"email,omitempty"`
+	Username *string `json:"username,omitempty"`
+}
+
+// Return the string version of a VcsUser
+//
+// It returns the first of Login, Username and Name that is set.
+func (u *VcsUser) String() string {
+	for _, s := range []*string{u.Login, u.Username, u.Name} {
+		if s != nil && *s != "" {
+			return *s
+		}
+	}
+	return ""
+}
+
+// VcsCommit is a commit pushed.
+type VcsCommit struct {
+	Id        *string  `json:"id"`
+	Message   *string  `json:"message"`
+	Url       *string  `json:"url,omitempty"`
+	Timestamp *string  `json:"timestamp,omitempty"`
+	Author    VcsUser  `json:"author,omitempty"`
+	Committer VcsUser  `json:"committer,omitempty"`
+	Distinct  *bool    `json:"distinct,omitempty"`
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	Modified  []string `json:"modified,omitempty"`
+}
+
+// ShortId returns the first seven characters of the commit's ID.
+func (c *VcsCommit) ShortId() string {
+	return shortSha(deref(c.Id))
+}
+
+// Title returns the first line of the commit's message.
+func (c *VcsCommit) Title() string {
+	title, _, _ := strings.Cut(deref(c.Message), "\n")
+	return strings.TrimSpace(title)
+}
+
+// Return the string version of a VcsCommit
+//
+// It returns the short ID, title and author of the commit, like
+// "3c4d5e6 Fix the login form (alice)".
+func (c *VcsCommit) String() string {
+	s := strings.TrimSpace(c.ShortId() + " " + c.Title())
+	if author := c.Author.String(); author != "" {
+		s += " (" + author + ")"
+	}
+	return s
+}
+
+// VcsIssue is the issue of a VcsContent.
+type VcsIssue struct {
+	Url     *string `json:"url"`
+	HtmlUrl *string `json:"html_url,omitempty"`
+	Number  *int    `json:"number,omitempty"`
+	Title   *string `json:"title,omitempty"`
+	State   *string `json:"state,omitempty"`
+	Body    *string `json:"body,omitempty"`
+	User    VcsUser `json:"user,omitempty"`
+}
+
+// VcsPullRequest is the pull request of a VcsContent.
+type VcsPullRequest struct {
+	VcsIssue
+	Draft    *bool   `json:"draft,omitempty"`
+	Merged   *bool   `json:"merged,omitempty"`
+	MergedBy VcsUser `json:"merged_by,omitempty"`
+	Head     VcsRef  `json:"head,omitempty"`
+	Base     VcsRef  `json:"base,omitempty"`
+}
+
+// VcsRef is the branch a pull request merges from, its head, or into, its
+// base.
+type VcsRef struct {
+	Label *string `json:"label,omitempty"`
+	Ref   *string `json:"ref,omitempty"`
+	Sha   *string `json:"sha,omitempty"`
+}
+
+// VcsComment is a comment on an issue, or on the changes of a pull request.
+type VcsComment struct {
+	Url     *string `json:"url"`
+	HtmlUrl *string `json:"html_url,omitempty"`
+	Body    *string `json:"body,omitempty"`
+	Path    *string `json:"path,omitempty"`
+	User    VcsUser `json:"user,omitempty"`
+}
+
+// VcsReview is a review of a pull request. Its State is "approved",
+// "changes_requested" or "commented".
+type VcsReview struct {
+	HtmlUrl *string `json:"html_url,omitempty"`
+	Body    *string `json:"body,omitempty"`
+	State   *string `json:"state,omitempty"`
+	User    VcsUser `json:"user,omitempty"`
+}
+
+// VcsCheck is a check run, or a suite of them. Its Conclusion, such as
+// "success" or "failure", is set once its Status is "completed".
+type VcsCheck struct {
+	Name       *string `json:"name,omitempty"`
+	Status     *string `json:"status,omitempty"`
+	Conclusion *string `json:"conclusion,omitempty"`
+	HeadSha    *string `json:"head_sha,omitempty"`
+	HtmlUrl    *string `json:"html_url,omitempty"`
+}
+
+// vcsActions reads actions of pull requests and issues that are not verbs.
+var vcsActions = map[string]string{
+	"synchronize":        "pushed to",
+	"review_requested":   "requested a review of",
+	"ready_for_review":   "marked as ready",
+	"converted_to_draft": "converted to a draft",
 }
 
 // Return the string version of a VcsContent
 //
-// It returns the *CommentContent.Text
+// It returns the repository, event, user and URL of the event, like
+// "web: push by alice https://github.com/acme/web/compare/1a2b...3c4d".
 func (c *VcsContent) String() string {
-	var user, url string
-	event := *c.Event
-	name := *c.Repository.Name
-
-	if c.Pusher.Name != nil {
-		user = *c.Pusher.Name
-	} else if c.Sender.Login != nil {
-		user = *c.Sender.Login
-	} else {
+	user := c.user()
+	if user == "" {
 		user = "Unknown"
 	}
+	return fmt.Sprintf("%s: %s by %s %s", deref(c.Repository.Name), deref(c.Event), user, c.Url())
+}
+
+// Branch returns the branch pushed to, or "" if the push was not to a
+// branch.
+func (c *VcsContent) Branch() string {
+	if branch, ok := strings.CutPrefix(deref(c.Ref), "refs/heads/"); ok {
+		return branch
+	}
+	return ""
+}
+
+// Tag returns the tag pushed, or "" if the push was not of a tag.
+func (c *VcsContent) Tag() string {
+	if tag, ok := strings.CutPrefix(deref(c.Ref), "refs/tags/"); ok {
+		return tag
+	}
+	return ""
+}
+
+// Url returns the page best showing the event: the comparison of a push,
+// the comment, review or check, or else the pull request or issue.
+func (c *VcsContent) Url() string {
+	var urls []*string
+	switch {
+	case c.Comment != nil:
+		urls = append(urls, c.Comment.HtmlUrl, c.Comment.Url)
+	case c.Review != nil:
+		urls = append(urls, c.Review.HtmlUrl)
+	case c.CheckRun != nil:
+		urls = append(urls, c.CheckRun.HtmlUrl)
+	}
+	urls = append(urls, c.CompareUrl, c.TargetUrl,
+		c.PullRequest.HtmlUrl, c.PullRequest.Url, c.Issue.HtmlUrl, c.Issue.Url)
+	for _, u := range urls {
+		if u != nil && *u != "" {
+			return *u
+		}
+	}
+	return ""
+}
+
+// Summary returns a line describing the event, like "alice pushed 2 commits
+// to branch main in web" or "bob merged pull request 12 in web: Add
+// metrics". Events it does not know are described as by String.
+func (c *VcsContent) Summary() string {
+	user, repo := c.user(), deref(c.Repository.Name)
+	switch deref(c.Event) {
+	case "push":
+		ref := deref(c.Ref)
+		switch {
+		case c.Branch() != "":
+			ref = "branch " + c.Branch()
+		case c.Tag() != "":
+			ref = "tag " + c.Tag()
+		case ref == "":
+			ref = "an unknown ref"
+		}
+		switch {
+		case isTrue(c.Deleted):
+			return fmt.Sprintf("%s deleted %s in %s", user, ref, repo)
+		case isTrue(c.Created):
+			return fmt.Sprintf("%s created %s in %s", user, ref, repo)
+		}
+		verb := "pushed"
+		if isTrue(c.Forced) {
+			verb = "force-pushed"
+		}
+		return fmt.Sprintf("%s %s %s to %s in %s", user, verb, plural(len(c.Commits), "commit"), ref, repo)
+	case "pull_request":
+		action := deref(c.Action)
+		if action == "closed" && isTrue(c.PullRequest.Merged) {
+			action = "merged"
+		}
+		return c.issueSummary(action, "pull request", &c.PullRequest.VcsIssue)
+	case "issues":
+		return c.issueSummary(deref(c.Action), "issue", &c.Issue)
+	case "issue_comment":
+		return c.issueSummary("commented on", "issue", &c.Issue)
+	case "pull_request_review_comment":
+		return c.issueSummary("commented on", "pull request", &c.PullRequest.VcsIssue)
+	case "pull_request_review":
+		verb := "reviewed"
+		if c.Review != nil {
+			switch deref(c.Review.State) {
+			case "approved":
+				verb = "approved"
+			case "changes_requested":
+				verb = "requested changes to"
+			}
+		}
+		return c.issueSummary(verb, "pull request", &c.PullRequest.VcsIssue)
+	case "status":
+		s := fmt.Sprintf("%s %s for %s in %s", deref(c.Context), deref(c.State), shortSha(deref(c.Sha)), repo)
+		if c.Description != nil && *c.Description != "" {
+			s += ": " + *c.Description
+		}
+		return s
+	case "check_run", "check_suite":
+		check, name := c.CheckRun, "check suite"
+		if check == nil {
+			check = c.CheckSuite
+		} else {
+			name = "check " + deref(check.Name)
+		}
+		if check == nil {
+			break
+		}
+		result := deref(check.Conclusion)
+		if result == "" {
+			result = strings.ReplaceAll(deref(check.Status), "_", " ")
+		}
+		return fmt.Sprintf("%s %s for %s in %s", name, result, shortSha(deref(check.HeadSha)), repo)
+	}
+	return c.String()
+}
+
+// Details returns the Summary of the event followed, in paragraphs, by the
+// commits pushed, one per line, the comment or review made, and the Url.
+func (c *VcsContent) Details() string {
+	paragraphs := []string{c.Summary()}
+	if len(c.Commits) > 0 && !isTrue(c.Deleted) {
+		commits := make([]string, len(c.Commits))
+		for i := range c.Commits {
+			commits[i] = "- " + c.Commits[i].String()
+		}
+		paragraphs = append(paragraphs, strings.Join(commits, "\n"))
+	}
+	var body *string
+	if c.Comment != nil {
+		body = c.Comment.Body
+	} else if c.Review != nil {
+		body = c.Review.Body
+	}
+	if b := strings.TrimSpace(deref(body)); b != "" {
+		paragraphs = append(paragraphs, b)
+	}
+	if u := c.Url(); u != "" {
+		paragraphs = append(paragraphs, u)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// user returns who caused the event: the pusher of a push, else the sender.
+func (c *VcsContent) user() string {
+	if user := c.Pusher.String(); user != "" {
+		return user
+	}
+	return c.Sender.String()
+}
+
+func (c *VcsContent) issueSummary(action, kind string, issue *VcsIssue) string {
+	if action == "" {
+		action = deref(issue.State)
+	}
+	if verb, ok := vcsActions[action]; ok {
+		action = verb
+	}
+	var number string
+	if issue.Number != nil {
+		// "#12" would tag the message
+		number = " " + strconv.Itoa(*issue.Number)
+	}
+	s := fmt.Sprintf("%s %s %s%s in %s", c.user(), action, kind, number, deref(c.Repository.Name))
+	if issue.Title != nil {
+		s += ": " + *issue.Title
+	}
+	return s
+}
+
+// deref returns *s, or "" if s is nil.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// MailContent represents a Message's Content when Message.Event is "mail":
+// a message to the team inbox of a flow, as posted by InboxService.Create.
+type MailContent struct {
+	Source  *string       `json:"source"`
+	Subject *string       `json:"subject"`
+	From    []MailAddress `json:"from,omitempty"`
+	To      []MailAddress `json:"to,omitempty"`
+	ReplyTo *string       `json:"reply_to,omitempty"`
+	Project *string       `json:"project,omitempty"`
+	Link    *string       `json:"link,omitempty"`
+
+	// Content is the HTML body of the message.
+	Content *string `json:"content"`
+}
+
+// MailAddress is a sender or recipient of a MailContent.
+type MailAddress struct {
+	Address *string `json:"address"`
+	Name    *string `json:"name,omitempty"`
+}
 
-	if c.CompareUrl != nil {
-		url = *c.CompareUrl
-	} else if c.PullRequest.Url != nil {
-		url = *c.PullRequest.Url
-	} else if c.Issue.Url != nil {
-		url = *c.Issue.Url
+// Return the string version of a MailAddress
+//
+// It returns the name and address, like "Alice <alice@example.com>", or
+// whichever of them is set.
+func (a *MailAddress) String() string {
+	name, address := deref(a.Name), deref(a.Address)
+	switch {
+	case name == "":
+		return address
+	case address == "":
+		return name
+	}
+	return name + " <" + address + ">"
+}
+
+// FromAddress returns the address of the first sender.
+func (c *MailContent) FromAddress() string {
+	if len(c.From) == 0 {
+		return ""
 	}
+	return deref(c.From[0].Address)
+}
 
-	return fmt.Sprintf("%s: %s by %s %s", name, event, user, url)
+// Text returns the HTML body rendered as plain text: paragraphs separated
+// by blank lines, list items starting with "- " or their number, links
+// followed by their URL and code indented.
+func (c *MailContent) Text() string {
+	return htmlText(deref(c.Content))
+}
+
+// Return the string version of a MailContent
+//
+// It returns the subject, sender, source and link of the message as mail
+// headers, followed by a blank line and the body as Text.
+func (c *MailContent) String() string {
+	var b strings.Builder
+	header := func(name, value string) {
+		if value != "" {
+			b.WriteString(name + ": " + value + "\n")
+		}
+	}
+	header("Subject", deref(c.Subject))
+	if len(c.From) > 0 {
+		header("From", c.From[0].String())
+	}
+	header("Source", deref(c.Source))
+	header("Project", deref(c.Project))
+	header("Link", deref(c.Link))
+	if text := c.Text(); text != "" {
+		b.WriteString("\n" + text)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// FileContent represents a Message's Content when Message.Event is "file"
+type FileContent struct {
+	FileName    *string `json:"file_name"`
+	ContentType *string `json:"content_type"`
+	FileSize    *int64  `json:"file_size"`
+
+	// Path of the file, relative to the REST API URL
+	Path  *string `json:"path"`
+	Image *struct {
+		Width  *int `json:"width"`
+		Height *int `json:"height"`
+	} `json:"image,omitempty"`
+	Thumbnail *struct {
+		Path   *string `json:"path"`
+		Width  *int    `json:"width"`
+		Height *int    `json:"height"`
+	} `json:"thumbnail,omitempty"`
+}
+
+// Return the string version of a FileContent
+//
+// It returns the *FileContent.FileName
+func (c *FileContent) String() string {
+	if c.FileName == nil {
+		return ""
+	}
+	return *c.FileName
 }
@@ -0,0 +1,163 @@
+package flowdock
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func vcsMessage(t *testing.T, content string) *VcsContent {
+	raw := json.RawMessage(content)
+	event := "vcs"
+	m := &Message{Event: &event, RawContent: &raw}
+	vcs, ok := m.Content().(*VcsContent)
+	if !ok {
+		t.Fatalf("Content of a vcs message is %T", m.Content())
+	}
+	return vcs
+}
+
+func TestVcsContent_Summary(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"event": "push", "ref": "refs/heads/main", "pusher": {"name": "alice"}, "repository": {"name": "web"},
+			"commits": [{"id": "3c4d5e6f"}, {"id": "9e8d7c6b"}]}`,
+			"alice pushed 2 commits to branch main in web"},
+		{`{"event": "push", "ref": "refs/heads/main", "forced": true, "pusher": {"name": "alice"}, "repository": {"name": "web"},
+			"commits": [{"id": "3c4d5e6f"}]}`,
+			"alice force-pushed 1 commit to branch main in web"},
+		{`{"event": "push", "ref": "refs/tags/v1.2", "created": true, "sender": {"login": "alice"}, "repository": {"name": "web"}}`,
+			"alice created tag v1.2 in web"},
+		{`{"event": "push", "ref": "refs/heads/old", "deleted": true, "pusher": {"name": "alice"}, "repository": {"name": "web"}}`,
+			"alice deleted branch old in web"},
+		{`{"event": "push", "ref": "refs/notes/commits", "pusher": {"name": "alice"}, "repository": {"name": "web"},
+			"commits": [{"id": "3c4d5e6f"}]}`,
+			"alice pushed 1 commit to refs/notes/commits in web"},
+		{`{"event": "push", "pusher": {"name": "alice"}, "repository": {"name": "web"}, "commits": []}`,
+			"alice pushed 0 commits to an unknown ref in web"},
+		{`{"event": "pull_request", "action": "closed", "sender": {"login": "bob"}, "repository": {"name": "web"},
+			"pull_request": {"number": 12, "title": "Add metrics", "merged": true}}`,
+			"bob merged pull request 12 in web: Add metrics"},
+		{`{"event": "pull_request", "action": "synchronize", "sender": {"login": "bob"}, "repository": {"name": "web"},
+			"pull_request": {"number": 12, "title": "Add metrics"}}`,
+			"bob pushed to pull request 12 in web: Add metrics"},
+		{`{"event": "issues", "action": "opened", "sender": {"login": "carol"}, "repository": {"name": "web"},
+			"issue": {"number": 7, "title": "Login is slow"}}`,
+			"carol opened issue 7 in web: Login is slow"},
+		{`{"event": "issue_comment", "action": "created", "sender": {"login": "dave"}, "repository": {"name": "web"},
+			"issue": {"number": 7, "title": "Login is slow"}, "comment": {"body": "Me too"}}`,
+			"dave commented on issue 7 in web: Login is slow"},
+		{`{"event": "pull_request_review", "action": "submitted", "sender": {"login": "erin"}, "repository": {"name": "web"},
+			"pull_request": {"number": 12, "title": "Add metrics"}, "review": {"state": "changes_requested"}}`,
+			"erin requested changes to pull request 12 in web: Add metrics"},
+		{`{"event": "pull_request_review_comment", "action": "created", "sender": {"login": "erin"}, "repository": {"name": "web"},
+			"pull_request": {"number": 12, "title": "Add metrics"}, "comment": {"body": "Typo", "path": "main.go"}}`,
+			"erin commented on pull request 12 in web: Add metrics"},
+		{`{"event": "status", "sha": "3c4d5e6f7a8b", "state": "failure", "context": "ci/build",
+			"description": "2 tests failed", "repository": {"name": "web"}}`,
+			"ci/build failure for 3c4d5e6 in web: 2 tests failed"},
+		{`{"event": "check_run", "action": "created", "repository": {"name": "web"},
+			"check_run": {"name": "lint", "status": "in_progress", "head_sha": "3c4d5e6f7a8b"}}`,
+			"check lint in progress for 3c4d5e6 in web"},
+		{`{"event": "check_suite", "action": "completed", "repository": {"name": "web"},
+			"check_suite": {"status": "completed", "conclusion": "success", "head_sha": "3c4d5e6f7a8b"}}`,
+			"check suite success for 3c4d5e6 in web"},
+		{`{"event": "fork", "sender": {"login": "frank"}, "repository": {"name": "web"}}`,
+			"web: fork by frank "},
+	}
+	for _, tt := range tests {
+		if got := vcsMessage(t, tt.content).Summary(); got != tt.want {
+			t.Errorf("Summary() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestVcsContent_Details(t *testing.T) {
+	push := vcsMessage(t, `{
+		"event": "push",
+		"ref": "refs/heads/main",
+		"compare": "https://github.com/acme/web/compare/1a2b...3c4d",
+		"pusher": {"name": "alice"},
+		"repository": {"name": "web"},
+		"commits": [
+			{"id": "3c4d5e6f7a8b", "message": "Fix the login form\n\nIt lost the password.", "author": {"name": "Alice", "username": "alice"}},
+			{"id": "9e8d7c6b5a4f", "message": "Update dependencies", "author": {"name": "Bob"}}
+		]
+	}`)
+	want := "alice pushed 2 commits to branch main in web\n\n" +
+		"- 3c4d5e6 Fix the login form (alice)\n- 9e8d7c6 Update dependencies (Bob)\n\n" +
+		"https://github.com/acme/web/compare/1a2b...3c4d"
+	if got := push.Details(); got != want {
+		t.Errorf("Details() = %q, want %q", got, want)
+	}
+	if push.Branch() != "main" || push.Tag() != "" {
+		t.Errorf("Branch() = %q and Tag() = %q, want main and none", push.Branch(), push.Tag())
+	}
+
+	review := vcsMessage(t, `{
+		"event": "pull_request_review",
+		"sender": {"login": "erin"},
+		"repository": {"name": "web"},
+		"pull_request": {"number": 12, "title": "Add metrics", "html_url": "https://github.com/acme/web/pull/12"},
+		"review": {"state": "approved", "body": "Looks good ", "html_url": "https://github.com/acme/web/pull/12#pullrequestreview-1"}
+	}`)
+	want = "erin approved pull request 12 in web: Add metrics\n\n" +
+		"Looks good\n\n" +
+		"https://github.com/acme/web/pull/12#pullrequestreview-1"
+	if got := review.Details(); got != want {
+		t.Errorf("Details() = %q, want %q", got, want)
+	}
+}
+
+func TestVcsContent_String(t *testing.T) {
+	vcs := vcsMessage(t, `{"event": "pull_request", "sender": {"login": "bob"}, "repository": {"name": "web"},
+		"pull_request": {"url": "https://api.github.com/repos/acme/web/pulls/12"}}`)
+	if got, want := vcs.String(), "web: pull_request by bob https://api.github.com/repos/acme/web/pulls/12"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	empty := new(VcsContent)
+	if got, want := empty.String(), ":  by Unknown "; got != want {
+		t.Errorf("String() of an empty VcsContent = %q, want %q", got, want)
+	}
+	if got := empty.Summary(); got != empty.String() {
+		t.Errorf("Summary() of an empty VcsContent = %q", got)
+	}
+}
+
+func TestMailContent(t *testing.T) {
+	raw := json.RawMessage(`{
+		"source": "CI",
+		"subject": "Build 1024 passed",
+		"from": [{"address": "ci@example.com", "name": "CI Bot"}],
+		"link": "https://ci.example.com/1024",
+		"content": "<p>All tests passed on <code>main</code>:</p><ul><li>unit</li><li><a href=\"https://ci.example.com/1024/e2e\">e2e</a></li></ul>"
+	}`)
+	event := "mail"
+	m := &Message{Event: &event, RawContent: &raw}
+	mail, ok := m.Content().(*MailContent)
+	if !ok {
+		t.Fatalf("Content of a mail message is %T", m.Content())
+	}
+	if mail.FromAddress() != "ci@example.com" || *mail.Source != "CI" {
+		t.Errorf("FromAddress() = %q and Source = %q", mail.FromAddress(), *mail.Source)
+	}
+
+	want := "Subject: Build 1024 passed\n" +
+		"From: CI Bot <ci@example.com>\n" +
+		"Source: CI\n" +
+		"Link: https://ci.example.com/1024\n" +
+		"\n" +
+		"All tests passed on `main`:\n" +
+		"\n" +
+		"- unit\n" +
+		"- e2e (https://ci.example.com/1024/e2e)"
+	if got := mail.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if got, want := new(MailContent).String(), ""; got != want {
+		t.Errorf("String() of an empty MailContent = %q, want %q", got, want)
+	}
+}
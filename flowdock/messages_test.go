@@ -1,10 +1,15 @@
 package flowdock
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMessagesService_Stream(t *testing.T) {
@@ -46,6 +51,142 @@ func TestMessagesService_Stream(t *testing.T) {
 	}
 }
 
+func TestMessagesService_StreamFlows(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		testFormValues(t, r, values{"access_token": "token", "filter": "org/one,org/two", "user": "1"})
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 1\ndata: {\"event\":\"message\",\"flow\":\"two\",\"content\":\"hi\"}\n\n")
+		w.(responseWriter).Flush()
+		<-r.Context().Done()
+	})
+
+	opt := &StreamOptions{Filter: []string{"org/one", "org/two"}, User: true}
+	stream, es, err := client.Messages.StreamFlows("token", opt)
+	if err != nil {
+		t.Fatalf("Messages.StreamFlows returned error: %v", err)
+	}
+	defer es.Close()
+
+	msg := <-stream
+	if *msg.FlowID != "two" || msg.Content().String() != "hi" {
+		t.Errorf("Messages.StreamFlows sent %+v", msg)
+	}
+}
+
+// recordingObserver records the calls of a StreamObserver.
+type recordingObserver struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (o *recordingObserver) record(call string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.calls = append(o.calls, call)
+}
+
+func (o *recordingObserver) StreamState(stream string, state StreamState) {
+	o.record(stream + " " + state.String())
+}
+
+func (o *recordingObserver) StreamMessage(stream string, m Message, lag time.Duration) {
+	o.record(stream + " message " + m.Content().String())
+}
+
+func (o *recordingObserver) StreamDecodeError(stream string, err error) {
+	o.record(stream + " decode error")
+}
+
+func (o *recordingObserver) StreamError(stream string, err error) {
+	o.record(stream + " error")
+}
+
+func TestMessagesService_Stream_observer(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: not json\n\n")
+		fmt.Fprint(w, "id: 1\ndata: {\"event\":\"message\",\"content\":\"hi\"}\n\n")
+		w.(responseWriter).Flush()
+		<-r.Context().Done()
+	})
+
+	obs := new(recordingObserver)
+	client.StreamObserver = obs
+	stream, es, err := client.Messages.StreamFlows("token", &StreamOptions{Filter: []string{"org/a", "org/b"}})
+	if err != nil {
+		t.Fatalf("Messages.StreamFlows returned error: %v", err)
+	}
+	if msg := <-stream; msg.Content().String() != "hi" {
+		t.Errorf("Messages.StreamFlows sent %+v", msg)
+	}
+	es.Close()
+	if _, ok := <-stream; ok {
+		t.Error("stream sent a message after the EventSource was closed")
+	}
+
+	want := []string{
+		"org/a,org/b connecting",
+		"org/a,org/b connected",
+		"org/a,org/b decode error",
+		"org/a,org/b message hi",
+		"org/a,org/b closed",
+	}
+	if !reflect.DeepEqual(obs.calls, want) {
+		t.Errorf("observer was called with %q, want %q", obs.calls, want)
+	}
+}
+
+func TestMessagesService_Stream_observerError(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+
+	obs := new(recordingObserver)
+	client.StreamObserver = obs
+	stream, es, err := client.Messages.StreamFlows("revoked", &StreamOptions{Filter: []string{"org/a"}})
+	if err != nil {
+		t.Fatalf("Messages.StreamFlows returned error: %v", err)
+	}
+	defer es.Close()
+	if _, ok := <-stream; ok {
+		t.Error("stream sent a message after the server rejected the token")
+	}
+
+	want := []string{"org/a connecting", "org/a connected", "org/a error", "org/a closed"}
+	if !reflect.DeepEqual(obs.calls, want) {
+		t.Errorf("observer was called with %q, want %q", obs.calls, want)
+	}
+}
+
+func TestMessagesService_Get(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/org/flow/messages/45590", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"id":45590,"event":"message","content":"Hello World"}`)
+	})
+
+	message, _, err := client.Messages.Get("org", "flow", 45590)
+	if err != nil {
+		t.Errorf("Messages.Get returned error: %v", err)
+	}
+
+	if *message.ID != 45590 || message.Content().String() != "Hello World" {
+		t.Errorf("Messages.Get returned %+v", message)
+	}
+}
+
 func TestMessagesService_List(t *testing.T) {
 	setup()
 	defer teardown()
@@ -121,9 +262,7 @@ func TestMessagesService_Create_message(t *testing.T) {
 
 	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "POST")
-		testFormValues(t, r, values{"event": "message",
-			"content": "Howdy-Doo @Jackie #awesome",
-		})
+		testJSONBody(t, r, `{"event":"message","content":"Howdy-Doo @Jackie #awesome","uuid":"u1"}`)
 		fmt.Fprint(w, `{
 			"event": "message",
 			"content": "Howdy-Doo @Jackie #awesome"
@@ -133,6 +272,7 @@ func TestMessagesService_Create_message(t *testing.T) {
 	opt := MessagesCreateOptions{
 		Event:   "message",
 		Content: "Howdy-Doo @Jackie #awesome",
+		UUID:    "u1",
 	}
 	message, _, err := client.Messages.Create(&opt)
 	if err != nil {
@@ -148,15 +288,30 @@ func TestMessagesService_Create_message(t *testing.T) {
 	}
 }
 
+func TestMessagesService_Create_longContent(t *testing.T) {
+	setup()
+	defer teardown()
+
+	content := strings.Repeat("All work and no play makes Jack a dull boy. ", 2000)
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		testJSONBody(t, r, fmt.Sprintf(`{"flow":"org:flow","event":"message","content":%q,"tags":["a","b c"],"uuid":"u1"}`, content))
+		fmt.Fprint(w, `{}`)
+	})
+
+	opt := MessagesCreateOptions{FlowID: "org:flow", Event: "message", Content: content, Tags: []string{"a", "b c"}, UUID: "u1"}
+	if _, _, err := client.Messages.Create(&opt); err != nil {
+		t.Errorf("Messages.Create returned error: %v", err)
+	}
+}
+
 func TestMessagesService_Create_comment(t *testing.T) {
 	setup()
 	defer teardown()
 
 	mux.HandleFunc("/comments", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "POST")
-		testFormValues(t, r, values{"event": "comment",
-			"content": "This is a comment",
-		})
+		testJSONBody(t, r, `{"event":"comment","content":"This is a comment","uuid":"u1"}`)
 		fmt.Fprint(w, `{
 			"event": "comment",
 			"content":{ "title":"Title of parent", "text":"This is a comment" }
@@ -166,6 +321,7 @@ func TestMessagesService_Create_comment(t *testing.T) {
 	opt := MessagesCreateOptions{
 		Event:   "comment",
 		Content: "This is a comment",
+		UUID:    "u1",
 	}
 	message, _, err := client.Messages.CreateComment(&opt)
 	if err != nil {
@@ -185,6 +341,81 @@ func TestMessagesService_Create_comment(t *testing.T) {
 	}
 }
 
+func TestMessagesService_Upload(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/org/flow/messages", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		file, header, err := r.FormFile("content")
+		if err != nil {
+			t.Fatalf("no file in request: %v", err)
+		}
+		data, _ := ioutil.ReadAll(file)
+		if header.Filename != "build.log" || header.Header.Get("Content-Type") != "text/plain" || string(data) != "ok\n" {
+			t.Errorf("uploaded %v (%v): %q", header.Filename, header.Header.Get("Content-Type"), data)
+		}
+		if r.FormValue("event") != "file" || r.FormValue("tags") != "ci,build" {
+			t.Errorf("Request parameters = %v", r.MultipartForm.Value)
+		}
+		fmt.Fprint(w, `{
+			"id": 1,
+			"event": "file",
+			"content": {"file_name": "build.log", "content_type": "text/plain", "file_size": 3, "path": "/flows/org/flow/files/1/build.log"}
+		}`)
+	})
+
+	opt := &MessagesUploadOptions{FileName: "build.log", ContentType: "text/plain", Tags: []string{"ci", "build"}}
+	message, _, err := client.Messages.Upload("org", "flow", strings.NewReader("ok\n"), opt)
+	if err != nil {
+		t.Fatalf("Messages.Upload returned error: %v", err)
+	}
+
+	content, ok := message.Content().(*FileContent)
+	if !ok {
+		t.Fatalf("Messages.Upload returned content %T, want *FileContent", message.Content())
+	}
+	if content.String() != "build.log" || *content.Path != "/flows/org/flow/files/1/build.log" {
+		t.Errorf("Messages.Upload returned %+v", content)
+	}
+}
+
+func TestMessagesService_Upload_nilOptions(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/org/flow/messages", func(w http.ResponseWriter, r *http.Request) {
+		// without a file name the file is an ordinary form value
+		if got := r.FormValue("content"); got != "ok\n" {
+			t.Errorf("uploaded %q, want %q", got, "ok\n")
+		}
+		fmt.Fprint(w, `{"id": 1, "event": "file", "content": {}}`)
+	})
+
+	if _, _, err := client.Messages.Upload("org", "flow", strings.NewReader("ok\n"), nil); err != nil {
+		t.Errorf("Messages.Upload returned error: %v", err)
+	}
+}
+
+func TestMessagesService_Download(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/org/flow/files/1/build.log", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, "ok\n")
+	})
+
+	var buf bytes.Buffer
+	_, err := client.Messages.Download("/flows/org/flow/files/1/build.log", &buf)
+	if err != nil {
+		t.Fatalf("Messages.Download returned error: %v", err)
+	}
+	if buf.String() != "ok\n" {
+		t.Errorf("Messages.Download wrote %q, want %q", buf.String(), "ok\n")
+	}
+}
+
 func TestCommentContent_String(t *testing.T) {
 	title := "Title of parent"
 	text := "This is a comment"
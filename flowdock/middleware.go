@@ -0,0 +1,223 @@
+package flowdock
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoundTripFunc sends a request and returns its response, like
+// http.Client.Do.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of requests by Client.Do. It may change the
+// request before calling next, and observe or replace what next returns.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use adds middleware run by Do around every API request. The first
+// middleware added is the outermost: it sees the request first and the
+// response last. Event streams opened by MessagesService are not sent
+// through Do and skip the middleware.
+//
+// Use is not safe to call while requests are being sent.
+func (c *Client) Use(mw ...Middleware) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// send runs req through the middleware to the HTTP client.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	next := RoundTripFunc(c.client.Do)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		next = c.middleware[i](next)
+	}
+	return next(req)
+}
+
+// BeforeRequest returns middleware calling fn with each request before it
+// is sent.
+func BeforeRequest(fn func(req *http.Request)) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			fn(req)
+			return next(req)
+		}
+	}
+}
+
+// AfterResponse returns middleware calling fn with each request and its
+// response, or the error sending it, and how long it took. The response
+// body has not been read yet.
+func AfterResponse(fn func(req *http.Request, resp *http.Response, err error, d time.Duration)) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			fn(req, resp, err, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+// Logging returns middleware logging each request to logger, with its
+// method, route, redacted URL, status and duration. Failed requests are
+// logged at the warning level, others at the debug level. Put it after
+// Tracing to log the trace IDs.
+func Logging(logger *slog.Logger) Middleware {
+	return AfterResponse(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		level := slog.LevelDebug
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("route", Route(req)),
+			slog.String("url", RedactURL(req.URL)),
+			slog.Duration("duration", d),
+		}
+		if resp != nil {
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+			if resp.StatusCode >= 400 {
+				level = slog.LevelWarn
+			}
+		}
+		if err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", redactError(err, req.URL)))
+		}
+		if tp, ok := ParseTraceParent(req.Header.Get(traceParentHeader)); ok {
+			attrs = append(attrs, slog.String("trace_id", tp.TraceID), slog.String("span_id", tp.SpanID))
+		}
+		logger.LogAttrs(req.Context(), level, "flowdock request", attrs...)
+	})
+}
+
+// EndpointStats summarizes the requests sent to one route.
+type EndpointStats struct {
+	Route    string
+	Requests int
+	Errors   int // network errors and 4xx or 5xx responses
+	Total    time.Duration
+	Max      time.Duration
+}
+
+// Mean returns the average duration of the requests.
+func (s EndpointStats) Mean() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Requests)
+}
+
+// Latency records the number, errors and durations of requests by route.
+// The zero value is ready to use.
+type Latency struct {
+	mu    sync.Mutex
+	stats map[string]*EndpointStats
+}
+
+// Middleware returns middleware recording every request to l.
+func (l *Latency) Middleware() Middleware {
+	return AfterResponse(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		route := Route(req)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.stats == nil {
+			l.stats = make(map[string]*EndpointStats)
+		}
+		s, ok := l.stats[route]
+		if !ok {
+			s = &EndpointStats{Route: route}
+			l.stats[route] = s
+		}
+		s.Requests++
+		if err != nil || resp.StatusCode >= 400 {
+			s.Errors++
+		}
+		s.Total += d
+		if d > s.Max {
+			s.Max = d
+		}
+	})
+}
+
+// Stats returns the statistics recorded so far, sorted by route.
+func (l *Latency) Stats() []EndpointStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make([]EndpointStats, 0, len(l.stats))
+	for _, s := range l.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+	return stats
+}
+
+// routeParams names the path segments following each collection of the
+// API, so Route can replace them.
+var routeParams = map[string][]string{
+	"flows":         {":org", ":flow"},
+	"organizations": {":org"},
+	"users":         {":id"},
+	"messages":      {":id"},
+	"comments":      {":id"},
+	"threads":       {":id"},
+	"files":         {":id", ":name"},
+	"private":       {":user"},
+	"team_inbox":    {":token"},
+}
+
+// routeLiterals are path segments that are never parameters.
+var routeLiterals = map[string]bool{"all": true, "find": true}
+
+// Route names the endpoint a request is sent to, with the names of flows
+// and organizations, IDs and tokens in its path replaced by parameters, as
+// in "GET /flows/:org/:flow/messages". It keeps metrics and logs of
+// different flows under one name.
+func Route(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i := 0; i < len(segments); i++ {
+		params := routeParams[segments[i]]
+		for j := 0; j < len(params) && i+1 < len(segments); j++ {
+			next := segments[i+1]
+			if routeLiterals[next] || routeParams[next] != nil {
+				break
+			}
+			i++
+			segments[i] = params[j]
+		}
+	}
+	return req.Method + " /" + strings.Join(segments, "/")
+}
+
+// redactedParams lists the query parameters holding tokens.
+var redactedParams = []string{"access_token", "token", "flow_token"}
+
+// RedactURL returns u as a string with the tokens it may carry, in its user
+// info, query or the path of a team inbox, replaced by REDACTED.
+func RedactURL(u *url.URL) string {
+	r := *u
+	if r.User != nil {
+		r.User = url.User("REDACTED")
+	}
+	if r.RawQuery != "" {
+		q := r.Query()
+		for _, p := range redactedParams {
+			if q.Has(p) {
+				q.Set(p, "REDACTED")
+			}
+		}
+		r.RawQuery = q.Encode()
+	}
+	if i := strings.Index(r.Path, "/team_inbox/"); i >= 0 {
+		r.Path = r.Path[:i] + "/team_inbox/REDACTED"
+		r.RawPath = ""
+	}
+	return r.String()
+}
+
+// redactError returns the message of err with the URL of the request, as
+// included by url.Error, redacted.
+func redactError(err error, u *url.URL) string {
+	return strings.ReplaceAll(err.Error(), u.String(), RedactURL(u))
+}
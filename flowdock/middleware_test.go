@@ -0,0 +1,155 @@
+package flowdock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Use(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Order"); got != "ab" {
+			t.Errorf("X-Order header = %q, want ab", got)
+		}
+		fmt.Fprint(w, `[]`)
+	})
+
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" before")
+				req.Header.Set("X-Order", req.Header.Get("X-Order")+name)
+				resp, err := next(req)
+				order = append(order, name+" after")
+				return resp, err
+			}
+		}
+	}
+	var status int
+	client.Use(mark("a"), mark("b"), AfterResponse(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		status = resp.StatusCode
+	}))
+
+	if _, _, err := client.Flows.List(false, nil); err != nil {
+		t.Fatalf("Flows.List returned error: %v", err)
+	}
+	want := []string{"a before", "b before", "b after", "a after"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("middleware ran in order %v, want %v", order, want)
+	}
+	if status != http.StatusOK {
+		t.Errorf("AfterResponse saw status %v, want 200", status)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/flows/org/flow/messages", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not found", http.StatusNotFound)
+	})
+
+	var buf bytes.Buffer
+	client.RestURL, _ = url.Parse(strings.Replace(server.URL, "http://", "http://secret-token@", 1))
+	client.Use(Tracing(), Logging(slog.New(slog.NewJSONHandler(&buf, nil))))
+	client.Messages.List("org", "flow", &MessagesListOptions{Search: "deploy"})
+
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("log contains the token: %s", buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log is not one JSON entry: %v: %s", err, buf.String())
+	}
+	for k, want := range map[string]interface{}{
+		"level":  "WARN",
+		"method": "GET",
+		"route":  "GET /flows/:org/:flow/messages",
+		"status": float64(404),
+	} {
+		if entry[k] != want {
+			t.Errorf("log entry has %v %v, want %v", k, entry[k], want)
+		}
+	}
+	if id, _ := entry["trace_id"].(string); len(id) != 32 {
+		t.Errorf("log entry has trace_id %q", id)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/users/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+
+	var l Latency
+	client.Use(l.Middleware())
+	client.Users.Get(1)
+	client.Users.Get(2)
+	client.Organizations.All()
+
+	stats := l.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("Stats returned %+v, want 2 routes", stats)
+	}
+	if s := stats[1]; s.Route != "GET /users/:id" || s.Requests != 2 || s.Errors != 1 || s.Max == 0 || s.Mean() > s.Max {
+		t.Errorf("Stats for users = %+v", s)
+	}
+	if s := stats[0]; s.Route != "GET /organizations" || s.Requests != 1 {
+		t.Errorf("Stats for organizations = %+v", s)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	tests := map[string]string{
+		"flows?users=0":                         "GET /flows",
+		"flows/all":                             "GET /flows/all",
+		"flows/find?id=abc":                     "GET /flows/find",
+		"flows/acme":                            "GET /flows/:org",
+		"flows/acme/main":                       "GET /flows/:org/:flow",
+		"flows/acme/main/messages/12":           "GET /flows/:org/:flow/messages/:id",
+		"flows/acme/main/messages/12/comments":  "GET /flows/:org/:flow/messages/:id/comments",
+		"flows/acme/main/users":                 "GET /flows/:org/:flow/users",
+		"flows/acme/main/files/3/a%20b.png":     "GET /flows/:org/:flow/files/:id/:name",
+		"organizations/find?id=3":               "GET /organizations/find",
+		"organizations/acme":                    "GET /organizations/:org",
+		"users/7":                               "GET /users/:id",
+		"private/7/messages":                    "GET /private/:user/messages",
+		"v1/messages/team_inbox/0123456789abcd": "GET /v1/messages/team_inbox/:token",
+	}
+	for path, want := range tests {
+		req, _ := http.NewRequest("GET", "https://api.flowdock.com/"+path, nil)
+		if got := Route(req); got != want {
+			t.Errorf("Route(%v) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := map[string]string{
+		"https://secret@api.flowdock.com/flows":                  "https://REDACTED@api.flowdock.com/flows",
+		"https://stream.flowdock.com/flows/a/b?access_token=abc": "https://stream.flowdock.com/flows/a/b?access_token=REDACTED",
+		"https://api.flowdock.com/v1/messages/team_inbox/abc":    "https://api.flowdock.com/v1/messages/team_inbox/REDACTED",
+		"https://api.flowdock.com/flows?users=0":                 "https://api.flowdock.com/flows?users=0",
+	}
+	for raw, want := range tests {
+		u, _ := url.Parse(raw)
+		if got := RedactURL(u); got != want {
+			t.Errorf("RedactURL(%v) = %v, want %v", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package flowdock
+
+import "time"
+
+// StreamState is the connection state of a stream opened by MessagesService.
+type StreamState int
+
+const (
+	// StreamConnecting means the stream is sending its request, at first or
+	// to reconnect after losing the connection.
+	StreamConnecting StreamState = iota
+
+	// StreamConnected means the server answered the stream's request.
+	StreamConnected
+
+	// StreamClosed means the EventSource was closed. The stream sends no
+	// more messages.
+	StreamClosed
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamConnecting:
+		return "connecting"
+	case StreamConnected:
+		return "connected"
+	case StreamClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// StreamObserver is told about the health of the streams opened by
+// MessagesService, to export metrics or log reconnections. Streams are named
+// after the flows they follow: "org/flow", a comma-separated filter, or
+// "all". Methods are called from the streams' goroutines and must not block.
+type StreamObserver interface {
+	// StreamState reports a change of connection state. A stream going
+	// back to StreamConnecting after StreamConnected is reconnecting.
+	StreamState(stream string, state StreamState)
+
+	// StreamMessage reports a message received, with the time since it was
+	// sent, or 0 if the message has no sent time.
+	StreamMessage(stream string, m Message, lag time.Duration)
+
+	// StreamDecodeError reports an event that could not be decoded as a
+	// message. The event is dropped.
+	StreamDecodeError(stream string, err error)
+
+	// StreamError reports why a stream stopped for good, such as the server
+	// rejecting a revoked token, just before StreamClosed. Streams stopped
+	// by closing their EventSource report no error.
+	StreamError(stream string, err error)
+}
@@ -0,0 +1,192 @@
+package flowdock
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option configures a Client built by New.
+type Option func(*options) error
+
+type options struct {
+	httpClient *http.Client
+	transport  http.RoundTripper
+	timeout    time.Duration
+	restURL    *url.URL
+	streamURL  *url.URL
+	token      string
+	userAgent  string
+	retry      *RetryPolicy
+	logger     *slog.Logger
+}
+
+// New returns a Flowdock API client configured by opts. Without options it
+// is the same as NewClient(nil). It returns an error for the first invalid
+// option.
+//
+//	client, err := flowdock.New(
+//		flowdock.WithToken(os.Getenv("FLOWDOCK_TOKEN")),
+//		flowdock.WithTimeout(30*time.Second),
+//		flowdock.WithRetry(flowdock.DefaultRetryPolicy),
+//	)
+func New(opts ...Option) (*Client, error) {
+	o := &options{httpClient: http.DefaultClient}
+	o.restURL, _ = url.Parse(defaultRestURL)
+	o.streamURL, _ = url.Parse(defaultStreamURL)
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, fmt.Errorf("flowdock: %v", err)
+		}
+	}
+
+	httpClient := o.httpClient
+	if o.transport != nil || o.timeout != 0 {
+		// never change the caller's client
+		c := *httpClient
+		if o.transport != nil {
+			c.Transport = o.transport
+		}
+		if o.timeout != 0 {
+			c.Timeout = o.timeout
+		}
+		httpClient = &c
+	}
+	if o.token != "" {
+		o.restURL.User = url.User(o.token)
+		o.streamURL.User = url.User(o.token)
+	}
+
+	c := newClient(httpClient, o.restURL, o.streamURL)
+	if o.userAgent != "" {
+		c.UserAgent += " " + o.userAgent
+	}
+	if o.retry != nil {
+		c.Use(Retry(*o.retry))
+	}
+	if o.logger != nil {
+		c.Use(Logging(o.logger))
+	}
+	return c, nil
+}
+
+// WithHTTPClient sends requests with httpClient instead of
+// http.DefaultClient, for example one from the auth package.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) error {
+		if httpClient == nil {
+			return fmt.Errorf("nil HTTP client")
+		}
+		o.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithTransport sends requests through transport, such as an
+// httpcache.Transport or a recorder.Recorder. It replaces the transport of
+// the HTTP client without changing it.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) error {
+		if transport == nil {
+			return fmt.Errorf("nil transport")
+		}
+		o.transport = transport
+		return nil
+	}
+}
+
+// WithTimeout limits the time a REST request may take, including reading
+// the response body. It does not apply to streams.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid timeout %v", d)
+		}
+		o.timeout = d
+		return nil
+	}
+}
+
+// WithRestURL sends REST requests to the API at rawURL instead of
+// https://api.flowdock.com/, for a self-hosted or fake server.
+func WithRestURL(rawURL string) Option {
+	return func(o *options) (err error) {
+		o.restURL, err = parseBaseURL("REST", rawURL)
+		return err
+	}
+}
+
+// WithStreamURL opens streams at rawURL instead of
+// https://stream.flowdock.com/.
+func WithStreamURL(rawURL string) Option {
+	return func(o *options) (err error) {
+		o.streamURL, err = parseBaseURL("stream", rawURL)
+		return err
+	}
+}
+
+// WithToken authenticates with a personal API token, like
+// NewClientWithToken.
+func WithToken(token string) Option {
+	return func(o *options) error {
+		if token == "" || strings.TrimSpace(token) != token {
+			return fmt.Errorf("invalid token")
+		}
+		o.token = token
+		return nil
+	}
+}
+
+// WithUserAgent appends suffix, such as "dashboard/1.2", to the User-Agent
+// header of requests.
+func WithUserAgent(suffix string) Option {
+	return func(o *options) error {
+		if suffix == "" || strings.ContainsAny(suffix, "\r\n") {
+			return fmt.Errorf("invalid user agent %q", suffix)
+		}
+		o.userAgent = suffix
+		return nil
+	}
+}
+
+// WithRetry retries failed requests as described by p, see Retry.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) error {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		o.retry = &p
+		return nil
+	}
+}
+
+// WithLogger logs every request to logger, see Logging. When retrying, each
+// attempt is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) error {
+		if logger == nil {
+			return fmt.Errorf("nil logger")
+		}
+		o.logger = logger
+		return nil
+	}
+}
+
+// parseBaseURL parses an absolute http or https URL, adding the trailing
+// slash relative request URLs are resolved against.
+func parseBaseURL(name, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v URL: %v", name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid %v URL %q: want an absolute http or https URL", name, rawURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u, nil
+}
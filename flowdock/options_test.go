@@ -0,0 +1,115 @@
+package flowdock
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if c.RestURL.String() != defaultRestURL || c.StreamURL.String() != defaultStreamURL {
+		t.Errorf("New has URLs %v and %v, want the defaults", c.RestURL, c.StreamURL)
+	}
+	if c.UserAgent != userAgent || c.client != http.DefaultClient {
+		t.Errorf("New has user agent %q and client %v, want the defaults", c.UserAgent, c.client)
+	}
+}
+
+func TestNew_options(t *testing.T) {
+	httpClient := &http.Client{}
+	c, err := New(
+		WithHTTPClient(httpClient),
+		WithTimeout(5*time.Second),
+		WithRestURL("http://localhost:8080/api"),
+		WithStreamURL("http://localhost:8081"),
+		WithToken("secret"),
+		WithUserAgent("dashboard/1.2"),
+	)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if got := c.RestURL.String(); got != "http://secret@localhost:8080/api/" {
+		t.Errorf("RestURL = %v", got)
+	}
+	if got := c.StreamURL.String(); got != "http://secret@localhost:8081/" {
+		t.Errorf("StreamURL = %v", got)
+	}
+	if want := userAgent + " dashboard/1.2"; c.UserAgent != want {
+		t.Errorf("UserAgent = %q, want %q", c.UserAgent, want)
+	}
+	if c.client.Timeout != 5*time.Second {
+		t.Errorf("HTTP client has timeout %v, want 5s", c.client.Timeout)
+	}
+	if httpClient.Timeout != 0 {
+		t.Error("New changed the timeout of the given HTTP client")
+	}
+
+	req, _ := c.NewRequest("GET", "flows", nil)
+	if got := req.URL.String(); got != "http://secret@localhost:8080/api/flows" {
+		t.Errorf("NewRequest URL = %v", got)
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	tests := map[string]Option{
+		"relative URL":    WithRestURL("api.flowdock.com"),
+		"unparsable URL":  WithRestURL("http://[::1"),
+		"ftp URL":         WithStreamURL("ftp://stream.flowdock.com/"),
+		"empty token":     WithToken(""),
+		"zero timeout":    WithTimeout(0),
+		"nil client":      WithHTTPClient(nil),
+		"nil transport":   WithTransport(nil),
+		"nil logger":      WithLogger(nil),
+		"user agent":      WithUserAgent("bot\r\nX-Evil: 1"),
+		"negative retry":  WithRetry(RetryPolicy{MaxAttempts: -1}),
+		"inverted backof": WithRetry(RetryPolicy{MinBackoff: time.Minute, MaxBackoff: time.Second}),
+	}
+	for name, opt := range tests {
+		if c, err := New(opt); err == nil || c != nil {
+			t.Errorf("New with %v returned %v, %v; want an error", name, c, err)
+		} else if !strings.HasPrefix(err.Error(), "flowdock: ") {
+			t.Errorf("New with %v returned error %q without the package prefix", name, err)
+		}
+	}
+}
+
+func TestNew_retryAndLogger(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var requests int
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+
+	var buf bytes.Buffer
+	c, err := New(
+		WithRestURL(server.URL),
+		WithTransport(http.DefaultTransport),
+		WithRetry(RetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+		WithLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if _, _, err := c.Users.All(); err != nil {
+		t.Fatalf("Users.All returned error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("server got %d requests, want 2", requests)
+	}
+	if n := strings.Count(buf.String(), "flowdock request"); n != 2 {
+		t.Errorf("logged %d requests, want each attempt:\n%s", n, buf.String())
+	}
+}
@@ -3,13 +3,18 @@ package flowdock
 import (
 	"fmt"
 	"net/http"
-	"net/url"
 )
 
 type OrganizationUpdateOptions struct {
 	Name string `json:"name,omitempty"`
 }
 
+// OrganizationsGetOptions specifies the parameters to the
+// OrganizationsService.GetById method.
+type OrganizationsGetOptions struct {
+	Id int `url:"id"`
+}
+
 type OrganizationsService struct {
 	client *Client
 }
@@ -20,13 +25,8 @@ type OrganizationsService struct {
 func (s *OrganizationsService) All() ([]Organization, *http.Response, error) {
 	u := "organizations"
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	organizations := new([]Organization)
-	resp, err := s.client.Do(req, organizations)
+	resp, err := s.client.call("GET", u, nil, nil, organizations)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -40,13 +40,8 @@ func (s *OrganizationsService) All() ([]Organization, *http.Response, error) {
 func (s *OrganizationsService) GetByParameterizedName(name string) (*Organization, *http.Response, error) {
 	u := fmt.Sprintf("organizations/%v", name)
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	organization := new(Organization)
-	resp, err := s.client.Do(req, organization)
+	resp, err := s.client.call("GET", u, nil, nil, organization)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -58,15 +53,10 @@ func (s *OrganizationsService) GetByParameterizedName(name string) (*Organizatio
 //
 // Flowdock API docs: https://www.flowdock.com/api/organizations
 func (s *OrganizationsService) GetById(id int) (*Organization, *http.Response, error) {
-	u := fmt.Sprintf("organizations/find?id=%v", id)
-
-	req, err := s.client.NewRequest("GET", url.QueryEscape(u), nil)
-	if err != nil {
-		return nil, nil, err
-	}
+	u := "organizations/find"
 
 	organization := new(Organization)
-	resp, err := s.client.Do(req, organization)
+	resp, err := s.client.call("GET", u, OrganizationsGetOptions{Id: id}, nil, organization)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -79,15 +69,8 @@ func (s *OrganizationsService) GetById(id int) (*Organization, *http.Response, e
 // Flowdock API docs: https://www.flowdock.com/api/organizations
 func (s *OrganizationsService) Update(id int, opt *OrganizationUpdateOptions) (*Organization, *http.Response, error) {
 	u := fmt.Sprintf("organizations/%v", id)
-
-	u, err := addOptions(u, opt)
-	req, err := s.client.NewRequest("PUT", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	organization := new(Organization)
-	resp, err := s.client.Do(req, organization)
+	resp, err := s.client.call("PUT", u, nil, opt, organization)
 	if err != nil {
 		return nil, resp, err
 	}
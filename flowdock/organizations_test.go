@@ -58,8 +58,9 @@ func TestOrganizationsService_GetById(t *testing.T) {
 	setup()
 	defer teardown()
 
-	mux.HandleFunc("/organizations/find?id=1", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/organizations/find", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "GET")
+		testFormValues(t, r, values{"id": "1"})
 		fmt.Fprint(w, `{"id":1}`)
 	})
 
@@ -82,6 +83,7 @@ func TestOrganizationsService_Update(t *testing.T) {
 
 	mux.HandleFunc("/organizations/1", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "PUT")
+		testJSONBody(t, r, `{"name":"new-name"}`)
 		fmt.Fprint(w, `{"id":1, "name":"new-name"}`)
 	})
 
@@ -0,0 +1,299 @@
+package flowdock
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events are the message event types known to the Flowdock API.
+var Events = []string{
+	"message", "status", "comment", "action", "tag-change", "message-edit",
+	"activity.user", "file", "user-edit", "mail", "vcs", "jira", "twitter",
+	"rss", "zendesk", "line", "discussion", "activity",
+}
+
+// maxListLimit is the most messages the API returns at once.
+const maxListLimit = 100
+
+// Query builds a message search. Each method checks its arguments and adds a
+// filter; the first invalid argument is reported by Options or
+// MessagesService.Query.
+//
+//	q := flowdock.NewQuery().
+//		Events("message", "comment").
+//		AllTags("deploy").
+//		SentAfter(time.Now().Add(-24 * time.Hour)).
+//		Limit(50)
+//	messages, _, err := client.Messages.Query("org", "flow", q)
+//
+// Filters the API cannot express, like the sent time and users, are applied
+// to the messages the API returns by MessagesService.Query and Match.
+type Query struct {
+	events  []string
+	allTags []string
+	anyTags []string
+	search  string
+	users   []string
+	after   time.Time
+	before  time.Time
+	sinceID int
+	untilID int
+	limit   int
+	err     error
+}
+
+// NewQuery returns a query matching every message.
+func NewQuery() *Query {
+	return new(Query)
+}
+
+func (q *Query) fail(format string, args ...interface{}) *Query {
+	if q.err == nil {
+		q.err = fmt.Errorf("flowdock: "+format, args...)
+	}
+	return q
+}
+
+// Events only matches messages of these event types.
+func (q *Query) Events(events ...string) *Query {
+	for _, e := range events {
+		if !isEvent(e) {
+			return q.fail("unknown event %q", e)
+		}
+		q.events = append(q.events, e)
+	}
+	return q
+}
+
+// AllTags only matches messages with every one of the tags.
+func (q *Query) AllTags(tags ...string) *Query {
+	if err := checkTags(tags); err != nil {
+		return q.fail("%v", err)
+	}
+	q.allTags = append(q.allTags, tags...)
+	return q
+}
+
+// AnyTags only matches messages with at least one of the tags.
+func (q *Query) AnyTags(tags ...string) *Query {
+	if err := checkTags(tags); err != nil {
+		return q.fail("%v", err)
+	}
+	q.anyTags = append(q.anyTags, tags...)
+	return q
+}
+
+// Search only matches messages Flowdock finds when searching for the words.
+func (q *Query) Search(words string) *Query {
+	q.search = strings.TrimSpace(q.search + " " + words)
+	return q
+}
+
+// Users only matches messages sent by one of the users.
+func (q *Query) Users(ids ...int) *Query {
+	for _, id := range ids {
+		if id <= 0 {
+			return q.fail("invalid user ID %d", id)
+		}
+		q.users = append(q.users, strconv.Itoa(id))
+	}
+	return q
+}
+
+// SentAfter only matches messages sent at or after t.
+func (q *Query) SentAfter(t time.Time) *Query {
+	if !q.before.IsZero() && !t.Before(q.before) {
+		return q.fail("empty time window: %v is not before %v", t, q.before)
+	}
+	q.after = t
+	return q
+}
+
+// SentBefore only matches messages sent before t.
+func (q *Query) SentBefore(t time.Time) *Query {
+	if !q.after.IsZero() && !q.after.Before(t) {
+		return q.fail("empty time window: %v is not before %v", q.after, t)
+	}
+	q.before = t
+	return q
+}
+
+// SinceID only matches messages after the one with this ID.
+func (q *Query) SinceID(id int) *Query {
+	q.sinceID = id
+	return q
+}
+
+// UntilID only matches messages before the one with this ID.
+func (q *Query) UntilID(id int) *Query {
+	q.untilID = id
+	return q
+}
+
+// Limit sets the most messages returned. MessagesService.Query pages through
+// the flow for more than the API returns at once.
+func (q *Query) Limit(n int) *Query {
+	if n <= 0 {
+		return q.fail("invalid limit %d", n)
+	}
+	q.limit = n
+	return q
+}
+
+// Options compiles the query into the parameters of MessagesService.List.
+// Filters that the parameters cannot express are left to Match.
+func (q *Query) Options() (*MessagesListOptions, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	opt := &MessagesListOptions{
+		Event:   strings.Join(q.events, ","),
+		Limit:   q.limit,
+		SinceId: q.sinceID,
+		UntilId: q.untilID,
+		Search:  q.search,
+	}
+	switch {
+	case len(q.allTags) > 0:
+		opt.Tags, opt.TagMode = q.allTags, "and"
+	case len(q.anyTags) > 0:
+		opt.Tags, opt.TagMode = q.anyTags, "or"
+	}
+	return opt, nil
+}
+
+// clientSide reports whether Options leaves out some of the filters.
+func (q *Query) clientSide() bool {
+	return len(q.users) > 0 || !q.after.IsZero() || !q.before.IsZero() ||
+		len(q.allTags) > 0 && len(q.anyTags) > 0
+}
+
+// Match reports whether m passes the query's filters. The words searched
+// for are not checked: only Flowdock knows how it matches them.
+func (q *Query) Match(m Message) bool {
+	if len(q.events) > 0 && (m.Event == nil || !contains(q.events, *m.Event, false)) {
+		return false
+	}
+	var tags []string
+	if m.Tags != nil {
+		tags = *m.Tags
+	}
+	for _, tag := range q.allTags {
+		if !contains(tags, tag, true) {
+			return false
+		}
+	}
+	if len(q.anyTags) > 0 {
+		found := false
+		for _, tag := range q.anyTags {
+			found = found || contains(tags, tag, true)
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.users) > 0 && (m.UserID == nil || !contains(q.users, *m.UserID, false)) {
+		return false
+	}
+	if !q.after.IsZero() || !q.before.IsZero() {
+		if m.Sent == nil || m.Sent.Before(q.after) || !q.before.IsZero() && !m.Sent.Before(q.before) {
+			return false
+		}
+	}
+	if q.sinceID != 0 && (m.ID == nil || *m.ID <= q.sinceID) {
+		return false
+	}
+	if q.untilID != 0 && (m.ID == nil || *m.ID >= q.untilID) {
+		return false
+	}
+	return true
+}
+
+// Query lists the latest messages of a flow matching q, oldest first.
+// Filters the API cannot express are applied to the messages it returns,
+// paging back through the flow until the limit is reached or there are no
+// more messages in the time window or after SinceID.
+//
+// Flowdock API docs: https://www.flowdock.com/api/messages
+func (s *MessagesService) Query(org, flow string, q *Query) ([]Message, *http.Response, error) {
+	opt, err := q.Options()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !q.clientSide() && q.limit <= maxListLimit {
+		return s.List(org, flow, opt)
+	}
+
+	limit := q.limit
+	if limit == 0 {
+		limit = 30 // the API's default
+	}
+	opt.Limit = maxListLimit
+
+	var matches []Message
+	var resp *http.Response
+	for {
+		var page []Message
+		page, resp, err = s.List(org, flow, opt)
+		if err != nil {
+			return nil, resp, err
+		}
+
+		first, outside := 0, false
+		for _, m := range page {
+			if m.ID == nil {
+				continue
+			}
+			if first == 0 || *m.ID < first {
+				first = *m.ID
+			}
+			if m.Sent != nil && m.Sent.Before(q.after) {
+				outside = true
+			}
+			if q.Match(m) {
+				matches = append(matches, m)
+			}
+		}
+		if len(matches) >= limit || len(page) < opt.Limit || first == 0 || first <= q.sinceID || outside {
+			break
+		}
+		opt.UntilId = first
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return *matches[i].ID < *matches[j].ID })
+	if len(matches) > limit {
+		matches = matches[len(matches)-limit:]
+	}
+	return matches, resp, nil
+}
+
+func isEvent(name string) bool {
+	for _, e := range Events {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ", ") {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string, fold bool) bool {
+	for _, e := range list {
+		if e == s || fold && strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package flowdock
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuery_Options(t *testing.T) {
+	opt, err := NewQuery().
+		Events("message", "comment").
+		AllTags("deploy", "prod").
+		Search("failed").
+		UntilID(10).
+		Limit(50).
+		Options()
+	if err != nil {
+		t.Fatalf("Options returned error: %v", err)
+	}
+
+	want := &MessagesListOptions{
+		Event:   "message,comment",
+		Limit:   50,
+		UntilId: 10,
+		Tags:    []string{"deploy", "prod"},
+		TagMode: "and",
+		Search:  "failed",
+	}
+	if !reflect.DeepEqual(opt, want) {
+		t.Errorf("Options returned %+v, want %+v", opt, want)
+	}
+
+	opt, _ = NewQuery().AnyTags("a", "b").Options()
+	if opt.TagMode != "or" || !reflect.DeepEqual(opt.Tags, []string{"a", "b"}) {
+		t.Errorf("Options returned %+v, want tags a or b", opt)
+	}
+}
+
+func TestQuery_invalid(t *testing.T) {
+	now := time.Now()
+	tests := map[string]*Query{
+		"event":  NewQuery().Events("message, comment"),
+		"tag":    NewQuery().AllTags("a,b"),
+		"user":   NewQuery().Users(0),
+		"limit":  NewQuery().Limit(-1),
+		"window": NewQuery().SentAfter(now).SentBefore(now.Add(-time.Hour)),
+	}
+	for name, q := range tests {
+		if _, err := q.Options(); err == nil {
+			t.Errorf("Options of a query with an invalid %v returned no error", name)
+		}
+	}
+}
+
+func TestQuery_Match(t *testing.T) {
+	day := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	id, user, event := 5, "7", "message"
+	tags := []string{"Deploy", "prod"}
+	m := Message{ID: &id, UserID: &user, Event: &event, Tags: &tags, Sent: &Time{day}}
+
+	tests := []struct {
+		q    *Query
+		want bool
+	}{
+		{NewQuery(), true},
+		{NewQuery().Events("comment"), false},
+		{NewQuery().AllTags("deploy", "prod"), true},
+		{NewQuery().AllTags("deploy", "staging"), false},
+		{NewQuery().AllTags("prod").AnyTags("staging", "deploy"), true},
+		{NewQuery().AnyTags("staging"), false},
+		{NewQuery().Users(7, 8), true},
+		{NewQuery().Users(8), false},
+		{NewQuery().SentAfter(day), true},
+		{NewQuery().SentBefore(day), false},
+		{NewQuery().SentAfter(day.Add(-time.Hour)).SentBefore(day.Add(time.Hour)), true},
+		{NewQuery().SinceID(5), false},
+		{NewQuery().UntilID(6), true},
+	}
+	for i, tt := range tests {
+		if got := tt.q.Match(m); got != tt.want {
+			t.Errorf("%d: Match returned %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+// serveMessages serves n messages, one an hour from day with users
+// alternating between 1 and 2, paging like the API.
+func serveMessages(t *testing.T, n int, day time.Time) {
+	mux.HandleFunc("/flows/org/flow/messages", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		limit, _ := strconv.Atoi(r.FormValue("limit"))
+		sinceID, _ := strconv.Atoi(r.FormValue("since_id"))
+		untilID, _ := strconv.Atoi(r.FormValue("until_id"))
+
+		var page []Message
+		for i := 1; i <= n; i++ {
+			if sinceID != 0 && i <= sinceID || untilID != 0 && i >= untilID {
+				continue
+			}
+			id, user := i, strconv.Itoa(i%2+1)
+			page = append(page, Message{ID: &id, UserID: &user, Sent: &Time{day.Add(time.Duration(i) * time.Hour)}})
+		}
+		if len(page) > limit {
+			page = page[len(page)-limit:]
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+}
+
+func ids(messages []Message) []int {
+	var ids []int
+	for _, m := range messages {
+		ids = append(ids, *m.ID)
+	}
+	return ids
+}
+
+func TestMessagesService_Query(t *testing.T) {
+	setup()
+	defer teardown()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	serveMessages(t, 250, day)
+
+	// user 2 sent the odd messages; the newest three are on the last page
+	messages, _, err := client.Messages.Query("org", "flow", NewQuery().Users(2).Limit(3))
+	if err != nil {
+		t.Fatalf("Messages.Query returned error: %v", err)
+	}
+	if got := ids(messages); !reflect.DeepEqual(got, []int{245, 247, 249}) {
+		t.Errorf("Messages.Query returned %v", got)
+	}
+
+	// the window is two pages back
+	q := NewQuery().SentAfter(day.Add(10 * time.Hour)).SentBefore(day.Add(13 * time.Hour)).Limit(10)
+	messages, _, err = client.Messages.Query("org", "flow", q)
+	if err != nil {
+		t.Fatalf("Messages.Query returned error: %v", err)
+	}
+	if got := ids(messages); !reflect.DeepEqual(got, []int{10, 11, 12}) {
+		t.Errorf("Messages.Query returned %v", got)
+	}
+
+	// back to an ID, skipping the messages after the window
+	q = NewQuery().SinceID(100).Users(1).SentBefore(day.Add(106 * time.Hour))
+	messages, _, err = client.Messages.Query("org", "flow", q)
+	if err != nil {
+		t.Fatalf("Messages.Query returned error: %v", err)
+	}
+	if got := ids(messages); !reflect.DeepEqual(got, []int{102, 104}) {
+		t.Errorf("Messages.Query returned %v", got)
+	}
+}
+
+func TestMessagesService_Query_invalid(t *testing.T) {
+	setup()
+	defer teardown()
+
+	_, _, err := client.Messages.Query("org", "flow", NewQuery().Events("nope"))
+	if err == nil {
+		t.Error("Messages.Query with an unknown event returned no error")
+	}
+}
@@ -0,0 +1,143 @@
+package flowdock
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how Retry resends failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a request is sent, 3 when zero.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry, 500ms when zero. It
+	// doubles for each later retry, up to MaxBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the longest delay between attempts, 30s when zero. A
+	// response asking to wait longer in its Retry-After header is
+	// returned instead of retried.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries a request twice, after about 0.5s and 1s.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, MinBackoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 || p.MinBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("invalid retry policy %+v", p)
+	}
+	if p.MaxBackoff != 0 && p.MinBackoff > p.MaxBackoff {
+		return fmt.Errorf("invalid retry policy: MinBackoff %v is over MaxBackoff %v", p.MinBackoff, p.MaxBackoff)
+	}
+	return nil
+}
+
+// Retry returns middleware resending requests that failed for reasons that
+// may pass: rate limiting (429), for any request, and network errors or
+// 502, 503 and 504 responses, for the requests that are safe to repeat (GET,
+// HEAD, PUT and DELETE). It waits an exponential backoff with jitter
+// between attempts, or as long as a Retry-After header asks, and gives up
+// when the request's context is done.
+//
+// Other requests, such as created messages, are only resent after a 429:
+// the API does not document dropping a message resent with the same UUID,
+// so a POST that may have reached it is not repeated.
+func Retry(p RetryPolicy) Middleware {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 3
+	}
+	if p.MinBackoff == 0 {
+		p.MinBackoff = 500 * time.Millisecond
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			backoff := p.MinBackoff
+			for attempt := 1; ; attempt++ {
+				resp, err := next(req)
+				if attempt >= p.MaxAttempts || !retryable(req, resp, err) {
+					return resp, err
+				}
+				delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+				if d, ok := retryAfterHeader(resp); ok {
+					if d > p.MaxBackoff {
+						return resp, err
+					}
+					delay = d
+				}
+				if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+					return resp, err // the body cannot be sent again
+				}
+				if resp != nil {
+					resp.Body.Close()
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-req.Context().Done():
+					timer.Stop()
+					return nil, req.Context().Err()
+				case <-timer.C:
+				}
+
+				if req.GetBody != nil {
+					body, err := req.GetBody()
+					if err != nil {
+						return nil, err
+					}
+					req = req.Clone(req.Context())
+					req.Body = body
+				}
+				if backoff *= 2; backoff > p.MaxBackoff {
+					backoff = p.MaxBackoff
+				}
+			}
+		}
+	}
+}
+
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	idempotent := req.Method == "GET" || req.Method == "HEAD" || req.Method == "PUT" || req.Method == "DELETE"
+	if err != nil {
+		return idempotent
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// retryAfterHeader returns the delay asked for by the response's
+// Retry-After header, in seconds or as an HTTP date.
+func retryAfterHeader(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
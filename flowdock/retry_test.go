@@ -0,0 +1,121 @@
+package flowdock
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// failing serves the statuses in turn, then 200s, recording the bodies of
+// the requests.
+func failing(retryAfter string, statuses ...int) *[]string {
+	var bodies []string
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[len(bodies)-1])
+			return
+		}
+		w.Write([]byte(`{}`))
+	})
+	return &bodies
+}
+
+func send(method string, policy RetryPolicy) (*http.Response, error) {
+	client.Use(Retry(policy))
+	req, _ := client.NewRequest(method, "messages", map[string]string{"content": "hi"})
+	return client.Do(req, nil)
+}
+
+var fastRetry = RetryPolicy{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	setup()
+	defer teardown()
+	bodies := failing("", http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	if _, err := send("PUT", fastRetry); err != nil {
+		t.Fatalf("Do returned error: %v", err)
+	}
+	if len(*bodies) != 3 {
+		t.Fatalf("server got %d requests, want 3", len(*bodies))
+	}
+	for i, body := range *bodies {
+		if body != `{"content":"hi"}`+"\n" {
+			t.Errorf("attempt %d sent body %q", i+1, body)
+		}
+	}
+}
+
+func TestRetry_maxAttempts(t *testing.T) {
+	setup()
+	defer teardown()
+	bodies := failing("", 503, 503, 503)
+
+	policy := fastRetry
+	policy.MaxAttempts = 2
+	resp, err := send("GET", policy)
+	if err == nil || resp.StatusCode != 503 {
+		t.Errorf("Do returned %v, %v; want the last 503", resp, err)
+	}
+	if len(*bodies) != 2 {
+		t.Errorf("server got %d requests, want 2", len(*bodies))
+	}
+}
+
+func TestRetry_post(t *testing.T) {
+	setup()
+	defer teardown()
+	bodies := failing("0", 503)
+
+	if _, err := send("POST", fastRetry); err == nil {
+		t.Error("Do of a POST answered with 503 returned no error")
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("a POST answered with 503 was sent %d times, want once", len(*bodies))
+	}
+}
+
+func TestRetry_rateLimited(t *testing.T) {
+	setup()
+	defer teardown()
+	bodies := failing("0", http.StatusTooManyRequests)
+
+	if _, err := send("POST", fastRetry); err != nil {
+		t.Fatalf("Do returned error: %v", err)
+	}
+	if len(*bodies) != 2 {
+		t.Errorf("a rate limited POST was sent %d times, want twice", len(*bodies))
+	}
+}
+
+func TestRetry_retryAfterTooLong(t *testing.T) {
+	setup()
+	defer teardown()
+	bodies := failing("3600", http.StatusTooManyRequests)
+
+	resp, _ := send("GET", fastRetry)
+	if resp.StatusCode != http.StatusTooManyRequests || len(*bodies) != 1 {
+		t.Errorf("Do returned %v after %d requests; want the 429 at once", resp.Status, len(*bodies))
+	}
+}
+
+func TestRetry_canceled(t *testing.T) {
+	setup()
+	defer teardown()
+	failing("", 503, 503)
+
+	client.Use(Retry(RetryPolicy{MinBackoff: time.Hour, MaxBackoff: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := client.NewRequest("GET", "messages", nil)
+	if _, err := client.Do(req.WithContext(ctx), nil); err != context.DeadlineExceeded {
+		t.Errorf("Do returned %v, want context.DeadlineExceeded", err)
+	}
+}
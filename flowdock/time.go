@@ -25,3 +25,9 @@ func (t *Time) UnmarshalJSON(b []byte) error {
 
 	return nil
 }
+
+// MarshalJSON implements the json.Marshaler interface. The time is encoded as
+// an integer representing milliseconds since Epoch.
+func (t Time) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)), nil
+}
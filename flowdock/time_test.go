@@ -18,3 +18,16 @@ func TestTime_UnmarshalJSON(t *testing.T) {
 		t.Errorf("Time.UnmarshalJSON set time to %v, wanted %v", flowdockTime.Local(), want.Local())
 	}
 }
+
+func TestTime_MarshalJSON(t *testing.T) {
+	flowdockTime := Time{time.Date(2013, time.November, 27, 9, 57, 31, 0, time.UTC)}
+	json, err := flowdockTime.MarshalJSON()
+	if err != nil {
+		t.Errorf("Time.MarshalJSON returned error: %v", err)
+	}
+
+	want := "1385546251000"
+	if string(json) != want {
+		t.Errorf("Time.MarshalJSON returned %v, wanted %v", string(json), want)
+	}
+}
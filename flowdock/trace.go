@@ -0,0 +1,106 @@
+package flowdock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	traceParentHeader = "Traceparent"
+	traceStateHeader  = "Tracestate"
+)
+
+// TraceParent is a W3C trace context, as carried by the traceparent header:
+// the trace a request belongs to and the span that sent it.
+type TraceParent struct {
+	TraceID string // 32 lowercase hex digits
+	SpanID  string // 16 lowercase hex digits
+	Sampled bool
+	State   string // the tracestate header, passed on unchanged
+}
+
+// ParseTraceParent parses a traceparent header such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(header string) (TraceParent, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" ||
+		!isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) ||
+		allZero(parts[1]) || allZero(parts[2]) {
+		return TraceParent{}, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return TraceParent{}, false
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return TraceParent{TraceID: parts[1], SpanID: parts[2], Sampled: flags[0]&1 == 1}, true
+}
+
+// String returns tp formatted as a version 00 traceparent header.
+func (tp TraceParent) String() string {
+	flags := "00"
+	if tp.Sampled {
+		flags = "01"
+	}
+	return "00-" + tp.TraceID + "-" + tp.SpanID + "-" + flags
+}
+
+type traceKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying tp, so requests sent with
+// the context by Tracing middleware belong to its trace.
+func ContextWithTrace(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceKey{}, tp)
+}
+
+// TraceFromContext returns the trace context carried by ctx, if any.
+func TraceFromContext(ctx context.Context) (TraceParent, bool) {
+	tp, ok := ctx.Value(traceKey{}).(TraceParent)
+	return tp, ok
+}
+
+// Tracing returns middleware propagating W3C trace context. Each request
+// gets a traceparent header for a new span of the trace carried by its
+// context, see ContextWithTrace, or of a new trace. Requests that already
+// have a traceparent header are sent unchanged.
+func Tracing() Middleware {
+	return BeforeRequest(func(req *http.Request) {
+		if req.Header.Get(traceParentHeader) != "" {
+			return
+		}
+		tp, ok := TraceFromContext(req.Context())
+		if !ok {
+			tp = TraceParent{TraceID: randomHex(16)}
+		}
+		tp.SpanID = randomHex(8)
+		req.Header.Set(traceParentHeader, tp.String())
+		if tp.State != "" {
+			req.Header.Set(traceStateHeader, tp.State)
+		}
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,64 @@
+package flowdock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tp, ok := ParseTraceParent(header)
+	if !ok || tp.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tp.SpanID != "00f067aa0ba902b7" || !tp.Sampled {
+		t.Errorf("ParseTraceParent returned %+v, %v", tp, ok)
+	}
+	if tp.String() != header {
+		t.Errorf("String returned %v, want %v", tp.String(), header)
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok := ParseTraceParent(bad); ok {
+			t.Errorf("ParseTraceParent(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var headers []http.Header
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		fmt.Fprint(w, `{}`)
+	})
+	client.Use(Tracing())
+
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	parent.State = "vendor=1"
+	req, _ := client.NewRequest("GET", "flows", nil)
+	client.Do(req.WithContext(ContextWithTrace(context.Background(), parent)), nil)
+	req, _ = client.NewRequest("GET", "flows", nil)
+	client.Do(req, nil)
+
+	child, ok := ParseTraceParent(headers[0].Get("Traceparent"))
+	if !ok || child.TraceID != parent.TraceID || child.SpanID == parent.SpanID || !child.Sampled {
+		t.Errorf("request in a trace sent traceparent %+v, want a new span of %+v", child, parent)
+	}
+	if state := headers[0].Get("Tracestate"); state != "vendor=1" {
+		t.Errorf("request in a trace sent tracestate %q, want vendor=1", state)
+	}
+	root, ok := ParseTraceParent(headers[1].Get("Traceparent"))
+	if !ok || root.TraceID == parent.TraceID {
+		t.Errorf("request without a trace sent traceparent %+v, want a new trace", root)
+	}
+}
@@ -20,13 +20,8 @@ type UsersService struct {
 func (s *UsersService) All() ([]User, *http.Response, error) {
 	u := "users"
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	users := new([]User)
-	resp, err := s.client.Do(req, users)
+	resp, err := s.client.call("GET", u, nil, nil, users)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -40,13 +35,8 @@ func (s *UsersService) All() ([]User, *http.Response, error) {
 func (s *UsersService) List(org, flow string) ([]User, *http.Response, error) {
 	u := fmt.Sprintf("flows/%v/%v/users", org, flow)
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	users := new([]User)
-	resp, err := s.client.Do(req, users)
+	resp, err := s.client.call("GET", u, nil, nil, users)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -60,13 +50,8 @@ func (s *UsersService) List(org, flow string) ([]User, *http.Response, error) {
 func (s *UsersService) Get(id int) (*User, *http.Response, error) {
 	u := fmt.Sprintf("users/%v", id)
 
-	req, err := s.client.NewRequest("GET", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	user := new(User)
-	resp, err := s.client.Do(req, user)
+	resp, err := s.client.call("GET", u, nil, nil, user)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -79,15 +64,8 @@ func (s *UsersService) Get(id int) (*User, *http.Response, error) {
 // Flowdock API docs: https://www.flowdock.com/api/users
 func (s *UsersService) Update(id int, opt *UserUpdateOptions) (*User, *http.Response, error) {
 	u := fmt.Sprintf("users/%v", id)
-
-	u, err := addOptions(u, opt)
-	req, err := s.client.NewRequest("PUT", u, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
 	user := new(User)
-	resp, err := s.client.Do(req, user)
+	resp, err := s.client.call("PUT", u, nil, opt, user)
 	if err != nil {
 		return nil, resp, err
 	}
@@ -80,6 +80,7 @@ func TestUsersService_Update(t *testing.T) {
 
 	mux.HandleFunc("/users/1", func(w http.ResponseWriter, r *http.Request) {
 		testMethod(t, r, "PUT")
+		testJSONBody(t, r, `{"nick":"new-nick"}`)
 		fmt.Fprint(w, `{"id":1, "nick":"new-nick"}`)
 	})
 
@@ -0,0 +1,686 @@
+package flowdocktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+const (
+	defaultListLimit = 30
+	maxListLimit     = 100
+)
+
+func (s *Server) restHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /flows", s.listFlows)
+	mux.HandleFunc("GET /flows/all", s.listFlows)
+	mux.HandleFunc("GET /flows/find", s.findFlowHandler)
+	mux.HandleFunc("GET /flows/{org}/{flow}", s.getFlow)
+	mux.HandleFunc("PUT /flows/{org}/{flow}", s.updateFlow)
+	mux.HandleFunc("POST /flows/{org}", s.createFlow)
+	mux.HandleFunc("GET /flows/{org}/{flow}/messages", s.listMessages)
+	mux.HandleFunc("POST /flows/{org}/{flow}/messages", s.createFlowMessage)
+	mux.HandleFunc("GET /flows/{org}/{flow}/messages/{id}", s.getMessage)
+	mux.HandleFunc("GET /flows/{org}/{flow}/files/{id}/{name}", s.getFile)
+	mux.HandleFunc("GET /flows/{org}/{flow}/users", s.listFlowUsers)
+	mux.HandleFunc("POST /messages", s.createMessage)
+	mux.HandleFunc("POST /comments", s.createMessage)
+	mux.HandleFunc("GET /users", s.listUsers)
+	mux.HandleFunc("GET /users/{id}", s.getUser)
+	mux.HandleFunc("PUT /users/{id}", s.updateUser)
+	mux.HandleFunc("GET /organizations", s.listOrganizations)
+	mux.HandleFunc("GET /organizations/find", s.findOrganizationHandler)
+	mux.HandleFunc("GET /organizations/{name}", s.getOrganization)
+	mux.HandleFunc("PUT /organizations/{id}", s.updateOrganization)
+	mux.HandleFunc("POST /v1/messages/team_inbox/{token}", s.createInboxMessage)
+	return mux
+}
+
+// All seeded flows are treated as joined by the authenticated user, so
+// "flows" and "flows/all" return the same list.
+func (s *Server) listFlows(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	withUsers := r.URL.Query().Get("user") == "1" || r.URL.Query().Get("user") == "true"
+	flows := []flowdock.Flow{}
+	for _, f := range s.flows {
+		flows = append(flows, *s.flowJSON(f, withUsers))
+	}
+	writeJSON(w, http.StatusOK, flows)
+}
+
+func (s *Server) findFlowHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlowByID(r.URL.Query().Get("id"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.flowJSON(f, true))
+}
+
+func (s *Server) getFlow(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(r.PathValue("org"), r.PathValue("flow"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.flowJSON(f, true))
+}
+
+func (s *Server) updateFlow(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(r.PathValue("org"), r.PathValue("flow"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	update := new(flowdock.Flow)
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if update.Name != nil {
+		f.Name = update.Name
+	}
+	if update.Open != nil {
+		f.Open = update.Open
+	}
+	if update.Disabled != nil {
+		f.Disabled = update.Disabled
+	}
+	if update.AccessMode != nil {
+		f.AccessMode = update.AccessMode
+	}
+	s.publishEvent(f, "flow-change", s.currentUser, s.flowJSON(f, false))
+	writeJSON(w, http.StatusOK, s.flowJSON(f, true))
+}
+
+func (s *Server) createFlow(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := readParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	o := s.findOrganization(r.PathValue("org"))
+	if o == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	name := p.get("name")
+	if name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation error: name is required")
+		return
+	}
+	name = parameterize(name)
+	if s.findFlow(*o.ParameterizedName, name) != nil {
+		writeError(w, http.StatusConflict, "Flow already exists")
+		return
+	}
+
+	f := s.newFlow(o, name)
+	f.Name = str(p.get("name"))
+	if s.currentUser != 0 {
+		f.users = appendUnique(f.users, s.currentUser)
+	}
+	writeJSON(w, http.StatusCreated, s.flowJSON(f, true))
+}
+
+// listMessages filters the flow's messages and returns the latest limit of
+// them, oldest first.
+func (s *Server) listMessages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(r.PathValue("org"), r.PathValue("flow"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	q := r.URL.Query()
+	limit := defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	sinceID, _ := strconv.Atoi(q.Get("since_id"))
+	untilID, _ := strconv.Atoi(q.Get("until_id"))
+
+	matches := []flowdock.Message{}
+	for _, m := range f.messages {
+		if sinceID != 0 && *m.ID <= sinceID {
+			continue
+		}
+		if untilID != 0 && *m.ID >= untilID {
+			continue
+		}
+		if matchMessage(m, q) {
+			matches = append(matches, m)
+		}
+	}
+
+	if len(matches) > limit {
+		matches = matches[len(matches)-limit:]
+	}
+	writeJSON(w, http.StatusOK, matches)
+}
+
+func (s *Server) getMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(r.PathValue("org"), r.PathValue("flow"))
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	if f == nil || s.findMessage(f, id) == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.findMessage(f, id))
+}
+
+func (s *Server) listFlowUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(r.PathValue("org"), r.PathValue("flow"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.usersJSON(f.users))
+}
+
+// createMessage handles both "messages" and "comments". Comments carry the
+// parent's content as their title and are tagged with an influx tag pointing
+// at the parent, like Flowdock does.
+func (s *Server) createMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rateLimited(w) {
+		return
+	}
+	p, err := readParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f := s.findFlowByID(p.get("flow"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Flow not found")
+		return
+	}
+	if r.URL.Path == "/comments" {
+		p["event"] = []string{"comment"}
+	}
+	s.postMessage(w, f, p)
+}
+
+// createFlowMessage handles messages posted to a flow's URL, including file
+// uploads sent as multipart forms.
+func (s *Server) createFlowMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rateLimited(w) {
+		return
+	}
+	f := s.findFlow(r.PathValue("org"), r.PathValue("flow"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Flow not found")
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		s.uploadFile(w, r, f)
+		return
+	}
+	p, err := readParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.postMessage(w, f, p)
+}
+
+func (s *Server) postMessage(w http.ResponseWriter, f *flow, p params) {
+	event := p.get("event")
+	if event == "" {
+		event = "message"
+	}
+	content := p.get("content")
+	if content == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation error: content is required")
+		return
+	}
+
+	m := flowdock.Message{Event: &event}
+	tags := p.list("tags")
+	raw, _ := json.Marshal(content)
+
+	if event == "comment" {
+		parentID, _ := strconv.Atoi(p.get("message"))
+		parent := s.findMessage(f, parentID)
+		if parent == nil {
+			writeError(w, http.StatusUnprocessableEntity, "Validation error: message is required")
+			return
+		}
+		raw, _ = json.Marshal(map[string]string{
+			"title": contentString(*parent),
+			"text":  content,
+		})
+		m.MessageID = &parentID
+		tags = append(tags, fmt.Sprintf("influx:%d", parentID))
+	}
+
+	rawContent := json.RawMessage(raw)
+	m.RawContent = &rawContent
+	m.Tags = &tags
+	if v := p.get("uuid"); v != "" {
+		m.UUID = &v
+	}
+	if v := p.get("external_user_name"); v != "" {
+		m.ExternalUserName = &v
+	}
+
+	stored := s.appendMessage(f, m)
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+// uploadFile stores the "content" part of a multipart form as a file
+// message.
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, f *flow) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	file, header, err := r.FormFile("content")
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "Validation error: content is required")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.nextFileID++
+	path := fmt.Sprintf("/flows/%v/%v/files/%d/%v", *f.org.ParameterizedName, *f.ParameterizedName, s.nextFileID, url.PathEscape(header.Filename))
+	if s.files == nil {
+		s.files = map[string][]byte{}
+	}
+	s.files[path] = data
+
+	contentType := header.Header.Get("Content-Type")
+	raw, _ := json.Marshal(map[string]interface{}{
+		"file_name":    header.Filename,
+		"content_type": contentType,
+		"file_size":    len(data),
+		"path":         path,
+	})
+	rawContent := json.RawMessage(raw)
+	tags := splitList(r.FormValue("tags"))
+	m := flowdock.Message{Event: str("file"), RawContent: &rawContent, Tags: &tags}
+	if v := r.FormValue("uuid"); v != "" {
+		m.UUID = &v
+	}
+	stored := s.appendMessage(f, m)
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+func (s *Server) getFile(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.files[r.URL.EscapedPath()]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	w.Write(data)
+}
+
+// rateLimited answers 429 Too Many Requests while a limit set with
+// RateLimit lasts. s.mu must be held.
+func (s *Server) rateLimited(w http.ResponseWriter) bool {
+	if s.limited == 0 {
+		return false
+	}
+	s.limited--
+	w.Header().Set("Retry-After", strconv.Itoa(int((s.retryAfter+time.Second-1)/time.Second)))
+	writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+	return true
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []flowdock.User{}
+	for _, u := range s.users {
+		users = append(users, *copyUser(u))
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	u := s.findUser(id)
+	if u == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := readParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	u := s.findUser(id)
+	if u == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if v := p.get("nick"); v != "" {
+		u.Nick = &v
+	}
+	if v := p.get("email"); v != "" {
+		u.Email = &v
+	}
+	for _, f := range s.flows {
+		if containsInt(f.users, id) {
+			s.publishEvent(f, "user-edit", id, map[string]interface{}{"user": u})
+		}
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (s *Server) listOrganizations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orgs := []flowdock.Organization{}
+	for _, o := range s.orgs {
+		orgs = append(orgs, *s.organizationJSON(o))
+	}
+	writeJSON(w, http.StatusOK, orgs)
+}
+
+func (s *Server) findOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	o := s.findOrganizationByID(id)
+	if o == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.organizationJSON(o))
+}
+
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := s.findOrganization(r.PathValue("name"))
+	if o == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.organizationJSON(o))
+}
+
+func (s *Server) updateOrganization(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := readParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	o := s.findOrganizationByID(id)
+	if o == nil {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if v := p.get("name"); v != "" {
+		o.Name = &v
+	}
+	writeJSON(w, http.StatusOK, s.organizationJSON(o))
+}
+
+// createInboxMessage stores a "mail" event in the flow owning the token.
+func (s *Server) createInboxMessage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := readParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f := s.findFlowByToken(r.PathValue("token"))
+	if f == nil {
+		writeError(w, http.StatusNotFound, "Flow not found")
+		return
+	}
+	for _, key := range []string{"source", "from_address", "subject", "content"} {
+		if p.get(key) == "" {
+			writeError(w, http.StatusUnprocessableEntity, "Validation error: "+key+" is required")
+			return
+		}
+	}
+
+	mail := map[string]interface{}{
+		"source":  p.get("source"),
+		"subject": p.get("subject"),
+		"content": p.get("content"),
+		"from": []map[string]string{
+			{"address": p.get("from_address"), "name": p.get("from_name")},
+		},
+	}
+	for _, key := range []string{"reply_to", "project", "link"} {
+		if v := p.get(key); v != "" {
+			mail[key] = v
+		}
+	}
+	raw, _ := json.Marshal(mail)
+	rawContent := json.RawMessage(raw)
+	tags := p.list("tags")
+
+	stored := s.appendMessage(f, flowdock.Message{
+		Event:      str("mail"),
+		RawContent: &rawContent,
+		Tags:       &tags,
+	})
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+// matchMessage reports whether m passes the event, tags and search filters
+// of a message list query.
+func matchMessage(m flowdock.Message, q url.Values) bool {
+	if events := splitList(q.Get("event")); len(events) > 0 && !contains(events, *m.Event) {
+		return false
+	}
+
+	if tags := splitList(q.Get("tags")); len(tags) > 0 {
+		found := 0
+		for _, tag := range tags {
+			if contains(*m.Tags, tag) {
+				found++
+			}
+		}
+		if q.Get("tag_mode") == "or" && found == 0 {
+			return false
+		}
+		if q.Get("tag_mode") != "or" && found != len(tags) {
+			return false
+		}
+	}
+
+	if search := q.Get("search"); search != "" {
+		text := strings.ToLower(string(*m.RawContent))
+		for _, word := range strings.Fields(strings.ToLower(search)) {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// contentString returns a plain string for the message content, used as the
+// title of comments.
+func contentString(m flowdock.Message) string {
+	var s string
+	if err := json.Unmarshal(*m.RawContent, &s); err == nil {
+		return s
+	}
+	return string(*m.RawContent)
+}
+
+// params holds request parameters sent either in the query string, as a
+// form body or as a JSON object body.
+type params map[string][]string
+
+func readParams(r *http.Request) (params, error) {
+	p := params{}
+	for k, v := range r.URL.Query() {
+		p[k] = v
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		for k, v := range r.PostForm {
+			p[k] = v
+		}
+		return p, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return p, nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, e := range v {
+				p[k] = append(p[k], fmt.Sprint(e))
+			}
+		case nil:
+		case float64:
+			p[k] = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+		default:
+			p[k] = []string{fmt.Sprint(v)}
+		}
+	}
+	return p, nil
+}
+
+func (p params) get(key string) string {
+	if v := p[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// list returns a list parameter, which may be repeated or comma separated.
+func (p params) list(key string) []string {
+	list := []string{}
+	for _, v := range p[key] {
+		list = append(list, splitList(v)...)
+	}
+	return list
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func parameterize(name string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name), "-")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
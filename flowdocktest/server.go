@@ -0,0 +1,394 @@
+// Package flowdocktest provides an in-memory fake of the Flowdock REST and
+// streaming APIs for use in tests.
+//
+// A Server is seeded through Go calls and hands out a *flowdock.Client that
+// is already pointed at it:
+//
+//	srv := flowdocktest.NewServer()
+//	defer srv.Close()
+//
+//	srv.AddOrganization("acme", "Acme")
+//	srv.AddFlow("acme", "main")
+//	client := srv.Client()
+//
+//	flows, _, err := client.Flows.List(false, nil)
+package flowdocktest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// Server is a stateful fake Flowdock service. It runs two HTTP servers, one
+// for the REST API and one for the streaming API, both backed by the same
+// in-memory state.
+type Server struct {
+	// REST is the test server answering REST API requests.
+	REST *httptest.Server
+
+	// Stream is the test server answering streaming API requests.
+	Stream *httptest.Server
+
+	// Now returns the time stamp given to new messages. It defaults to
+	// time.Now.
+	Now func() time.Time
+
+	mu            sync.Mutex
+	orgs          []*organization
+	flows         []*flow
+	users         []*flowdock.User
+	currentUser   int
+	nextOrgID     int
+	nextUserID    int
+	nextMessageID int
+	nextFileID    int
+	files         map[string][]byte
+	limited       int
+	retryAfter    time.Duration
+	subscribers   map[*subscriber]bool
+	done          chan struct{}
+	closeOnce     sync.Once
+}
+
+type organization struct {
+	flowdock.Organization
+	users []int
+}
+
+type flow struct {
+	flowdock.Flow
+	org      *organization
+	users    []int
+	token    string
+	messages []flowdock.Message
+}
+
+// NewServer starts and returns a new fake Flowdock server. The caller should
+// call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Now:         time.Now,
+		subscribers: make(map[*subscriber]bool),
+		done:        make(chan struct{}),
+	}
+	s.REST = httptest.NewServer(s.restHandler())
+	s.Stream = httptest.NewServer(s.streamHandler())
+	return s
+}
+
+// Close ends all open streams and shuts down both test servers.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.Stream.Close()
+	s.REST.Close()
+}
+
+// Client returns a new flowdock.Client configured to talk to the server.
+func (s *Server) Client() *flowdock.Client {
+	c, _ := flowdock.New(flowdock.WithRestURL(s.REST.URL), flowdock.WithStreamURL(s.Stream.URL))
+	return c
+}
+
+// AddOrganization seeds an organization. parameterizedName is the name used
+// in API paths.
+func (s *Server) AddOrganization(parameterizedName, name string) *flowdock.Organization {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextOrgID++
+	id := s.nextOrgID
+	active := true
+	o := &organization{Organization: flowdock.Organization{
+		Id:                &id,
+		Name:              &name,
+		ParameterizedName: &parameterizedName,
+		Active:            &active,
+		Url:               str(s.REST.URL + "/organizations/" + parameterizedName),
+	}}
+	s.orgs = append(s.orgs, o)
+	return s.organizationJSON(o)
+}
+
+// AddUser seeds a user. The first user added becomes the authenticated user
+// that messages created through the API are attributed to.
+func (s *Server) AddUser(nick, name, email string) *flowdock.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextUserID++
+	id := s.nextUserID
+	u := &flowdock.User{
+		Id:    &id,
+		Nick:  &nick,
+		Name:  &name,
+		Email: &email,
+	}
+	s.users = append(s.users, u)
+	if s.currentUser == 0 {
+		s.currentUser = id
+	}
+	return copyUser(u)
+}
+
+// SetCurrentUser changes the authenticated user.
+func (s *Server) SetCurrentUser(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currentUser = id
+}
+
+// AddFlow seeds a flow in the organization with the given parameterized
+// name. The given users become members of both the flow and the
+// organization.
+func (s *Server) AddFlow(org, name string, userIDs ...int) (*flowdock.Flow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := s.findOrganization(org)
+	if o == nil {
+		return nil, fmt.Errorf("flowdocktest: unknown organization %q", org)
+	}
+	f := s.newFlow(o, name)
+	for _, id := range userIDs {
+		if s.findUser(id) == nil {
+			return nil, fmt.Errorf("flowdocktest: unknown user %d", id)
+		}
+		f.users = appendUnique(f.users, id)
+		o.users = appendUnique(o.users, id)
+	}
+	return s.flowJSON(f, true), nil
+}
+
+// RateLimit makes the next n posted messages fail with 429 Too Many
+// Requests and a Retry-After header of retryAfter, rounded up to seconds.
+func (s *Server) RateLimit(n int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limited = n
+	s.retryAfter = retryAfter
+}
+
+// FlowToken returns the API token used to post to the flow's team inbox.
+func (s *Server) FlowToken(org, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f := s.findFlow(org, name); f != nil {
+		return f.token
+	}
+	return ""
+}
+
+// AddMessage seeds a message in a flow and delivers it to any open streams.
+// The message is given the next ID and, when unset, a sent time and the
+// authenticated user.
+func (s *Server) AddMessage(org, name string, m flowdock.Message) (*flowdock.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(org, name)
+	if f == nil {
+		return nil, fmt.Errorf("flowdocktest: unknown flow %v/%v", org, name)
+	}
+	stored := s.appendMessage(f, m)
+	return &stored, nil
+}
+
+// Messages returns every message stored in a flow, oldest first.
+func (s *Server) Messages(org, name string) []flowdock.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.findFlow(org, name)
+	if f == nil {
+		return nil
+	}
+	return append([]flowdock.Message(nil), f.messages...)
+}
+
+func (s *Server) newFlow(o *organization, name string) *flow {
+	sum := sha1.Sum([]byte(*o.ParameterizedName + "/" + name))
+	id := hex.EncodeToString(sum[:16])
+	token := hex.EncodeToString(sum[16:]) + id[:24]
+	open, joined, disabled := true, true, false
+	path := fmt.Sprintf("flows/%v/%v", *o.ParameterizedName, name)
+
+	f := &flow{
+		Flow: flowdock.Flow{
+			Id:                &id,
+			Name:              str(name),
+			ParameterizedName: str(name),
+			Open:              &open,
+			Joined:            &joined,
+			Disabled:          &disabled,
+			Url:               str(s.REST.URL + "/" + path),
+			WebUrl:            str(s.REST.URL + "/app/" + *o.ParameterizedName + "/" + name),
+			AccessMode:        str("organization"),
+		},
+		org:   o,
+		token: token,
+	}
+	s.flows = append(s.flows, f)
+	return f
+}
+
+// appendMessage stores m in f and publishes it. s.mu must be held.
+func (s *Server) appendMessage(f *flow, m flowdock.Message) flowdock.Message {
+	s.nextMessageID++
+	id := s.nextMessageID
+	m.ID = &id
+	m.FlowID = f.Id
+	if m.Sent == nil {
+		m.Sent = &flowdock.Time{Time: s.Now()}
+	}
+	if m.UserID == nil {
+		m.UserID = str(strconv.Itoa(s.currentUser))
+	}
+	if m.Event == nil {
+		m.Event = str("message")
+	}
+	if m.Tags == nil {
+		m.Tags = &[]string{}
+	}
+	if m.RawContent == nil {
+		raw := json.RawMessage(`""`)
+		m.RawContent = &raw
+	}
+	f.messages = append(f.messages, m)
+	s.publish(f, m)
+	return m
+}
+
+func (s *Server) findOrganization(name string) *organization {
+	for _, o := range s.orgs {
+		if *o.ParameterizedName == name {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *Server) findOrganizationByID(id int) *organization {
+	for _, o := range s.orgs {
+		if *o.Id == id {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *Server) findFlow(org, name string) *flow {
+	for _, f := range s.flows {
+		if *f.org.ParameterizedName == org && *f.ParameterizedName == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// findFlowByID finds a flow by its ID or by an "org:flow" reference.
+func (s *Server) findFlowByID(id string) *flow {
+	if org, name, ok := strings.Cut(id, ":"); ok {
+		return s.findFlow(org, name)
+	}
+	for _, f := range s.flows {
+		if *f.Id == id {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) findFlowByToken(token string) *flow {
+	for _, f := range s.flows {
+		if f.token == token {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) findUser(id int) *flowdock.User {
+	for _, u := range s.users {
+		if *u.Id == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Server) findMessage(f *flow, id int) *flowdock.Message {
+	for i := range f.messages {
+		if *f.messages[i].ID == id {
+			return &f.messages[i]
+		}
+	}
+	return nil
+}
+
+// usersJSON returns copies of the users with the given ids.
+func (s *Server) usersJSON(ids []int) []flowdock.User {
+	users := []flowdock.User{}
+	for _, id := range ids {
+		if u := s.findUser(id); u != nil {
+			users = append(users, *copyUser(u))
+		}
+	}
+	return users
+}
+
+func (s *Server) organizationJSON(o *organization) *flowdock.Organization {
+	org := o.Organization
+	count := int64(len(o.users))
+	users := s.usersJSON(o.users)
+	org.UserCount = &count
+	org.Users = &users
+	return &org
+}
+
+func (s *Server) flowJSON(f *flow, withUsers bool) *flowdock.Flow {
+	fl := f.Flow
+	o := f.org.Organization
+	o.Users = nil
+	fl.Organization = &o
+	if withUsers {
+		users := s.usersJSON(f.users)
+		fl.Users = &users
+	}
+	return &fl
+}
+
+func copyUser(u *flowdock.User) *flowdock.User {
+	c := *u
+	return &c
+}
+
+func appendUnique(ids []int, id int) []int {
+	for _, i := range ids {
+		if i == id {
+			return ids
+		}
+	}
+	ids = append(ids, id)
+	sort.Ints(ids)
+	return ids
+}
+
+func containsInt(ids []int, id int) bool {
+	i := sort.SearchInts(ids, id)
+	return i < len(ids) && ids[i] == id
+}
+
+func str(v string) *string {
+	return &v
+}
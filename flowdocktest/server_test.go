@@ -0,0 +1,384 @@
+package flowdocktest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// seed returns a server holding one organization "org" with a flow "flow"
+// and two members.
+func seed(t *testing.T) *Server {
+	s := NewServer()
+	s.AddOrganization("org", "Organization")
+	alice := s.AddUser("alice", "Alice", "alice@example.com")
+	bob := s.AddUser("bob", "Bob", "bob@example.com")
+	if _, err := s.AddFlow("org", "flow", *alice.Id, *bob.Id); err != nil {
+		t.Fatalf("AddFlow returned error: %v", err)
+	}
+	return s
+}
+
+func TestServer_Flows(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	flows, _, err := client.Flows.List(false, nil)
+	if err != nil {
+		t.Fatalf("Flows.List returned error: %v", err)
+	}
+	if len(flows) != 1 || *flows[0].ParameterizedName != "flow" {
+		t.Fatalf("Flows.List returned %+v, want the seeded flow", flows)
+	}
+	if *flows[0].Organization.ParameterizedName != "org" {
+		t.Errorf("Flows.List organization = %v, want org", *flows[0].Organization.ParameterizedName)
+	}
+
+	flow, _, err := client.Flows.GetById(*flows[0].Id)
+	if err != nil {
+		t.Fatalf("Flows.GetById returned error: %v", err)
+	}
+	if len(*flow.Users) != 2 {
+		t.Errorf("Flows.GetById returned %d users, want 2", len(*flow.Users))
+	}
+
+	created, _, err := client.Flows.Create("org", &flowdock.FlowsCreateOptions{Name: "New Flow"})
+	if err != nil {
+		t.Fatalf("Flows.Create returned error: %v", err)
+	}
+	if *created.ParameterizedName != "new-flow" || *created.Name != "New Flow" {
+		t.Errorf("Flows.Create returned %v/%v, want new-flow/New Flow", *created.ParameterizedName, *created.Name)
+	}
+
+	disabled := true
+	updated, _, err := client.Flows.Update("org", "new-flow", &flowdock.Flow{Disabled: &disabled})
+	if err != nil {
+		t.Fatalf("Flows.Update returned error: %v", err)
+	}
+	if !*updated.Disabled {
+		t.Errorf("Flows.Update did not disable the flow")
+	}
+
+	_, _, err = client.Flows.Get("org", "missing")
+	if err, ok := err.(*flowdock.ErrorResponse); !ok || err.Response.StatusCode != 404 {
+		t.Errorf("Flows.Get of a missing flow returned %v, want a 404", err)
+	}
+}
+
+func TestServer_Messages(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	for _, content := range []string{"first", "second #deploy", "third"} {
+		opt := &flowdock.MessagesCreateOptions{FlowID: "org:flow", Event: "message", Content: content}
+		if content == "second #deploy" {
+			opt.Tags = []string{"deploy"}
+		}
+		if _, _, err := client.Messages.Create(opt); err != nil {
+			t.Fatalf("Messages.Create returned error: %v", err)
+		}
+	}
+
+	messages, _, err := client.Messages.List("org", "flow", &flowdock.MessagesListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("Messages.List returned error: %v", err)
+	}
+	if got := contents(messages); !reflect.DeepEqual(got, []string{"second #deploy", "third"}) {
+		t.Errorf("Messages.List returned %v, want the latest two", got)
+	}
+
+	messages, _, _ = client.Messages.List("org", "flow", &flowdock.MessagesListOptions{SinceId: 1})
+	if got := contents(messages); !reflect.DeepEqual(got, []string{"second #deploy", "third"}) {
+		t.Errorf("Messages.List since_id returned %v, want the messages after the first", got)
+	}
+
+	messages, _, _ = client.Messages.List("org", "flow", &flowdock.MessagesListOptions{Tags: []string{"deploy"}})
+	if got := contents(messages); !reflect.DeepEqual(got, []string{"second #deploy"}) {
+		t.Errorf("Messages.List tags returned %v, want [second #deploy]", got)
+	}
+
+	messages, _, _ = client.Messages.List("org", "flow", &flowdock.MessagesListOptions{Search: "THIRD"})
+	if got := contents(messages); !reflect.DeepEqual(got, []string{"third"}) {
+		t.Errorf("Messages.List search returned %v, want [third]", got)
+	}
+
+	comment, _, err := client.Messages.CreateComment(&flowdock.MessagesCreateOptions{
+		FlowID:    "org:flow",
+		MessageID: 1,
+		Content:   "a comment",
+	})
+	if err != nil {
+		t.Fatalf("Messages.CreateComment returned error: %v", err)
+	}
+	content, ok := comment.Content().(*flowdock.CommentContent)
+	if !ok || *content.Title != "first" || *content.Text != "a comment" {
+		t.Errorf("Messages.CreateComment content = %+v, want title first and text a comment", comment.Content())
+	}
+	if !reflect.DeepEqual(*comment.Tags, []string{"influx:1"}) {
+		t.Errorf("Messages.CreateComment tags = %v, want [influx:1]", *comment.Tags)
+	}
+	if *comment.UserID != "1" {
+		t.Errorf("Messages.CreateComment user = %v, want 1", *comment.UserID)
+	}
+}
+
+func TestServer_Upload(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	opt := &flowdock.MessagesUploadOptions{FileName: "notes.txt", Tags: []string{"docs"}}
+	msg, _, err := client.Messages.Upload("org", "flow", strings.NewReader("hello"), opt)
+	if err != nil {
+		t.Fatalf("Messages.Upload returned error: %v", err)
+	}
+	content := msg.Content().(*flowdock.FileContent)
+	if *content.FileName != "notes.txt" || *content.FileSize != 5 || !strings.HasPrefix(*content.ContentType, "text/plain") {
+		t.Errorf("Messages.Upload returned %+v", content)
+	}
+
+	resp, err := http.Get(s.REST.URL + *content.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(data) != "hello" {
+		t.Errorf("GET %v = %v %q, want the uploaded file", *content.Path, resp.Status, data)
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+	flow, _, _ := client.Flows.Get("org", "flow")
+
+	s.RateLimit(1, 2*time.Second)
+	opt := &flowdock.MessagesCreateOptions{FlowID: *flow.Id, Event: "message", Content: "hi"}
+	_, resp, err := client.Messages.Create(opt)
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("Messages.Create while limited returned %v, %v; want 429 with Retry-After: 2", resp, err)
+	}
+	if _, _, err := client.Messages.Create(opt); err != nil {
+		t.Errorf("Messages.Create after the limit returned error: %v", err)
+	}
+}
+
+func TestServer_Users(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	users, _, err := client.Users.All()
+	if err != nil {
+		t.Fatalf("Users.All returned error: %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("Users.All returned %d users, want 2", len(users))
+	}
+
+	users, _, err = client.Users.List("org", "flow")
+	if err != nil {
+		t.Fatalf("Users.List returned error: %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("Users.List returned %d users, want 2", len(users))
+	}
+
+	user, _, err := client.Users.Get(2)
+	if err != nil {
+		t.Fatalf("Users.Get returned error: %v", err)
+	}
+	if *user.Nick != "bob" {
+		t.Errorf("Users.Get returned %v, want bob", *user.Nick)
+	}
+}
+
+func TestServer_Organizations(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	orgs, _, err := client.Organizations.All()
+	if err != nil {
+		t.Fatalf("Organizations.All returned error: %v", err)
+	}
+	if len(orgs) != 1 || *orgs[0].UserCount != 2 {
+		t.Errorf("Organizations.All returned %+v, want one organization with two users", orgs)
+	}
+
+	org, _, err := client.Organizations.GetByParameterizedName("org")
+	if err != nil {
+		t.Fatalf("Organizations.GetByParameterizedName returned error: %v", err)
+	}
+	if *org.Name != "Organization" {
+		t.Errorf("Organizations.GetByParameterizedName returned %v, want Organization", *org.Name)
+	}
+}
+
+func TestServer_Inbox(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	opt := &flowdock.InboxCreateOptions{
+		Source:      "ci",
+		FromAddress: "ci@example.com",
+		Subject:     "Build failed",
+		Content:     "<p>Build #1 failed</p>",
+		Tags:        []string{"ci"},
+	}
+	if _, _, err := client.Inbox.Create(s.FlowToken("org", "flow"), opt); err != nil {
+		t.Fatalf("Inbox.Create returned error: %v", err)
+	}
+
+	messages := s.Messages("org", "flow")
+	if len(messages) != 1 || *messages[0].Event != "mail" {
+		t.Fatalf("Inbox.Create stored %+v, want one mail message", messages)
+	}
+	if !reflect.DeepEqual(*messages[0].Tags, []string{"ci"}) {
+		t.Errorf("Inbox.Create tags = %v, want [ci]", *messages[0].Tags)
+	}
+
+	if _, _, err := client.Inbox.Create("bad-token", opt); err == nil {
+		t.Errorf("Inbox.Create with an unknown token expected an error")
+	}
+}
+
+func TestServer_Stream(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	stream, es, err := client.Messages.Stream("token", "org", "flow")
+	if err != nil {
+		t.Fatalf("Messages.Stream returned error: %v", err)
+	}
+	defer es.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Streams() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream never connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, _, err := client.Messages.Create(&flowdock.MessagesCreateOptions{FlowID: "org:flow", Content: "streamed"}); err != nil {
+		t.Fatalf("Messages.Create returned error: %v", err)
+	}
+
+	select {
+	case msg := <-stream:
+		if msg.Content().String() != "streamed" {
+			t.Errorf("stream delivered %v, want streamed", msg.Content())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream delivered nothing")
+	}
+}
+
+func contents(messages []flowdock.Message) []string {
+	var list []string
+	for _, m := range messages {
+		list = append(list, m.Content().String())
+	}
+	return list
+}
+
+func TestServer_StreamUpdatesDirectory(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	alice, err := client.Directory.UserByNick("alice")
+	if err != nil {
+		t.Fatalf("Directory.UserByNick returned error: %v", err)
+	}
+	flow, err := client.Directory.FlowByName("org", "flow")
+	if err != nil {
+		t.Fatalf("Directory.FlowByName returned error: %v", err)
+	}
+
+	stream, es, err := client.Messages.Stream("token", "org", "flow")
+	if err != nil {
+		t.Fatalf("Messages.Stream returned error: %v", err)
+	}
+	defer es.Close()
+	for s.Streams() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, _, err := client.Users.Update(*alice.Id, &flowdock.UserUpdateOptions{Nick: "ally"}); err != nil {
+		t.Fatalf("Users.Update returned error: %v", err)
+	}
+	name := "Renamed"
+	if _, _, err := client.Flows.Update("org", "flow", &flowdock.Flow{Name: &name}); err != nil {
+		t.Fatalf("Flows.Update returned error: %v", err)
+	}
+
+	for _, event := range []string{"user-edit", "flow-change"} {
+		select {
+		case msg := <-stream:
+			if *msg.Event != event {
+				t.Errorf("stream delivered %v, want %v", *msg.Event, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stream delivered no %v", event)
+		}
+	}
+
+	if nick := client.Directory.Nick(strconv.Itoa(*alice.Id)); nick != "ally" {
+		t.Errorf("Directory.Nick after user-edit = %v, want ally", nick)
+	}
+	if f, _ := client.Directory.Flow(*flow.Id); f == nil || *f.Name != "Renamed" {
+		t.Errorf("Directory.Flow after flow-change = %+v, want the new name", f)
+	}
+	if name := client.Directory.FlowName(*flow.Id); name != "org/flow" {
+		t.Errorf("Directory.FlowName after flow-change = %v, want org/flow", name)
+	}
+}
+
+func TestServer_Deliveries(t *testing.T) {
+	s := seed(t)
+	defer s.Close()
+	client := s.Client()
+
+	stream, es, err := client.Messages.Stream("token", "org", "flow")
+	if err != nil {
+		t.Fatalf("Messages.Stream returned error: %v", err)
+	}
+	defer es.Close()
+	go func() {
+		for range stream {
+		}
+	}()
+	for s.Streams() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	opt := &flowdock.MessagesCreateOptions{FlowID: "org:flow", Event: "message", Content: "build failed"}
+	sent, _, err := client.Messages.Create(opt)
+	if err != nil {
+		t.Fatalf("Messages.Create returned error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	echo, err := client.Deliveries.Wait(ctx, opt.UUID)
+	if err != nil {
+		t.Fatalf("Deliveries.Wait returned error: %v", err)
+	}
+	if *echo.ID != *sent.ID {
+		t.Errorf("Deliveries.Wait returned message %d, want %d", *echo.ID, *sent.ID)
+	}
+}
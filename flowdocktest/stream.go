@@ -0,0 +1,139 @@
+package flowdocktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// subscriber is an open EventSource connection following a set of flows.
+type subscriber struct {
+	flows  map[string]bool
+	mu     sync.Mutex
+	queue  []flowdock.Message
+	notify chan struct{}
+}
+
+func (sub *subscriber) push(m flowdock.Message) {
+	sub.mu.Lock()
+	sub.queue = append(sub.queue, m)
+	sub.mu.Unlock()
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscriber) pop() []flowdock.Message {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	queue := sub.queue
+	sub.queue = nil
+	return queue
+}
+
+func (s *Server) streamHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /flows/{org}/{flow}", func(w http.ResponseWriter, r *http.Request) {
+		s.serveStream(w, r, []string{r.PathValue("org") + "/" + r.PathValue("flow")})
+	})
+	mux.HandleFunc("GET /flows", func(w http.ResponseWriter, r *http.Request) {
+		s.serveStream(w, r, splitList(r.URL.Query().Get("filter")))
+	})
+	return mux
+}
+
+// serveStream sends every message published to the named flows as a
+// text/event-stream until the client goes away or the server is closed.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, names []string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	sub := &subscriber{flows: map[string]bool{}, notify: make(chan struct{}, 1)}
+	s.mu.Lock()
+	for _, name := range names {
+		org, flowName, _ := strings.Cut(name, "/")
+		f := s.findFlow(org, flowName)
+		if f == nil {
+			s.mu.Unlock()
+			writeError(w, http.StatusNotFound, "Flow not found")
+			return
+		}
+		sub.flows[*f.Id] = true
+	}
+	s.subscribers[sub] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, sub)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-sub.notify:
+		}
+
+		for _, m := range sub.pop() {
+			data, err := json.Marshal(m)
+			if err != nil {
+				return
+			}
+			if m.ID != nil {
+				fmt.Fprintf(w, "id: %d\n", *m.ID)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+// publish delivers m to every stream following f. s.mu must be held.
+func (s *Server) publish(f *flow, m flowdock.Message) {
+	for sub := range s.subscribers {
+		if sub.flows[*f.Id] {
+			sub.push(m)
+		}
+	}
+}
+
+// publishEvent delivers an event that is not stored in the flow, like
+// user-edit, to the streams following f. s.mu must be held.
+func (s *Server) publishEvent(f *flow, event string, userID int, content interface{}) {
+	data, _ := json.Marshal(content)
+	raw := json.RawMessage(data)
+	s.publish(f, flowdock.Message{
+		FlowID:     f.Id,
+		Sent:       &flowdock.Time{Time: s.Now()},
+		UserID:     str(strconv.Itoa(userID)),
+		Event:      &event,
+		RawContent: &raw,
+	})
+}
+
+// Streams returns the number of open stream connections. Tests can poll it
+// to know when a client started by MessagesService.Stream is listening.
+func (s *Server) Streams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers)
+}
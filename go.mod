@@ -0,0 +1,11 @@
+module github.com/wm/go-flowdock
+
+go 1.24.0
+
+require (
+	github.com/bernerdschaefer/eventsource v0.0.0-20130606115634-220e99a79763
+	github.com/codegangsta/cli v1.20.0
+	github.com/google/go-querystring v1.1.0
+	golang.org/x/oauth2 v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,110 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache stores serialized responses by key. Implementations must be safe
+// for concurrent use.
+type Cache interface {
+	// Get returns the data stored under key and whether there was any.
+	Get(key string) ([]byte, bool)
+
+	// Set stores data under key, replacing what was there.
+	Set(key string, data []byte)
+
+	// Delete removes the data stored under key, if any.
+	Delete(key string)
+}
+
+// MemoryCache is a Cache keeping responses in memory for the life of the
+// process.
+type MemoryCache struct {
+	mu    sync.RWMutex
+	items map[string][]byte
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{items: make(map[string][]byte)}
+}
+
+// Get implements the Cache interface.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.items[key]
+	return data, ok
+}
+
+// Set implements the Cache interface.
+func (c *MemoryCache) Set(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = data
+}
+
+// Delete implements the Cache interface.
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+}
+
+// DiskCache is a Cache keeping each response in a file of a directory, so
+// the cache survives between runs of a program. Files are named after a
+// hash of their key. Failing to read or write a file is treated as a miss.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache storing files in dir, creating it if
+// needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Get implements the Cache interface.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set implements the Cache interface. The file is replaced atomically, so
+// concurrent readers see either version.
+func (c *DiskCache) Set(key string, data []byte) {
+	f, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete implements the Cache interface.
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,213 @@
+// Package httpcache provides an http.RoundTripper that caches Flowdock API
+// responses and revalidates them with conditional requests.
+//
+// Listing flows, users and organizations mostly returns what the previous
+// call did. The transport stores each response carrying an ETag or a
+// Last-Modified date and asks again with If-None-Match and If-Modified-Since;
+// a 304 Not Modified is answered from the cache:
+//
+//	t := httpcache.New(httpcache.NewMemoryCache(), nil)
+//	client := flowdock.NewClient(t.Client())
+//	flows, resp, err := client.Flows.List(true, nil)
+//	if httpcache.FromCache(resp) { ... }
+//
+// Only GET requests are cached. Responses are keyed by URL and by the
+// credentials the transport sees, in the URL or the Authorization header,
+// so clients with different tokens sharing a cache never see each other's
+// data. Other methods invalidate the entry for their URL.
+//
+// The transport must therefore be below the one adding the credentials. With
+// oauth2, pass it as the base client in the context, so the token is set
+// before the request reaches the cache:
+//
+//	ctx = context.WithValue(ctx, oauth2.HTTPClient, t.Client())
+//	client := flowdock.NewClient(oauth2.NewClient(ctx, tokenSource))
+//
+// A transport sending requests with credentials added after it, as in
+// New(cache, oauth2Client.Transport), keys every client's responses alike.
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+const (
+	// XFromCache is set to "1" on responses served from the cache.
+	XFromCache = "X-From-Cache"
+
+	// staleWarning is added to cached responses served because revalidation
+	// failed, as in RFC 7234.
+	staleWarning = `111 - "Revalidation Failed"`
+)
+
+// Transport is an http.RoundTripper caching the responses of GET requests.
+type Transport struct {
+	// StaleIfError serves the cached response when revalidating it fails
+	// with a network error or a 5xx status. Such responses carry a Warning
+	// header; see Stale.
+	StaleIfError bool
+
+	cache Cache
+	base  http.RoundTripper
+}
+
+// New returns a Transport storing responses in cache. base sends the
+// requests; if nil, http.DefaultTransport is used. base must not add
+// credentials to the requests, which would not be part of the cache keys.
+func New(cache Cache, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{cache: cache, base: base}
+}
+
+// Client returns an http.Client using the Transport, ready to be passed to
+// flowdock.NewClient.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// FromCache reports whether resp was served from the cache, after a 304 or
+// because revalidation failed.
+func FromCache(resp *http.Response) bool {
+	return resp != nil && resp.Header.Get(XFromCache) == "1"
+}
+
+// Stale reports whether resp was served from the cache without the server
+// confirming it is current.
+func Stale(resp *http.Response) bool {
+	return FromCache(resp) && resp.Header.Get("Warning") == staleWarning
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+	if req.Method != http.MethodGet {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode < 400 {
+			t.cache.Delete(key)
+		}
+		return resp, err
+	}
+	if !cacheable(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	cached := t.cached(req, key)
+	if cached != nil {
+		req = conditional(req, cached)
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case cached != nil && err == nil && resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		for _, k := range []string{"Date", "Etag", "Last-Modified", "Cache-Control", "Expires"} {
+			if v := resp.Header.Get(k); v != "" {
+				cached.Header.Set(k, v)
+			}
+		}
+		t.store(key, cached)
+		cached.Header.Set(XFromCache, "1")
+		return cached, nil
+
+	case cached != nil && t.StaleIfError && (err != nil || resp.StatusCode >= 500):
+		if err == nil {
+			resp.Body.Close()
+		}
+		cached.Header.Set(XFromCache, "1")
+		cached.Header.Set("Warning", staleWarning)
+		return cached, nil
+
+	case err != nil:
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK && validated(resp) && !noStore(resp.Header) {
+		if err := t.store(key, resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	} else if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		t.cache.Delete(key)
+	}
+	return resp, nil
+}
+
+// cached returns the stored response for key, or nil.
+func (t *Transport) cached(req *http.Request, key string) *http.Response {
+	data, ok := t.cache.Get(key)
+	if !ok {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		t.cache.Delete(key)
+		return nil
+	}
+	return resp
+}
+
+// store saves resp under key, reading its body and replacing it with a
+// copy so the caller can still read it.
+func (t *Transport) store(key string, resp *http.Response) error {
+	resp.Header.Del(XFromCache)
+	resp.Header.Del("Warning")
+	data, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	t.cache.Set(key, data)
+	return nil
+}
+
+// cacheKey identifies the resource requested and the credentials it was
+// requested with. The credentials are hashed; tokens never reach the cache.
+func cacheKey(req *http.Request) string {
+	u := *req.URL
+	h := sha256.New()
+	if u.User != nil {
+		h.Write([]byte(u.User.String()))
+		u.User = nil
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(req.Header.Get("Authorization")))
+	return u.String() + " " + hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// cacheable reports whether a GET request may be answered from the cache.
+// Event streams, partial requests and requests carrying their own
+// conditions go straight to the server.
+func cacheable(req *http.Request) bool {
+	return !strings.Contains(req.Header.Get("Accept"), "text/event-stream") &&
+		req.Header.Get("Range") == "" &&
+		req.Header.Get("If-None-Match") == "" &&
+		req.Header.Get("If-Modified-Since") == "" &&
+		!noStore(req.Header)
+}
+
+// conditional returns a copy of req asking for the resource only if it
+// changed since cached.
+func conditional(req *http.Request, cached *http.Response) *http.Request {
+	req = req.Clone(req.Context())
+	if etag := cached.Header.Get("Etag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := cached.Header.Get("Last-Modified"); modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+	return req
+}
+
+func validated(resp *http.Response) bool {
+	return resp.Header.Get("Etag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+func noStore(h http.Header) bool {
+	return strings.Contains(h.Get("Cache-Control"), "no-store")
+}
@@ -0,0 +1,216 @@
+package httpcache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"golang.org/x/oauth2"
+)
+
+// etagServer serves a flow list whose ETag is its version, counting the
+// requests and the 304s it answers.
+type etagServer struct {
+	*httptest.Server
+	mu                  sync.Mutex
+	version             int
+	requests, unchanged int
+	fail                bool
+}
+
+func newEtagServer(t *testing.T) *etagServer {
+	s := &etagServer{version: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		if s.fail {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		switch r.Method {
+		case "POST":
+			s.version++
+			w.WriteHeader(http.StatusCreated)
+			return
+		case "GET":
+		default:
+			t.Errorf("unexpected %v request", r.Method)
+		}
+		etag := fmt.Sprintf(`"v%d"`, s.version)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			s.unchanged++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, `[{"id": "f%d"}]`, s.version)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *etagServer) client(t *Transport, token string) *flowdock.Client {
+	c := flowdock.NewClient(t.Client())
+	c.RestURL, _ = url.Parse(strings.Replace(s.URL, "http://", "http://"+token+"@", 1) + "/")
+	return c
+}
+
+func listFlow(t *testing.T, c *flowdock.Client) (string, *http.Response) {
+	flows, resp, err := c.Flows.List(false, nil)
+	if err != nil {
+		t.Fatalf("Flows.List returned error: %v", err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("Flows.List returned %+v", flows)
+	}
+	return *flows[0].Id, resp
+}
+
+func TestTransport(t *testing.T) {
+	srv := newEtagServer(t)
+	client := srv.client(New(NewMemoryCache(), nil), "token")
+
+	id, resp := listFlow(t, client)
+	if id != "f1" || FromCache(resp) {
+		t.Errorf("first request returned %v, from cache %v", id, FromCache(resp))
+	}
+	id, resp = listFlow(t, client)
+	if id != "f1" || !FromCache(resp) || Stale(resp) {
+		t.Errorf("second request returned %v, from cache %v, stale %v", id, FromCache(resp), Stale(resp))
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("cached response has status %v, want 200", resp.StatusCode)
+	}
+	if srv.unchanged != 1 {
+		t.Errorf("server answered %d requests with 304, want 1", srv.unchanged)
+	}
+
+	// a POST to the same URL changes the flows and drops the entry
+	req, _ := client.NewRequest("POST", "flows", nil)
+	if _, err := client.Do(req, nil); err != nil {
+		t.Fatalf("POST returned error: %v", err)
+	}
+	id, resp = listFlow(t, client)
+	if id != "f2" || FromCache(resp) {
+		t.Errorf("request after a change returned %v, from cache %v", id, FromCache(resp))
+	}
+	if srv.requests != 4 {
+		t.Errorf("server got %d requests, want 4", srv.requests)
+	}
+}
+
+func TestTransport_identity(t *testing.T) {
+	srv := newEtagServer(t)
+	tr := New(NewMemoryCache(), nil)
+
+	listFlow(t, srv.client(tr, "alice"))
+	if _, resp := listFlow(t, srv.client(tr, "bob")); FromCache(resp) {
+		t.Error("a client with another token was served the cached response")
+	}
+	if _, resp := listFlow(t, srv.client(tr, "alice")); !FromCache(resp) {
+		t.Error("the first client was not served its cached response")
+	}
+}
+
+func TestTransport_oauth2(t *testing.T) {
+	var fail bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, `[{"id": %q}]`, token)
+	}))
+	defer srv.Close()
+
+	tr := New(NewMemoryCache(), nil)
+	tr.StaleIfError = true
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tr.Client())
+	client := func(token string) *flowdock.Client {
+		c := flowdock.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+		c.RestURL, _ = url.Parse(srv.URL + "/")
+		return c
+	}
+	alice, bob := client("alice"), client("bob")
+
+	if id, _ := listFlow(t, alice); id != "alice" {
+		t.Errorf("first client listed %v, want alice", id)
+	}
+	if id, resp := listFlow(t, bob); id != "bob" || FromCache(resp) {
+		t.Errorf("second client listed %v, from cache %v", id, FromCache(resp))
+	}
+
+	fail = true
+	if id, resp := listFlow(t, alice); id != "alice" || !Stale(resp) {
+		t.Errorf("first client listed %v while the server is down, stale %v", id, Stale(resp))
+	}
+	if id, resp := listFlow(t, bob); id != "bob" || !Stale(resp) {
+		t.Errorf("second client listed %v while the server is down, stale %v", id, Stale(resp))
+	}
+}
+
+func TestTransport_staleIfError(t *testing.T) {
+	srv := newEtagServer(t)
+	tr := New(NewMemoryCache(), nil)
+	client := srv.client(tr, "token")
+	listFlow(t, client)
+
+	srv.fail = true
+	if _, _, err := client.Flows.List(false, nil); err == nil {
+		t.Error("Flows.List during an outage returned no error without StaleIfError")
+	}
+
+	tr.StaleIfError = true
+	id, resp := listFlow(t, client)
+	if id != "f1" || !Stale(resp) {
+		t.Errorf("Flows.List during an outage returned %v, stale %v", id, Stale(resp))
+	}
+
+	srv.fail = false
+	if _, resp := listFlow(t, client); Stale(resp) {
+		t.Error("response after the outage is still stale")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	srv := newEtagServer(t)
+	dir := t.TempDir()
+
+	cache, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache returned error: %v", err)
+	}
+	listFlow(t, srv.client(New(cache, nil), "token"))
+
+	// a new process reusing the directory
+	cache, err = NewDiskCache(dir)
+	if err != nil {
+		t.Fatalf("NewDiskCache returned error: %v", err)
+	}
+	id, resp := listFlow(t, srv.client(New(cache, nil), "token"))
+	if id != "f1" || !FromCache(resp) {
+		t.Errorf("request with a reopened cache returned %v, from cache %v", id, FromCache(resp))
+	}
+
+	cache.Set("key", []byte("data"))
+	if data, ok := cache.Get("key"); !ok || string(data) != "data" {
+		t.Errorf("Get returned %q, %v", data, ok)
+	}
+	cache.Delete("key")
+	if _, ok := cache.Get("key"); ok {
+		t.Error("Get after Delete found the data")
+	}
+}
@@ -0,0 +1,199 @@
+// Package metrics exports Prometheus metrics about a flowdock.Client: the
+// requests sent by each service method, their latencies and errors, and the
+// health of the client's event streams.
+//
+//	m := metrics.New()
+//	m.Instrument(client)
+//	http.Handle("/metrics", m)
+//
+// Metrics are served in the Prometheus text exposition format and need no
+// Prometheus client library.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request duration
+// histograms.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// LagBuckets are the upper bounds, in seconds, of the stream lag histograms.
+var LagBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Metrics collects the metrics of one or more clients. It is an
+// http.Handler serving them.
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[[2]string]float64 // by method and code
+	errors    map[[2]string]float64 // by method and class
+	durations map[string]*histogram // by method
+	streams   map[string]*stream
+}
+
+type stream struct {
+	state        flowdock.StreamState
+	reconnects   float64
+	messages     float64
+	decodeErrors float64
+	failures     float64
+	lastMessage  time.Time
+	lag          *histogram
+}
+
+// New returns a Metrics with no samples.
+func New() *Metrics {
+	return &Metrics{
+		requests:  make(map[[2]string]float64),
+		errors:    make(map[[2]string]float64),
+		durations: make(map[string]*histogram),
+		streams:   make(map[string]*stream),
+	}
+}
+
+// Instrument records the requests of c and the streams it opens afterwards.
+func (m *Metrics) Instrument(c *flowdock.Client) {
+	c.Use(m.Middleware())
+	c.StreamObserver = m
+}
+
+// Middleware returns middleware recording every request.
+func (m *Metrics) Middleware() flowdock.Middleware {
+	return flowdock.AfterResponse(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		method := Method(req)
+		code := "error"
+		if resp != nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[[2]string{method, code}]++
+		if class := ErrorClass(resp, err); class != "" {
+			m.errors[[2]string{method, class}]++
+		}
+		h, ok := m.durations[method]
+		if !ok {
+			h = newHistogram(DefaultBuckets)
+			m.durations[method] = h
+		}
+		h.observe(d.Seconds())
+	})
+}
+
+// StreamState implements the flowdock.StreamObserver interface.
+func (m *Metrics) StreamState(name string, state flowdock.StreamState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stream(name)
+	if s.state == flowdock.StreamConnected && state == flowdock.StreamConnecting {
+		s.reconnects++
+	}
+	s.state = state
+}
+
+// StreamMessage implements the flowdock.StreamObserver interface.
+func (m *Metrics) StreamMessage(name string, _ flowdock.Message, lag time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stream(name)
+	s.messages++
+	s.lastMessage = time.Now()
+	if lag > 0 {
+		s.lag.observe(lag.Seconds())
+	}
+}
+
+// StreamDecodeError implements the flowdock.StreamObserver interface.
+func (m *Metrics) StreamDecodeError(name string, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stream(name).decodeErrors++
+}
+
+// StreamError implements the flowdock.StreamObserver interface.
+func (m *Metrics) StreamError(name string, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stream(name).failures++
+}
+
+// stream returns the metrics of the named stream. m.mu must be held.
+func (m *Metrics) stream(name string) *stream {
+	s, ok := m.streams[name]
+	if !ok {
+		s = &stream{lag: newHistogram(LagBuckets)}
+		m.streams[name] = s
+	}
+	return s
+}
+
+// methods names the service method sending each route.
+var methods = map[string]string{
+	"GET /flows":                            "Flows.List",
+	"GET /flows/all":                        "Flows.List",
+	"GET /flows/:org/:flow":                 "Flows.Get",
+	"GET /flows/find":                       "Flows.GetById",
+	"POST /flows/:org":                      "Flows.Create",
+	"PUT /flows/:org/:flow":                 "Flows.Update",
+	"GET /flows/:org/:flow/messages/:id":    "Messages.Get",
+	"GET /flows/:org/:flow/messages":        "Messages.List",
+	"POST /comments":                        "Messages.CreateComment",
+	"POST /messages":                        "Messages.Create",
+	"POST /flows/:org/:flow/messages":       "Messages.Upload",
+	"GET /flows/:org/:flow/files/:id/:name": "Messages.Download",
+	"GET /users":                            "Users.All",
+	"GET /flows/:org/:flow/users":           "Users.List",
+	"GET /users/:id":                        "Users.Get",
+	"PUT /users/:id":                        "Users.Update",
+	"GET /organizations":                    "Organizations.All",
+	"GET /organizations/:org":               "Organizations.GetByParameterizedName",
+	"GET /organizations/find":               "Organizations.GetById",
+	"PUT /organizations/:org":               "Organizations.Update",
+	"POST /v1/messages/team_inbox/:token":   "Inbox.Create",
+}
+
+// Method returns the name of the service method sending req, such as
+// "Flows.List", or its flowdock.Route for requests sent otherwise.
+func Method(req *http.Request) string {
+	route := flowdock.Route(req)
+	if name, ok := methods[route]; ok {
+		return name
+	}
+	return route
+}
+
+// ErrorClass classifies a failed request: "timeout", "canceled" or
+// "network" when no response arrived, and "rate_limited", "auth", "client"
+// or "server" by the response status. It returns "" for successful requests.
+func ErrorClass(resp *http.Response, err error) string {
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			return "timeout"
+		case errors.Is(err, context.Canceled):
+			return "canceled"
+		}
+		return "network"
+	}
+	switch code := resp.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		return "rate_limited"
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return "auth"
+	case code >= 500:
+		return "server"
+	case code >= 400:
+		return "client"
+	}
+	return ""
+}
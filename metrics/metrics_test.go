@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/flowdocktest"
+)
+
+func exposition(t *testing.T, m *Metrics) string {
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	}
+	return b.String()
+}
+
+func wantLines(t *testing.T, text string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(text, "\n"+line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := flowdocktest.NewServer()
+	defer srv.Close()
+	srv.AddOrganization("org", "Organization")
+	alice := srv.AddUser("alice", "Alice", "alice@example.com")
+	if _, err := srv.AddFlow("org", "flow", *alice.Id); err != nil {
+		t.Fatal(err)
+	}
+	srv.Now = func() time.Time { return time.Now().Add(-20 * time.Second) }
+
+	m := New()
+	client := srv.Client()
+	m.Instrument(client)
+
+	client.Flows.List(false, nil)
+	client.Flows.List(false, nil)
+	client.Users.Get(99)
+
+	stream, es, err := client.Messages.Stream("token", "org", "flow")
+	if err != nil {
+		t.Fatalf("Messages.Stream returned error: %v", err)
+	}
+	for srv.Streams() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	event, raw := "message", json.RawMessage(`"hello"`)
+	srv.AddMessage("org", "flow", flowdock.Message{Event: &event, RawContent: &raw})
+	<-stream
+	wantLines(t, exposition(t, m), `flowdock_stream_state{stream="org/flow",state="connected"} 1`)
+
+	es.Close()
+	for range stream {
+	}
+
+	wantLines(t, exposition(t, m),
+		`flowdock_client_requests_total{method="Flows.List",code="200"} 2`,
+		`flowdock_client_requests_total{method="Users.Get",code="404"} 1`,
+		`flowdock_client_request_errors_total{method="Users.Get",class="client"} 1`,
+		`flowdock_client_request_duration_seconds_count{method="Flows.List"} 2`,
+		`flowdock_client_request_duration_seconds_bucket{method="Flows.List",le="+Inf"} 2`,
+		`flowdock_stream_state{stream="org/flow",state="connected"} 0`,
+		`flowdock_stream_state{stream="org/flow",state="closed"} 1`,
+		`flowdock_stream_messages_total{stream="org/flow"} 1`,
+		`flowdock_stream_reconnects_total{stream="org/flow"} 0`,
+		`flowdock_stream_lag_seconds_bucket{stream="org/flow",le="10"} 0`,
+		`flowdock_stream_lag_seconds_bucket{stream="org/flow",le="30"} 1`,
+		`flowdock_stream_lag_seconds_count{stream="org/flow"} 1`,
+	)
+}
+
+func TestMetrics_streamObserver(t *testing.T) {
+	m := New()
+	for _, state := range []flowdock.StreamState{
+		flowdock.StreamConnecting, flowdock.StreamConnected,
+		flowdock.StreamConnecting, flowdock.StreamConnecting, flowdock.StreamConnected,
+		flowdock.StreamConnecting, flowdock.StreamConnected,
+	} {
+		m.StreamState(`a "quoted" name`, state)
+	}
+	m.StreamDecodeError(`a "quoted" name`, errors.New("bad event"))
+	m.StreamError(`a "quoted" name`, errors.New("unauthorized"))
+
+	wantLines(t, exposition(t, m),
+		`flowdock_stream_reconnects_total{stream="a \"quoted\" name"} 2`,
+		`flowdock_stream_decode_errors_total{stream="a \"quoted\" name"} 1`,
+		`flowdock_stream_errors_total{stream="a \"quoted\" name"} 1`,
+		`flowdock_stream_state{stream="a \"quoted\" name",state="connected"} 1`,
+	)
+}
+
+func TestMetrics_ServeHTTP(t *testing.T) {
+	w := httptest.NewRecorder()
+	New().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %v, want %v", ct, ContentType)
+	}
+	if !strings.HasPrefix(w.Body.String(), "# HELP flowdock_client_requests_total ") {
+		t.Errorf("body starts with %.40q", w.Body.String())
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorClass(t *testing.T) {
+	status := func(code int) *http.Response { return &http.Response{StatusCode: code} }
+	tests := []struct {
+		resp  *http.Response
+		err   error
+		class string
+	}{
+		{status(200), nil, ""},
+		{status(304), nil, ""},
+		{status(401), nil, "auth"},
+		{status(404), nil, "client"},
+		{status(429), nil, "rate_limited"},
+		{status(502), nil, "server"},
+		{nil, errors.New("connection refused"), "network"},
+		{nil, timeoutError{}, "timeout"},
+		{nil, context.DeadlineExceeded, "timeout"},
+		{nil, context.Canceled, "canceled"},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.resp, tt.err); got != tt.class {
+			t.Errorf("ErrorClass(%v, %v) = %q, want %q", tt.resp, tt.err, got, tt.class)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	bounds []float64
+	counts []float64 // by bound, not cumulative
+	count  float64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]float64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format, sorted by
+// metric and labels.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.family("flowdock_client_requests_total", "counter", "API requests sent, by service method and status code.")
+	for _, k := range sortedPairs(m.requests) {
+		e.sample("flowdock_client_requests_total", m.requests[k], "method", k[0], "code", k[1])
+	}
+	e.family("flowdock_client_request_errors_total", "counter", "API requests that failed, by service method and error class.")
+	for _, k := range sortedPairs(m.errors) {
+		e.sample("flowdock_client_request_errors_total", m.errors[k], "method", k[0], "class", k[1])
+	}
+	e.family("flowdock_client_request_duration_seconds", "histogram", "Time until the response headers of API requests arrived.")
+	var methodNames []string
+	for method := range m.durations {
+		methodNames = append(methodNames, method)
+	}
+	sort.Strings(methodNames)
+	for _, method := range methodNames {
+		e.histogram("flowdock_client_request_duration_seconds", m.durations[method], "method", method)
+	}
+
+	var names []string
+	for name := range m.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	e.family("flowdock_stream_state", "gauge", "Connection state of streams: 1 for the current state, 0 for the others.")
+	for _, name := range names {
+		for _, state := range []flowdock.StreamState{flowdock.StreamConnecting, flowdock.StreamConnected, flowdock.StreamClosed} {
+			v := 0.0
+			if m.streams[name].state == state {
+				v = 1
+			}
+			e.sample("flowdock_stream_state", v, "stream", name, "state", state.String())
+		}
+	}
+	counters := []struct {
+		name, help string
+		value      func(*stream) float64
+	}{
+		{"flowdock_stream_reconnects_total", "Times streams reconnected after being connected.", func(s *stream) float64 { return s.reconnects }},
+		{"flowdock_stream_messages_total", "Messages received by streams.", func(s *stream) float64 { return s.messages }},
+		{"flowdock_stream_decode_errors_total", "Stream events dropped because they could not be decoded.", func(s *stream) float64 { return s.decodeErrors }},
+		{"flowdock_stream_errors_total", "Streams stopped by an error rather than closed.", func(s *stream) float64 { return s.failures }},
+	}
+	for _, c := range counters {
+		e.family(c.name, "counter", c.help)
+		for _, name := range names {
+			e.sample(c.name, c.value(m.streams[name]), "stream", name)
+		}
+	}
+	e.family("flowdock_stream_last_message_timestamp_seconds", "gauge", "Unix time the last message of streams was received.")
+	for _, name := range names {
+		if t := m.streams[name].lastMessage; !t.IsZero() {
+			e.sample("flowdock_stream_last_message_timestamp_seconds", float64(t.UnixNano())/1e9, "stream", name)
+		}
+	}
+	e.family("flowdock_stream_lag_seconds", "histogram", "Time between messages being sent and received by streams.")
+	for _, name := range names {
+		e.histogram("flowdock_stream_lag_seconds", m.streams[name].lag, "stream", name)
+	}
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.n, e.err
+}
+
+// encoder writes the text format, keeping the first error.
+type encoder struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (e *encoder) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(e.w, format, args...)
+	e.n += int64(n)
+	e.err = err
+}
+
+func (e *encoder) family(name, typ, help string) {
+	e.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample; labels are name and value pairs.
+func (e *encoder) sample(name string, v float64, labels ...string) {
+	e.printf("%s%s %s\n", name, formatLabels(labels), formatValue(v))
+}
+
+func (e *encoder) histogram(name string, h *histogram, labels ...string) {
+	cumulative := 0.0
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		e.sample(name+"_bucket", cumulative, append(labels, "le", formatValue(bound))...)
+	}
+	e.sample(name+"_bucket", h.count, append(labels, "le", "+Inf")...)
+	e.sample(name+"_sum", h.sum, labels...)
+	e.sample(name+"_count", h.count, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedPairs(m map[[2]string]float64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
@@ -0,0 +1,558 @@
+// Package outbox queues messages to post to Flowdock, for programs such as
+// alerting systems that may send bursts of them.
+//
+//	s, err := outbox.New(client, &outbox.Options{
+//		SpoolDir: "/var/spool/alerts",
+//		OnStatus: func(st outbox.Status) { log.Println(st.ID, st.State, st.Err) },
+//	})
+//	id, err := s.Send(&flowdock.MessagesCreateOptions{FlowID: flowID, Content: "disk full on db1"})
+//	...
+//	err = s.Close(ctx)
+//
+// Messages are posted in the order they were queued, one flow at a time:
+// a message is only posted once the previous one to its flow has its final
+// status. Failures that may pass and left the message unposted, rate
+// limiting and failures to connect to Flowdock, are retried with backoff
+// without reordering the flow. Other failures, such as server errors and
+// connections lost while posting, may follow a post Flowdock accepted, so the
+// message fails rather than risk being posted twice. When
+// CoalesceAt or more chat messages wait for a flow, they are posted as one
+// summary instead.
+//
+// With a SpoolDir, queued messages are kept on disk until their final
+// status, so those queued while Flowdock is unreachable survive a restart
+// and are posted by the next Sender using the directory.
+package outbox
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// State is the final state of a queued message.
+type State int
+
+const (
+	// Sent messages were posted to their flow.
+	Sent State = iota
+
+	// Coalesced messages were posted as part of a summary.
+	Coalesced
+
+	// Failed messages were rejected by Flowdock, failed in a way that may
+	// have posted them, or could not be posted in MaxAttempts attempts.
+	Failed
+
+	// Abandoned messages were still queued when the Sender was closed. With
+	// a SpoolDir, they stay spooled for the next Sender.
+	Abandoned
+)
+
+func (s State) String() string {
+	switch s {
+	case Sent:
+		return "sent"
+	case Coalesced:
+		return "coalesced"
+	case Failed:
+		return "failed"
+	case Abandoned:
+		return "abandoned"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Status reports the final state of a queued message.
+type Status struct {
+	ID    string // as returned by Send or SendInbox
+	State State
+
+	// Message is the message posted, or the summary it was part of. It is
+	// nil unless the message was sent or coalesced.
+	Message *flowdock.Message
+
+	// Attempts is how many times the message, or its summary, was posted.
+	Attempts int
+
+	// Err is the last error posting the message.
+	Err error
+}
+
+// Options specifies the optional parameters to New.
+type Options struct {
+	// SpoolDir, if set, is a directory keeping queued messages until their
+	// final status. It is created if missing.
+	SpoolDir string
+
+	// CoalesceAt is how many chat messages must wait for a flow for them
+	// to be posted as one summary, 10 when zero. Comments, messages with
+	// other events and inbox messages are never coalesced. A negative
+	// CoalesceAt turns coalescing off.
+	CoalesceAt int
+
+	// MinBackoff and MaxBackoff bound the delay before a failed message is
+	// posted again, 1s and 5m when zero. The delay doubles with each
+	// attempt, or is as long as the Retry-After header of a 429 response.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxAttempts, if not zero, is how many times a message is posted
+	// before it fails. Otherwise it is retried until the Sender is closed.
+	MaxAttempts int
+
+	// OnStatus, if set, is called with the final status of every message.
+	// It is called from the Sender's goroutines, in order for each flow.
+	OnStatus func(Status)
+}
+
+// ErrClosed is returned by Send and SendInbox once Close was called.
+var ErrClosed = errors.New("outbox: sender closed")
+
+// Sender queues messages and posts them in the background.
+type Sender struct {
+	client *flowdock.Client
+	opt    Options
+
+	mu     sync.Mutex
+	queues map[string]*queue // by flow ID, or "inbox/" + flow API token
+	seq    uint64
+	closed bool
+	wg     sync.WaitGroup
+	stop   chan struct{}
+}
+
+type queue struct {
+	items   []*item
+	running bool
+}
+
+// item is a queued message, as spooled.
+type item struct {
+	ID      string                          `json:"id"`
+	Seq     uint64                          `json:"seq"`
+	Message *flowdock.MessagesCreateOptions `json:"message,omitempty"`
+	Token   string                          `json:"token,omitempty"`
+	Inbox   *flowdock.InboxCreateOptions    `json:"inbox,omitempty"`
+}
+
+func (it *item) key() string {
+	if it.Inbox != nil {
+		return "inbox/" + it.Token
+	}
+	return it.Message.FlowID
+}
+
+// coalescible reports whether it is a plain chat message.
+func (it *item) coalescible() bool {
+	m := it.Message
+	return m != nil && (m.Event == "" || m.Event == "message") && m.MessageID == 0 && m.ExternalUserName == ""
+}
+
+// New returns a Sender posting messages with client. Messages left in
+// opt.SpoolDir by a previous Sender are queued again.
+func New(client *flowdock.Client, opt *Options) (*Sender, error) {
+	s := &Sender{client: client, queues: map[string]*queue{}, stop: make(chan struct{})}
+	if opt != nil {
+		s.opt = *opt
+	}
+	if s.opt.CoalesceAt == 0 {
+		s.opt.CoalesceAt = 10
+	}
+	if s.opt.MinBackoff == 0 {
+		s.opt.MinBackoff = time.Second
+	}
+	if s.opt.MaxBackoff == 0 {
+		s.opt.MaxBackoff = 5 * time.Minute
+	}
+	if s.opt.MinBackoff > s.opt.MaxBackoff {
+		return nil, fmt.Errorf("outbox: MinBackoff %v is over MaxBackoff %v", s.opt.MinBackoff, s.opt.MaxBackoff)
+	}
+
+	if s.opt.SpoolDir != "" {
+		items, err := s.loadSpool()
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		for _, it := range items {
+			if it.Seq > s.seq {
+				s.seq = it.Seq
+			}
+			s.enqueue(it)
+		}
+		s.mu.Unlock()
+	}
+	return s, nil
+}
+
+// Send queues a chat message or comment for MessagesService.Create and
+// returns its ID, the message's UUID. A UUID is assigned to opt if it has
+// none, so every attempt to post the message carries the same one.
+func (s *Sender) Send(opt *flowdock.MessagesCreateOptions) (string, error) {
+	if opt == nil || opt.FlowID == "" {
+		return "", errors.New("outbox: message has no flow")
+	}
+	if opt.UUID == "" {
+		opt.UUID = flowdock.NewUUID()
+	}
+	m := *opt
+	return s.add(&item{ID: opt.UUID, Message: &m})
+}
+
+// SendInbox queues a message for InboxService.Create to the flow with the
+// API token, and returns its ID.
+func (s *Sender) SendInbox(flowApiToken string, opt *flowdock.InboxCreateOptions) (string, error) {
+	if flowApiToken == "" || opt == nil {
+		return "", errors.New("outbox: inbox message has no flow token")
+	}
+	m := *opt
+	return s.add(&item{ID: flowdock.NewUUID(), Token: flowApiToken, Inbox: &m})
+}
+
+func (s *Sender) add(it *item) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", ErrClosed
+	}
+	s.seq++
+	it.Seq = s.seq
+	if err := s.spool(it); err != nil {
+		return "", err
+	}
+	s.enqueue(it)
+	return it.ID, nil
+}
+
+// enqueue adds it to its flow's queue, starting a goroutine posting the
+// queue if there is none. s.mu must be held.
+func (s *Sender) enqueue(it *item) {
+	q := s.queues[it.key()]
+	if q == nil {
+		q = new(queue)
+		s.queues[it.key()] = q
+	}
+	q.items = append(q.items, it)
+	if !q.running {
+		q.running = true
+		s.wg.Add(1)
+		go s.run(q)
+	}
+}
+
+// Pending returns the number of queued messages without a final status.
+func (s *Sender) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, q := range s.queues {
+		n += len(q.items)
+	}
+	return n
+}
+
+// Close stops queueing messages and waits for the queued ones to be posted,
+// or for ctx to be done. Messages still queued then are abandoned, and
+// ctx's error is returned.
+func (s *Sender) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	close(s.stop)
+	<-done
+	s.mu.Lock()
+	var abandoned []*item
+	for _, q := range s.queues {
+		abandoned = append(abandoned, q.items...)
+		q.items = nil
+	}
+	s.mu.Unlock()
+	sort.Slice(abandoned, func(i, j int) bool { return abandoned[i].Seq < abandoned[j].Seq })
+	for _, it := range abandoned {
+		s.report(Status{ID: it.ID, State: Abandoned, Err: ctx.Err()})
+	}
+	return ctx.Err()
+}
+
+// run posts the messages of q until it is empty or the Sender is stopped.
+func (s *Sender) run(q *queue) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		s.mu.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			s.mu.Unlock()
+			return
+		}
+		batch := q.items[:1]
+		if n := coalescibleRun(q.items); s.opt.CoalesceAt > 0 && n >= s.opt.CoalesceAt {
+			batch = q.items[:n]
+		}
+		batch = append([]*item(nil), batch...)
+		s.mu.Unlock()
+
+		statuses, ok := s.post(batch)
+		if !ok {
+			return // stopped, leaving the batch queued
+		}
+
+		s.mu.Lock()
+		q.items = q.items[len(batch):]
+		s.mu.Unlock()
+		for i, it := range batch {
+			s.unspool(it)
+			s.report(statuses[i])
+		}
+	}
+}
+
+func coalescibleRun(items []*item) int {
+	n := 0
+	for n < len(items) && items[n].coalescible() {
+		n++
+	}
+	return n
+}
+
+// post posts the batch, as a summary if it has several messages, until it
+// is sent or fails. It returns the status of each message, or false if the
+// Sender was stopped first.
+func (s *Sender) post(batch []*item) ([]Status, bool) {
+	state := Sent
+	var summary *flowdock.MessagesCreateOptions
+	if len(batch) > 1 {
+		state = Coalesced
+		summary = summarize(batch)
+	}
+
+	backoff := s.opt.MinBackoff
+	for attempt := 1; ; attempt++ {
+		var m *flowdock.Message
+		var resp *http.Response
+		var err error
+		switch {
+		case summary != nil:
+			m, resp, err = s.client.Messages.Create(summary)
+		case batch[0].Inbox != nil:
+			m, resp, err = s.client.Inbox.Create(batch[0].Token, batch[0].Inbox)
+		default:
+			m, resp, err = s.client.Messages.Create(batch[0].Message)
+		}
+
+		st := Status{State: state, Message: m, Attempts: attempt, Err: err}
+		if err != nil {
+			st.State, st.Message = Failed, nil
+		}
+		if err != nil && retryable(resp, err) && (s.opt.MaxAttempts == 0 || attempt < s.opt.MaxAttempts) {
+			delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+			if d, ok := retryAfter(resp); ok {
+				delay = d
+			}
+			if backoff *= 2; backoff > s.opt.MaxBackoff {
+				backoff = s.opt.MaxBackoff
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+				continue
+			case <-s.stop:
+				timer.Stop()
+				return nil, false
+			}
+		}
+
+		statuses := make([]Status, len(batch))
+		for i, it := range batch {
+			statuses[i] = st
+			statuses[i].ID = it.ID
+		}
+		return statuses, true
+	}
+}
+
+// summaryLines is the most messages listed in a summary.
+const summaryLines = 50
+
+// summarize merges chat messages to one flow into a summary listing the
+// first line of each, tagged with all their tags. Its UUID is derived from
+// theirs, so Deliveries and streams match the summary by the same UUID
+// however often it is built; it does not keep Flowdock from posting a
+// summary sent twice.
+func summarize(batch []*item) *flowdock.MessagesCreateOptions {
+	b := flowdock.NewMessage().Flow(batch[0].Message.FlowID).
+		Bold(fmt.Sprintf("%d messages", len(batch))).Paragraph()
+	h := sha1.New()
+	var tags []string
+	seen := map[string]bool{}
+	listed := 0
+	for _, it := range batch {
+		h.Write([]byte(it.ID))
+		for _, tag := range it.Message.Tags {
+			if t := strings.ToLower(tag); !seen[t] {
+				seen[t] = true
+				tags = append(tags, tag)
+			}
+		}
+
+		line, _, _ := strings.Cut(strings.TrimSpace(it.Message.Content), "\n")
+		if r := []rune(line); len(r) > 200 {
+			line = string(r[:200]) + "…"
+		}
+		entry := "- " + line + "\n"
+		if listed < summaryLines && utf8.RuneCountInString(b.String()+entry) < flowdock.MaxContentLength-100 {
+			b.Markdown(entry)
+			listed++
+		}
+	}
+	if more := len(batch) - listed; more > 0 {
+		b.Paragraph().Text(fmt.Sprintf("and %d more", more))
+	}
+
+	opt, _ := b.Options()
+	opt.Tags = tags
+	sum := h.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	opt.UUID = fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	return opt
+}
+
+// retryable reports whether a failed post may succeed later and certainly
+// did not post the message: it was rate limited, or never sent because
+// Flowdock could not be reached.
+func retryable(resp *http.Response, err error) bool {
+	if resp != nil {
+		return resp.StatusCode == http.StatusTooManyRequests
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryAfter returns the delay asked for by a 429 response.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+func (s *Sender) report(st Status) {
+	if s.opt.OnStatus != nil {
+		s.opt.OnStatus(st)
+	}
+}
+
+func (s *Sender) spoolPath(it *item) string {
+	return filepath.Join(s.opt.SpoolDir, fmt.Sprintf("%020d-%s.json", it.Seq, it.ID))
+}
+
+// spool writes it to the spool directory, if there is one.
+func (s *Sender) spool(it *item) error {
+	if s.opt.SpoolDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.opt.SpoolDir, 0700); err != nil {
+		return fmt.Errorf("outbox: %v", err)
+	}
+	tmp, err := os.CreateTemp(s.opt.SpoolDir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("outbox: %v", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.spoolPath(it))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("outbox: spooling message: %v", err)
+	}
+	return nil
+}
+
+func (s *Sender) unspool(it *item) {
+	if s.opt.SpoolDir != "" {
+		os.Remove(s.spoolPath(it))
+	}
+}
+
+// loadSpool reads the messages in the spool directory, oldest first.
+func (s *Sender) loadSpool() ([]*item, error) {
+	entries, err := os.ReadDir(s.opt.SpoolDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %v", err)
+	}
+
+	var items []*item
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.opt.SpoolDir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("outbox: %v", err)
+		}
+		it := new(item)
+		if err := json.Unmarshal(data, it); err != nil || it.Message == nil && it.Inbox == nil {
+			return nil, fmt.Errorf("outbox: invalid spooled message %v", e.Name())
+		}
+		items = append(items, it)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Seq < items[j].Seq })
+	return items, nil
+}
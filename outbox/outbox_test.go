@@ -0,0 +1,357 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+type post struct {
+	Path    string
+	Flow    string
+	Content string
+	Tags    []string
+	UUID    string
+}
+
+// api is a fake Flowdock API recording posted messages. fail, if set, gives
+// the status to answer the nth post with, or 0 to accept it.
+type api struct {
+	*httptest.Server
+	mu    sync.Mutex
+	posts []post
+	fail  func(n int, p post) int
+}
+
+func newAPI(t *testing.T) *api {
+	a := new(api)
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p post
+		json.NewDecoder(r.Body).Decode(&p)
+		p.Path = r.URL.Path
+
+		a.mu.Lock()
+		a.posts = append(a.posts, p)
+		n, fail := len(a.posts), a.fail
+		a.mu.Unlock()
+		if fail != nil {
+			if code := fail(n, p); code != 0 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(code)
+				return
+			}
+		}
+		fmt.Fprintf(w, `{"id":%d,"uuid":%q}`, n, p.UUID)
+	}))
+	t.Cleanup(a.Close)
+	return a
+}
+
+func (a *api) client() *flowdock.Client {
+	c := flowdock.NewClient(nil)
+	c.RestURL, _ = url.Parse(a.URL + "/")
+	return c
+}
+
+func (a *api) sent() []post {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]post(nil), a.posts...)
+}
+
+// statuses collects the statuses reported by a Sender.
+type statuses struct {
+	mu   sync.Mutex
+	list []Status
+}
+
+func (s *statuses) add(st Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, st)
+}
+
+func (s *statuses) get() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Status(nil), s.list...)
+}
+
+func newSender(t *testing.T, a *api, opt Options) (*Sender, *statuses) {
+	st := new(statuses)
+	opt.OnStatus = st.add
+	if opt.MinBackoff == 0 {
+		opt.MinBackoff, opt.MaxBackoff = time.Millisecond, 5*time.Millisecond
+	}
+	s, err := New(a.client(), &opt)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	return s, st
+}
+
+func send(t *testing.T, s *Sender, flow, content string, tags ...string) string {
+	id, err := s.Send(&flowdock.MessagesCreateOptions{FlowID: flow, Event: "message", Content: content, Tags: tags})
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	return id
+}
+
+func closeSender(t *testing.T, s *Sender) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+}
+
+func contents(posts []post, flow string) []string {
+	var list []string
+	for _, p := range posts {
+		if p.Flow == flow {
+			list = append(list, p.Content)
+		}
+	}
+	return list
+}
+
+func TestSender(t *testing.T) {
+	a := newAPI(t)
+	s, st := newSender(t, a, Options{CoalesceAt: -1})
+
+	ids := map[string]bool{}
+	for i := 1; i <= 3; i++ {
+		ids[send(t, s, "org:a", fmt.Sprint("a", i))] = true
+		ids[send(t, s, "org:b", fmt.Sprint("b", i))] = true
+	}
+	closeSender(t, s)
+
+	posts := a.sent()
+	if got := contents(posts, "org:a"); !reflect.DeepEqual(got, []string{"a1", "a2", "a3"}) {
+		t.Errorf("flow a got %q, in the wrong order", got)
+	}
+	if got := contents(posts, "org:b"); !reflect.DeepEqual(got, []string{"b1", "b2", "b3"}) {
+		t.Errorf("flow b got %q, in the wrong order", got)
+	}
+	for _, status := range st.get() {
+		if status.State != Sent || status.Message == nil || status.Attempts != 1 || !ids[status.ID] {
+			t.Errorf("Status = %+v, want sent", status)
+		}
+		delete(ids, status.ID)
+	}
+	if len(ids) != 0 {
+		t.Errorf("no status for %v", ids)
+	}
+	if _, err := s.Send(&flowdock.MessagesCreateOptions{FlowID: "org:a", Content: "late"}); err != ErrClosed {
+		t.Errorf("Send after Close returned %v, want ErrClosed", err)
+	}
+}
+
+func TestSender_coalesce(t *testing.T) {
+	a := newAPI(t)
+	release := make(chan struct{})
+	a.fail = func(n int, p post) int {
+		if n == 1 {
+			<-release // hold the first post while the burst queues up
+		}
+		return 0
+	}
+	s, st := newSender(t, a, Options{CoalesceAt: 5})
+
+	first := send(t, s, "org:a", "disk full on db1", "alert")
+	for s.Pending() == 0 || len(a.sent()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 7; i++ {
+		send(t, s, "org:a", fmt.Sprintf("disk full on db%d\ndetails", i), "alert", fmt.Sprint("db", i))
+	}
+	comment, _ := s.Send(&flowdock.MessagesCreateOptions{FlowID: "org:a", Event: "comment", MessageID: 1, Content: "ack"})
+	close(release)
+	closeSender(t, s)
+
+	posts := a.sent()
+	if len(posts) != 3 {
+		t.Fatalf("API got %d posts, want the first message, a summary and the comment: %+v", len(posts), posts)
+	}
+	summary := posts[1]
+	want := "**6 messages**\n\n- disk full on db2\n- disk full on db3\n- disk full on db4\n- disk full on db5\n- disk full on db6\n- disk full on db7"
+	if summary.Content != want {
+		t.Errorf("summary content = %q, want %q", summary.Content, want)
+	}
+	if wantTags := []string{"alert", "db2", "db3", "db4", "db5", "db6", "db7"}; !reflect.DeepEqual(summary.Tags, wantTags) {
+		t.Errorf("summary tags = %q, want %q", summary.Tags, wantTags)
+	}
+	if posts[2].Content != "ack" || posts[2].Path != "/messages" {
+		t.Errorf("comment was posted as %+v", posts[2])
+	}
+
+	var coalesced int
+	for _, status := range st.get() {
+		switch {
+		case status.ID == first || status.ID == comment:
+			if status.State != Sent {
+				t.Errorf("Status = %+v, want sent", status)
+			}
+		case status.State == Coalesced && *status.Message.ID == 2:
+			coalesced++
+		default:
+			t.Errorf("Status = %+v, want coalesced into message 2", status)
+		}
+	}
+	if coalesced != 6 {
+		t.Errorf("%d messages were reported coalesced, want 6", coalesced)
+	}
+}
+
+func TestSummarize_long(t *testing.T) {
+	var batch []*item
+	for i := 0; i < 300; i++ {
+		content := fmt.Sprint(i, " ", strings.Repeat("é", 300))
+		batch = append(batch, &item{ID: fmt.Sprint(i), Message: &flowdock.MessagesCreateOptions{FlowID: "f", Content: content}})
+	}
+	opt := summarize(batch)
+	if n := len([]rune(opt.Content)); n > flowdock.MaxContentLength {
+		t.Errorf("summary has %d characters", n)
+	}
+	var more int
+	listed := strings.Count(opt.Content, "\n- ")
+	fmt.Sscanf(opt.Content[strings.LastIndex(opt.Content, "\n")+1:], "and %d more", &more)
+	if !strings.HasPrefix(opt.Content, "**300 messages**") || listed < 20 || listed+more != 300 {
+		t.Errorf("summary lists %d messages and %d more, want 300:\n%v", listed, more, opt.Content)
+	}
+	if again := summarize(batch); again.UUID != opt.UUID {
+		t.Errorf("summaries of the same messages have UUIDs %v and %v", opt.UUID, again.UUID)
+	}
+}
+
+func TestSender_retry(t *testing.T) {
+	a := newAPI(t)
+	a.fail = func(n int, p post) int {
+		switch {
+		case p.Content == "bad":
+			return http.StatusUnprocessableEntity
+		case n <= 2:
+			return http.StatusTooManyRequests
+		}
+		return 0
+	}
+	s, st := newSender(t, a, Options{})
+	send(t, s, "org:a", "first")
+	send(t, s, "org:a", "bad")
+	send(t, s, "org:a", "last")
+	closeSender(t, s)
+
+	posts := a.sent()
+	if got := contents(posts, "org:a"); !reflect.DeepEqual(got, []string{"first", "first", "first", "bad", "last"}) {
+		t.Errorf("API got %q", got)
+	}
+	if posts[0].UUID != posts[2].UUID {
+		t.Errorf("retries were sent with UUIDs %v and %v", posts[0].UUID, posts[2].UUID)
+	}
+
+	list := st.get()
+	if len(list) != 3 || list[0].State != Sent || list[0].Attempts != 3 ||
+		list[1].State != Failed || list[1].Err == nil || list[2].State != Sent {
+		t.Errorf("statuses = %+v", list)
+	}
+}
+
+func TestSender_serverError(t *testing.T) {
+	a := newAPI(t)
+	a.fail = func(n int, p post) int {
+		if n == 1 {
+			return http.StatusBadGateway
+		}
+		return 0
+	}
+	s, st := newSender(t, a, Options{})
+	send(t, s, "org:a", "maybe posted")
+	closeSender(t, s)
+
+	if n := len(a.sent()); n != 1 {
+		t.Errorf("API got %d posts, want the message posted once", n)
+	}
+	if list := st.get(); len(list) != 1 || list[0].State != Failed || list[0].Attempts != 1 {
+		t.Errorf("statuses = %+v, want failed after 1 attempt", list)
+	}
+}
+
+func TestSender_maxAttempts(t *testing.T) {
+	a := newAPI(t)
+	a.fail = func(int, post) int { return http.StatusTooManyRequests }
+	s, st := newSender(t, a, Options{MaxAttempts: 2})
+	send(t, s, "org:a", "hi")
+	closeSender(t, s)
+
+	if list := st.get(); len(list) != 1 || list[0].State != Failed || list[0].Attempts != 2 {
+		t.Errorf("statuses = %+v, want failed after 2 attempts", list)
+	}
+}
+
+func TestSender_inbox(t *testing.T) {
+	a := newAPI(t)
+	s, st := newSender(t, a, Options{})
+	id, err := s.SendInbox("token", &flowdock.InboxCreateOptions{Source: "CI", FromAddress: "ci@example.com", Subject: "Build", Content: "<b>passed</b>"})
+	if err != nil {
+		t.Fatalf("SendInbox returned error: %v", err)
+	}
+	closeSender(t, s)
+
+	if posts := a.sent(); len(posts) != 1 || posts[0].Path != "/v1/messages/team_inbox/token" || posts[0].Content != "<b>passed</b>" {
+		t.Errorf("API got %+v", posts)
+	}
+	if list := st.get(); len(list) != 1 || list[0].ID != id || list[0].State != Sent {
+		t.Errorf("statuses = %+v", list)
+	}
+}
+
+func TestSender_spool(t *testing.T) {
+	dir := t.TempDir()
+	down := newAPI(t)
+	down.Close() // unreachable
+	s, st := newSender(t, down, Options{SpoolDir: dir, CoalesceAt: -1})
+	first := send(t, s, "org:a", "one")
+	send(t, s, "org:a", "two")
+	s.SendInbox("token", &flowdock.InboxCreateOptions{Content: "mail"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Close returned %v, want context.DeadlineExceeded", err)
+	}
+	list := st.get()
+	if len(list) != 3 || list[0].State != Abandoned || list[0].ID != first {
+		t.Errorf("statuses = %+v, want all abandoned in order", list)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("spool has %d files, want 3", len(entries))
+	}
+
+	up := newAPI(t)
+	s, st = newSender(t, up, Options{SpoolDir: dir, CoalesceAt: -1})
+	send(t, s, "org:a", "three")
+	closeSender(t, s)
+
+	posts := up.sent()
+	if got := contents(posts, "org:a"); !reflect.DeepEqual(got, []string{"one", "two", "three"}) {
+		t.Errorf("after the restart flow a got %q", got)
+	}
+	if len(posts) != 4 || len(st.get()) != 4 {
+		t.Errorf("after the restart API got %d posts and %d statuses, want 4", len(posts), len(st.get()))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spool has %d files left", len(entries))
+	}
+}
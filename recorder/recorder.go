@@ -0,0 +1,263 @@
+// Package recorder provides an http.RoundTripper that records interactions
+// with the Flowdock API to fixture files and replays them in tests.
+//
+// Record once against the real service:
+//
+//	rec, err := recorder.New("testdata/flows.json", recorder.ModeRecord, nil)
+//	client := flowdock.NewClient(rec.Client())
+//	...
+//	rec.Stop() // writes the fixture
+//
+// and replay deterministically, without a network, afterwards:
+//
+//	rec, err := recorder.New("testdata/flows.json", recorder.ModeReplay, nil)
+//	client := flowdock.NewClient(rec.Client())
+//
+// Tokens are scrubbed from URLs, headers and JSON bodies before anything is
+// written.
+// Event stream responses are kept as timed event logs, see Event.
+package recorder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Recorder talks to the network.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the fixture and never touches the
+	// network.
+	ModeReplay Mode = iota
+
+	// ModeRecord sends requests through the underlying transport and records
+	// them. The fixture is written by Stop.
+	ModeRecord
+)
+
+// ErrNoInteraction is returned in replay mode when no unused recorded
+// interaction matches a request.
+var ErrNoInteraction = errors.New("recorder: no recorded interaction matches request")
+
+// Recorder is an http.RoundTripper recording to, or replaying from, a
+// Cassette.
+type Recorder struct {
+	// StreamSpeed scales the delays between replayed stream events. At 1
+	// events arrive at the recorded pace; at 0, the default, they are
+	// delivered without waiting.
+	StreamSpeed float64
+
+	mode     Mode
+	path     string
+	base     http.RoundTripper
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[int]bool
+	streams  []*recordingBody
+}
+
+// New returns a Recorder for the fixture at path. In ModeReplay the fixture
+// must exist. base is the transport used in ModeRecord; if nil,
+// http.DefaultTransport is used.
+func New(path string, mode Mode, base http.RoundTripper) (*Recorder, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	r := &Recorder{
+		mode:     mode,
+		path:     path,
+		base:     base,
+		cassette: new(Cassette),
+		used:     make(map[int]bool),
+	}
+	if mode == ModeReplay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+	}
+	return r, nil
+}
+
+// Client returns an http.Client using the Recorder as its transport, ready
+// to be passed to flowdock.NewClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Cassette returns the interactions recorded or loaded so far.
+func (r *Recorder) Cassette() *Cassette {
+	return r.cassette
+}
+
+// Stop finishes recording, closing any stream still being recorded, and
+// writes the fixture. It does nothing in replay mode.
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	streams := r.streams
+	r.streams = nil
+	r.mu.Unlock()
+	for _, s := range streams {
+		s.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeReplay {
+		i, err := r.match(req.Method, ScrubURL(req.URL), ScrubBody(body), false)
+		if err != nil {
+			return nil, err
+		}
+		return r.replay(req, i), nil
+	}
+	return r.record(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body string) (*http.Response, error) {
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    ScrubURL(req.URL),
+			Header: ScrubHeader(req.Header),
+			Body:   ScrubBody(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     ScrubHeader(resp.Header),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+
+	if isEventStream(resp.Header) {
+		rb := newRecordingBody(resp.Body, &r.mu, i)
+		r.mu.Lock()
+		r.streams = append(r.streams, rb)
+		r.mu.Unlock()
+		resp.Body = rb
+		return resp, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	i.Response.Body = ScrubBody(string(data))
+	r.mu.Unlock()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// match finds the first unused interaction matching the request and marks
+// it used.
+func (r *Recorder) match(method, scrubbedURL, body string, hostless bool) (*Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n, i := range r.cassette.Interactions {
+		if !r.used[n] && i.Request.matches(method, scrubbedURL, body, hostless) {
+			r.used[n] = true
+			return i, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v %v", ErrNoInteraction, method, scrubbedURL)
+}
+
+func (r *Recorder) replay(req *http.Request, i *Interaction) *http.Response {
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+		StatusCode: i.Response.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     i.Response.Header.Clone(),
+		Request:    req,
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	if isEventStream(resp.Header) {
+		resp.Body = newReplayBody(i.Response.Events, r.StreamSpeed, req.Context().Done())
+		resp.ContentLength = -1
+	} else {
+		resp.Body = io.NopCloser(strings.NewReader(i.Response.Body))
+		resp.ContentLength = int64(len(i.Response.Body))
+	}
+	return resp
+}
+
+// Handler returns an http.Handler serving the recorded responses, for
+// clients whose transport cannot be replaced. Point flowdock.Client's
+// RestURL or StreamURL at an httptest.Server running it. Requests are
+// matched on method, path, query and body; hosts are ignored.
+func (r *Recorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := readBody(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		i, err := r.match(req.Method, ScrubURL(req.URL), ScrubBody(body), true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		resp := r.replay(req, i)
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		if isEventStream(resp.Header) {
+			copyFlushing(w, resp.Body)
+			return
+		}
+		io.Copy(w, resp.Body)
+	})
+}
+
+func readBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+func isEventStream(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
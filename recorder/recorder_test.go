@@ -0,0 +1,263 @@
+package recorder
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/flowdocktest"
+)
+
+func seed(t *testing.T) *flowdocktest.Server {
+	srv := flowdocktest.NewServer()
+	srv.AddOrganization("org", "Organization")
+	srv.AddUser("alice", "Alice", "alice@example.com")
+	if _, err := srv.AddFlow("org", "flow", 1); err != nil {
+		t.Fatalf("AddFlow returned error: %v", err)
+	}
+	return srv
+}
+
+// clientFor returns a client talking to srv's REST API with a token in the
+// URL, like NewClientWithToken does.
+func clientFor(srv *flowdocktest.Server, httpClient *http.Client) *flowdock.Client {
+	c := flowdock.NewClient(httpClient)
+	c.RestURL, _ = url.Parse(strings.Replace(srv.REST.URL, "http://", "http://secret-token@", 1) + "/")
+	return c
+}
+
+func TestRecorder_recordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flows.json")
+	srv := seed(t)
+
+	rec, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	client := clientFor(srv, rec.Client())
+	recorded, _, err := client.Flows.List(false, nil)
+	if err != nil {
+		t.Fatalf("Flows.List returned error: %v", err)
+	}
+	opt := &flowdock.MessagesCreateOptions{FlowID: "org:flow", Event: "message", Content: "hello"}
+	if _, _, err := client.Messages.Create(opt); err != nil {
+		t.Fatalf("Messages.Create returned error: %v", err)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+	srv.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Errorf("fixture contains the token:\n%s", data)
+	}
+
+	rec, err = New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	client = clientFor(srv, rec.Client())
+	replayed, _, err := client.Flows.List(false, nil)
+	if err != nil {
+		t.Fatalf("replayed Flows.List returned error: %v", err)
+	}
+	if len(replayed) != 1 || *replayed[0].Id != *recorded[0].Id {
+		t.Errorf("replayed Flows.List returned %+v, want %+v", replayed, recorded)
+	}
+	message, _, err := client.Messages.Create(opt)
+	if err != nil {
+		t.Fatalf("replayed Messages.Create returned error: %v", err)
+	}
+	if message.Content().String() != "hello" {
+		t.Errorf("replayed Messages.Create returned %v, want hello", message.Content())
+	}
+
+	// every interaction is used once
+	_, _, err = client.Flows.List(false, nil)
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("third replayed call returned %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestScrubURL(t *testing.T) {
+	u, _ := url.Parse("https://token@stream.flowdock.com/flows/org/flow?access_token=secret&active=true")
+	got := ScrubURL(u)
+	want := "https://REDACTED@stream.flowdock.com/flows/org/flow?access_token=REDACTED&active=true"
+	if got != want {
+		t.Errorf("ScrubURL returned %v, want %v", got, want)
+	}
+}
+
+func TestRecorder_scrubsFlowTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbox.json")
+	srv := seed(t)
+	defer srv.Close()
+	token := srv.FlowToken("org", "flow")
+
+	rec, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	flows := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id":"flow","api_token":"` + token + `"}]`))
+	}))
+	defer flows.Close()
+	resp, err := rec.Client().Get(flows.URL + "/flows")
+	if err != nil {
+		t.Fatalf("listing flows returned error: %v", err)
+	}
+	resp.Body.Close()
+	client := clientFor(srv, rec.Client())
+	opt := &flowdock.InboxCreateOptions{Source: "CI", FromAddress: "ci@example.com", Subject: "Build", Content: "passed"}
+	if _, _, err := client.Inbox.Create(token, opt); err != nil {
+		t.Fatalf("Inbox.Create returned error: %v", err)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	if strings.Contains(string(data), token) {
+		t.Errorf("fixture contains the flow token:\n%s", data)
+	}
+	if !strings.Contains(string(data), "/team_inbox/REDACTED") || !strings.Contains(string(data), `\"api_token\":\"REDACTED\"`) {
+		t.Errorf("fixture does not show the scrubbed tokens:\n%s", data)
+	}
+
+	rec, err = New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	client = clientFor(srv, rec.Client())
+	if _, _, err := client.Inbox.Create(token, opt); err != nil {
+		t.Errorf("replayed Inbox.Create returned error: %v", err)
+	}
+}
+
+func TestScrubBody(t *testing.T) {
+	tests := map[string]string{
+		`[{"id":"flow","api_token":"secret","organization":{"name":"Org"}}]`: `[{"api_token":"REDACTED","id":"flow","organization":{"name":"Org"}}]`,
+		`{"access_token":"a","refresh_token":"r","expires_in":7200}`:         `{"access_token":"REDACTED","expires_in":7200,"refresh_token":"REDACTED"}`,
+		`{"content": "<b>no tokens</b>"}`:                                    `{"content": "<b>no tokens</b>"}`,
+		`token=secret`:                                                       `token=secret`,
+	}
+	for body, want := range tests {
+		if got := ScrubBody(body); got != want {
+			t.Errorf("ScrubBody(%v) = %v, want %v", body, got, want)
+		}
+	}
+}
+
+func TestScrubHeader(t *testing.T) {
+	h := http.Header{"Authorization": {"Bearer secret"}, "Accept": {"application/json"}}
+	got := ScrubHeader(h)
+	if got.Get("Authorization") != redacted || got.Get("Accept") != "application/json" {
+		t.Errorf("ScrubHeader returned %v", got)
+	}
+	if h.Get("Authorization") != "Bearer secret" {
+		t.Errorf("ScrubHeader modified its argument")
+	}
+}
+
+func TestRecorder_stream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream.json")
+	srv := seed(t)
+	defer srv.Close()
+
+	rec, err := New(path, ModeRecord, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	resp, err := rec.Client().Get(srv.Stream.URL + "/flows/org/flow?access_token=secret")
+	if err != nil {
+		t.Fatalf("stream request returned error: %v", err)
+	}
+	for _, content := range []string{"one", "two"} {
+		opt := &flowdock.MessagesCreateOptions{FlowID: "org:flow", Content: content}
+		if _, _, err := srv.Client().Messages.Create(opt); err != nil {
+			t.Fatalf("Messages.Create returned error: %v", err)
+		}
+	}
+	readEvents(t, bufio.NewReader(resp.Body), 2)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	events := c.Interactions[0].Response.Events
+	if len(events) != 2 || events[0].ID != "1" || events[1].Offset < events[0].Offset {
+		t.Fatalf("recorded events = %+v, want two events in order", events)
+	}
+
+	// replay through Handler so the EventSource used by Messages.Stream
+	// reads it like a live stream
+	rec, err = New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	replay := httptest.NewServer(rec.Handler())
+	defer replay.Close()
+
+	client := flowdock.NewClient(nil)
+	client.StreamURL, _ = url.Parse(replay.URL + "/")
+	stream, es, err := client.Messages.Stream("another-token", "org", "flow")
+	if err != nil {
+		t.Fatalf("Messages.Stream returned error: %v", err)
+	}
+	defer es.Close()
+
+	for _, want := range []string{"one", "two"} {
+		select {
+		case msg := <-stream:
+			if msg.Content().String() != want {
+				t.Errorf("replayed stream delivered %v, want %v", msg.Content(), want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("replayed stream did not deliver %v", want)
+		}
+	}
+}
+
+func readEvents(t *testing.T, r *bufio.Reader, n int) {
+	done := make(chan error, 1)
+	go func() {
+		for n > 0 {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				done <- err
+				return
+			}
+			if line == "\n" {
+				n--
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream delivered too few events")
+	}
+}
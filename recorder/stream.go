@@ -0,0 +1,178 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordingBody passes an event stream through to the client while
+// appending each complete event to the interaction.
+type recordingBody struct {
+	rc        io.ReadCloser
+	mu        *sync.Mutex
+	i         *Interaction
+	start     time.Time
+	buf       []byte
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newRecordingBody(rc io.ReadCloser, mu *sync.Mutex, i *Interaction) *recordingBody {
+	return &recordingBody{rc: rc, mu: mu, i: i, start: time.Now()}
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if n > 0 {
+		b.buf = append(b.buf, p[:n]...)
+		b.flushEvents()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.closeOnce.Do(func() { b.closeErr = b.rc.Close() })
+	return b.closeErr
+}
+
+// flushEvents moves every complete event out of the buffer.
+func (b *recordingBody) flushEvents() {
+	for {
+		b.buf = bytes.ReplaceAll(b.buf, []byte("\r\n"), []byte("\n"))
+		end := bytes.Index(b.buf, []byte("\n\n"))
+		if end < 0 {
+			return
+		}
+		frame := string(b.buf[:end])
+		b.buf = b.buf[end+2:]
+
+		e, ok := parseEvent(frame)
+		if !ok {
+			continue
+		}
+		e.Offset = Duration(time.Since(b.start))
+		b.mu.Lock()
+		b.i.Response.Events = append(b.i.Response.Events, e)
+		b.mu.Unlock()
+	}
+}
+
+// parseEvent parses one server-sent event frame. Frames holding only
+// comments or retry hints yield no event.
+func parseEvent(frame string) (Event, bool) {
+	var e Event
+	var data []string
+	for _, line := range strings.Split(frame, "\n") {
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Type = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if data == nil {
+		return e, false
+	}
+	e.Data = strings.Join(data, "\n")
+	return e, true
+}
+
+// encode returns the event as a server-sent event frame.
+func (e Event) encode() string {
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Type != "" {
+		b.WriteString("event: " + e.Type + "\n")
+	}
+	for _, line := range strings.Split(e.Data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// replayBody plays recorded events back. Once they are all delivered it
+// stays open, like a live stream, until closed.
+type replayBody struct {
+	pr        *io.PipeReader
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func newReplayBody(events []Event, speed float64, done <-chan struct{}) *replayBody {
+	pr, pw := io.Pipe()
+	b := &replayBody{pr: pr, stop: make(chan struct{})}
+
+	go func() {
+		start := time.Now()
+		for _, e := range events {
+			wait := time.Duration(float64(e.Offset)*speed) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-b.stop:
+					pw.Close()
+					return
+				case <-done:
+					pw.Close()
+					return
+				}
+			}
+			if _, err := io.WriteString(pw, e.encode()); err != nil {
+				return
+			}
+		}
+		select {
+		case <-b.stop:
+		case <-done:
+		}
+		pw.Close()
+	}()
+	return b
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	return b.pr.Read(p)
+}
+
+func (b *replayBody) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		b.pr.Close()
+	})
+	return nil
+}
+
+// copyFlushing copies a replayed stream to w, flushing after every write so
+// the client sees each event as it is replayed.
+func copyFlushing(w http.ResponseWriter, r io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
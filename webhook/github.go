@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// GitHub maps GitHub's push, pull_request and issues webhooks to chat
+// messages, and ignores other events. A message gives the
+// flowdock.VcsContent Summary of the event, the commits pushed and a link to
+// the event.
+type GitHub struct {
+	// Flow is the ID of the flow to post to.
+	Flow string
+
+	// Tags are added to every message, besides "github" and the event.
+	Tags []string
+
+	// AllActions posts every pull request and issue action, such as
+	// "labeled" or "synchronize". Otherwise only "opened", "closed" and
+	// "reopened" are posted.
+	AllActions bool
+}
+
+// maxCommits is the most commits listed for a push.
+const maxCommits = 10
+
+// Map maps an event sent by GitHub, named by its X-GitHub-Event header.
+func (g *GitHub) Map(e *Event) ([]Post, error) {
+	event := e.Header.Get("X-GitHub-Event")
+	if event != "push" && event != "pull_request" && event != "issues" {
+		return nil, nil
+	}
+
+	vcs := new(flowdock.VcsContent)
+	if err := json.Unmarshal(e.Body, vcs); err != nil {
+		return nil, fmt.Errorf("webhook: decoding GitHub %v event: %v", event, err)
+	}
+	if vcs.Repository.Name == nil {
+		return nil, fmt.Errorf("webhook: GitHub %v event has no repository", event)
+	}
+	vcs.Event = &event
+	if action := vcs.Action; event != "push" && !g.AllActions &&
+		(action == nil || *action != "opened" && *action != "closed" && *action != "reopened") {
+		return nil, nil
+	}
+
+	b := flowdock.NewMessage().Flow(g.Flow).Text(vcs.Summary())
+	if event == "push" && (vcs.Deleted == nil || !*vcs.Deleted) && len(vcs.Commits) > 0 {
+		var commits []string
+		for i := range vcs.Commits {
+			if i == maxCommits {
+				commits = append(commits, fmt.Sprintf("and %d more", len(vcs.Commits)-maxCommits))
+				break
+			}
+			commits = append(commits, vcs.Commits[i].String())
+		}
+		b.List(commits...)
+	}
+	if u := vcs.Url(); u != "" {
+		b.Paragraph().Markdown(u)
+	}
+	b.Tags("github", event).Tags(g.Tags...)
+
+	opt, err := b.Options()
+	if err != nil {
+		return nil, err
+	}
+	return []Post{{Message: opt}}, nil
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/wm/go-flowdock/flowdock"
+)
+
+// TemplateConfig configures a template Mapper. Each field but Flow and
+// Token is a text/template template, executed with the event's JSON
+// payload as dot. Missing fields of the payload are empty.
+type TemplateConfig struct {
+	// Flow is the ID of the flow to post chat messages to.
+	Flow string `json:"flow,omitempty"`
+
+	// Token is the API token of the flow to post team inbox messages to,
+	// instead. Inbox messages also need Subject, FromAddress and Source.
+	Token string `json:"token,omitempty"`
+
+	// Content is the message's content. Events for which it is empty are
+	// ignored, so a template can pick the events to post.
+	Content string `json:"content"`
+
+	// Tags are the message's tags. Tags that are empty are left out.
+	Tags []string `json:"tags,omitempty"`
+
+	// The fields of inbox messages.
+	Subject     string `json:"subject,omitempty"`
+	FromAddress string `json:"from_address,omitempty"`
+	FromName    string `json:"from_name,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Link        string `json:"link,omitempty"`
+}
+
+// Template is a Mapper posting one message for each event, built by
+// templates.
+type Template struct {
+	flow, token string
+	tmpl        *template.Template
+	tags        int
+}
+
+var templateFuncs = template.FuncMap{
+	// join joins the elements of a list, such as a JSON array.
+	"join": func(sep string, list []interface{}) string {
+		s := make([]string, len(list))
+		for i, v := range list {
+			s[i] = fmt.Sprint(v)
+		}
+		return strings.Join(s, sep)
+	},
+	// truncate shortens s to n characters.
+	"truncate": func(n int, s string) string {
+		if r := []rune(s); len(r) > n {
+			return string(r[:n]) + "…"
+		}
+		return s
+	},
+}
+
+// NewTemplate parses the templates of c.
+func NewTemplate(c TemplateConfig) (*Template, error) {
+	if (c.Flow == "") == (c.Token == "") {
+		return nil, fmt.Errorf("webhook: template needs either a flow or a flow API token")
+	}
+	if c.Token != "" && (c.Subject == "" || c.FromAddress == "" || c.Source == "") {
+		return nil, fmt.Errorf("webhook: inbox template needs a subject, from address and source")
+	}
+
+	t := &Template{flow: c.Flow, token: c.Token, tmpl: template.New("webhook").Funcs(templateFuncs), tags: len(c.Tags)}
+	fields := map[string]string{
+		"content": c.Content, "subject": c.Subject, "from_address": c.FromAddress,
+		"from_name": c.FromName, "source": c.Source, "project": c.Project, "link": c.Link,
+	}
+	for i, tag := range c.Tags {
+		fields[fmt.Sprint("tag", i)] = tag
+	}
+	for name, text := range fields {
+		if _, err := t.tmpl.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("webhook: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// Map executes the templates with the event's payload.
+func (t *Template) Map(e *Event) ([]Post, error) {
+	exec := func(name string) (string, error) {
+		var buf bytes.Buffer
+		if err := t.tmpl.ExecuteTemplate(&buf, name, e.Payload); err != nil {
+			return "", fmt.Errorf("webhook: %v", err)
+		}
+		// missing map keys print as "<no value>"
+		return strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", "")), nil
+	}
+
+	content, err := exec("content")
+	if err != nil || content == "" {
+		return nil, err
+	}
+	var tags []string
+	for i := 0; i < t.tags; i++ {
+		tag, err := exec(fmt.Sprint("tag", i))
+		if err != nil {
+			return nil, err
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	if t.flow != "" {
+		opt := &flowdock.MessagesCreateOptions{FlowID: t.flow, Event: "message", Content: content, Tags: tags}
+		return []Post{{Message: opt}}, nil
+	}
+	opt := &flowdock.InboxCreateOptions{Content: content, Tags: tags}
+	for name, field := range map[string]*string{
+		"subject": &opt.Subject, "from_address": &opt.FromAddress, "from_name": &opt.FromName,
+		"source": &opt.Source, "project": &opt.Project, "link": &opt.Link,
+	} {
+		if *field, err = exec(name); err != nil {
+			return nil, err
+		}
+	}
+	return []Post{{Token: t.token, Inbox: opt}}, nil
+}
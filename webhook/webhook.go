@@ -0,0 +1,227 @@
+// Package webhook receives webhooks from other services and posts them to
+// Flowdock.
+//
+// A Handler verifies each request, hands its payload to a Mapper and posts
+// the messages the mapper returns:
+//
+//	http.Handle("/hooks/github", &webhook.Handler{
+//		Client:   client,
+//		Verifier: webhook.GitHubSignature(os.Getenv("GITHUB_WEBHOOK_SECRET")),
+//		Mapper:   &webhook.GitHub{Flow: "acme:dev"},
+//	})
+//
+//	alerts, err := webhook.NewTemplate(webhook.TemplateConfig{
+//		Flow:    "acme:ops",
+//		Content: `{{range .alerts}}[{{.status}}] {{.labels.alertname}}: {{.annotations.summary}}{{"\n"}}{{end}}`,
+//		Tags:    []string{"alert", "{{.status}}"},
+//	})
+//	http.Handle("/hooks/alertmanager", &webhook.Handler{Client: client, Mapper: alerts})
+//
+// GitHub maps GitHub's push, pull request and issue events; NewTemplate maps
+// any JSON payload with text/template templates.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/outbox"
+)
+
+// DefaultMaxBodySize is the largest request body a Handler reads, unless its
+// MaxBodySize is set.
+const DefaultMaxBodySize = 1 << 20
+
+// Event is a received webhook.
+type Event struct {
+	Header http.Header
+	Body   []byte
+
+	// Payload is the body decoded from JSON, as by json.Unmarshal into an
+	// interface{}. It is nil if the body is not JSON.
+	Payload interface{}
+}
+
+// Post is a message to post for an event: a chat message, or a message to
+// the team inbox of the flow with the API token.
+type Post struct {
+	Message *flowdock.MessagesCreateOptions
+	Token   string
+	Inbox   *flowdock.InboxCreateOptions
+}
+
+// A Mapper turns an event into the messages to post. Events it returns no
+// posts for are ignored.
+type Mapper interface {
+	Map(e *Event) ([]Post, error)
+}
+
+// MapperFunc adapts a function to a Mapper.
+type MapperFunc func(e *Event) ([]Post, error)
+
+// Map returns f(e).
+func (f MapperFunc) Map(e *Event) ([]Post, error) {
+	return f(e)
+}
+
+// A Verifier checks that a request was sent by the service it claims to be
+// from.
+type Verifier interface {
+	Verify(r *http.Request, body []byte) error
+}
+
+// ErrSignature is returned by HMAC.Verify for a missing or wrong signature.
+var ErrSignature = errors.New("webhook: invalid signature")
+
+// HMAC verifies requests carrying a hex encoded HMAC of their body in a
+// header, like GitHub's X-Hub-Signature-256.
+type HMAC struct {
+	Secret []byte
+	Header string           // header holding the signature
+	Prefix string           // prefix of the header's value, such as "sha256="
+	Hash   func() hash.Hash // sha256.New when nil
+}
+
+// GitHubSignature verifies the X-Hub-Signature-256 header GitHub signs
+// webhooks with.
+func GitHubSignature(secret string) *HMAC {
+	return &HMAC{Secret: []byte(secret), Header: "X-Hub-Signature-256", Prefix: "sha256="}
+}
+
+// Verify checks the signature of body, the body of r.
+func (h *HMAC) Verify(r *http.Request, body []byte) error {
+	newHash := h.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	sig, ok := strings.CutPrefix(r.Header.Get(h.Header), h.Prefix)
+	got, err := hex.DecodeString(sig)
+	if !ok || err != nil || sig == "" {
+		return ErrSignature
+	}
+	mac := hmac.New(newHash, h.Secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// Handler is an http.Handler receiving webhooks. It answers 204 No Content
+// once the event's messages are posted, or queued to Outbox, and an error
+// status otherwise: 401 for requests failing verification, 400 for
+// unreadable ones, 422 for events the mapper rejects and 502 when Flowdock
+// does not accept a message.
+//
+// Chat messages without a UUID, of a delivery with an X-GitHub-Delivery
+// header, get one derived from the delivery ID and their place among the
+// event's posts. A delivery retried after a 502, which may follow messages
+// already posted, sends them again with the UUIDs they had, so streams and
+// Deliveries can tell the copies apart from new messages. Flowdock is not
+// known to drop them. Other messages get random UUIDs from
+// MessagesService.Create or the Outbox.
+type Handler struct {
+	// Client posts the messages, unless Outbox is set.
+	Client *flowdock.Client
+
+	// Outbox, if set, queues the messages instead.
+	Outbox *outbox.Sender
+
+	// Mapper turns the events into messages.
+	Mapper Mapper
+
+	// Verifier, if set, checks every request.
+	Verifier Verifier
+
+	// MaxBodySize is the largest body read, DefaultMaxBodySize when zero.
+	MaxBodySize int64
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	max := h.MaxBodySize
+	if max == 0 {
+		max = DefaultMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		http.Error(w, "reading body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Verifier != nil {
+		if err := h.Verifier.Verify(r, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	e := &Event{Header: r.Header, Body: body}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &e.Payload); err != nil && isJSON(r) {
+			http.Error(w, "decoding body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	posts, err := h.Mapper.Map(e)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	for i, p := range posts {
+		if p.Message != nil && p.Message.UUID == "" && delivery != "" {
+			p.Message.UUID = postUUID(r.URL.Path, delivery, i)
+		}
+		if err := h.post(p); err != nil {
+			http.Error(w, "posting to Flowdock: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postUUID returns the name-based UUID of the i-th post of a delivery to
+// the handler at path.
+func postUUID(path, delivery string, i int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%d", path, delivery, i)))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func isJSON(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return strings.HasPrefix(ct, "application/json") || strings.HasSuffix(strings.Split(ct, ";")[0], "+json")
+}
+
+func (h *Handler) post(p Post) error {
+	var err error
+	switch {
+	case p.Message != nil && h.Outbox != nil:
+		_, err = h.Outbox.Send(p.Message)
+	case p.Message != nil:
+		_, _, err = h.Client.Messages.Create(p.Message)
+	case p.Inbox != nil && h.Outbox != nil:
+		_, err = h.Outbox.SendInbox(p.Token, p.Inbox)
+	case p.Inbox != nil:
+		_, _, err = h.Client.Inbox.Create(p.Token, p.Inbox)
+	default:
+		err = fmt.Errorf("webhook: post has no message")
+	}
+	return err
+}
@@ -0,0 +1,349 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wm/go-flowdock/flowdock"
+	"github.com/wm/go-flowdock/flowdocktest"
+	"github.com/wm/go-flowdock/outbox"
+)
+
+func seed(t *testing.T) *flowdocktest.Server {
+	s := flowdocktest.NewServer()
+	t.Cleanup(s.Close)
+	s.AddOrganization("org", "Organization")
+	bot := s.AddUser("bot", "Bot", "bot@example.com")
+	if _, err := s.AddFlow("org", "flow", *bot.Id); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func deliver(h http.Handler, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandler(t *testing.T) {
+	s := seed(t)
+	echo := MapperFunc(func(e *Event) ([]Post, error) {
+		text, _ := e.Payload.(map[string]interface{})["text"].(string)
+		if text == "" {
+			return nil, errors.New("no text")
+		}
+		return []Post{{Message: &flowdock.MessagesCreateOptions{FlowID: "org:flow", Content: text}}}, nil
+	})
+	h := &Handler{Client: s.Client(), Mapper: echo, Verifier: GitHubSignature("secret")}
+
+	body := `{"text":"hello"}`
+	if w := deliver(h, body, "X-Hub-Signature-256", sign("secret", body)); w.Code != http.StatusNoContent {
+		t.Fatalf("delivering a webhook answered %v %v", w.Code, w.Body)
+	}
+	if got := s.Messages("org", "flow"); len(got) != 1 || got[0].Content().String() != "hello" {
+		t.Errorf("flow has messages %+v", got)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		sig    string
+		want   int
+	}{
+		{"GET", "GET", "", "", http.StatusMethodNotAllowed},
+		{"unsigned", "POST", body, "", http.StatusUnauthorized},
+		{"wrong secret", "POST", body, sign("guess", body), http.StatusUnauthorized},
+		{"changed body", "POST", `{"text":"bye"}`, sign("secret", body), http.StatusUnauthorized},
+		{"bad JSON", "POST", `{"text":`, sign("secret", `{"text":`), http.StatusBadRequest},
+		{"mapper error", "POST", `{}`, sign("secret", `{}`), http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/hook", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Hub-Signature-256", tt.sig)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%v: answered %v, want %v", tt.name, w.Code, tt.want)
+		}
+	}
+	if n := len(s.Messages("org", "flow")); n != 1 {
+		t.Errorf("rejected webhooks posted %d messages", n-1)
+	}
+
+	h.Mapper = MapperFunc(func(*Event) ([]Post, error) {
+		return []Post{{Message: &flowdock.MessagesCreateOptions{FlowID: "org:missing", Content: "lost"}}}, nil
+	})
+	if w := deliver(h, body, "X-Hub-Signature-256", sign("secret", body)); w.Code != http.StatusBadGateway {
+		t.Errorf("posting to a missing flow answered %v, want 502", w.Code)
+	}
+}
+
+func TestHandler_redelivery(t *testing.T) {
+	s := seed(t)
+	second := "org:missing"
+	h := &Handler{Client: s.Client(), Mapper: MapperFunc(func(*Event) ([]Post, error) {
+		return []Post{
+			{Message: &flowdock.MessagesCreateOptions{FlowID: "org:flow", Content: "first"}},
+			{Message: &flowdock.MessagesCreateOptions{FlowID: second, Content: "second"}},
+		}, nil
+	})}
+
+	if w := deliver(h, `{}`, "X-GitHub-Delivery", "d1"); w.Code != http.StatusBadGateway {
+		t.Fatalf("posting to a missing flow answered %v, want 502", w.Code)
+	}
+	second = "org:flow"
+	if w := deliver(h, `{}`, "X-GitHub-Delivery", "d1"); w.Code != http.StatusNoContent {
+		t.Fatalf("redelivering the webhook answered %v %v", w.Code, w.Body)
+	}
+	if w := deliver(h, `{}`, "X-GitHub-Delivery", "d2"); w.Code != http.StatusNoContent {
+		t.Fatalf("delivering another webhook answered %v %v", w.Code, w.Body)
+	}
+	deliver(h, `{}`)
+	deliver(h, `{}`)
+
+	var uuids []string
+	for _, m := range s.Messages("org", "flow") {
+		uuids = append(uuids, *m.UUID)
+	}
+	if len(uuids) != 9 {
+		t.Fatalf("flow has messages with UUIDs %q, want 9", uuids)
+	}
+	if uuids[0] != uuids[1] || uuids[1] == uuids[2] {
+		t.Errorf("redelivery posted UUIDs %q after %q, want the first repeated", uuids[1:3], uuids[0])
+	}
+	if uuids[3] == uuids[1] || uuids[4] == uuids[2] {
+		t.Errorf("another delivery posted UUIDs %q, as the first", uuids[3:5])
+	}
+	if uuids[5] == uuids[7] || uuids[6] == uuids[8] {
+		t.Errorf("two deliveries of the same body without an ID posted UUIDs %q", uuids[5:])
+	}
+}
+
+func TestHandler_outbox(t *testing.T) {
+	s := seed(t)
+	out, err := outbox.New(s.Client(), nil)
+	if err != nil {
+		t.Fatalf("outbox.New returned error: %v", err)
+	}
+	h := &Handler{Outbox: out, Mapper: MapperFunc(func(*Event) ([]Post, error) {
+		return []Post{
+			{Message: &flowdock.MessagesCreateOptions{FlowID: "org:flow", Event: "message", Content: "queued"}},
+			{Token: s.FlowToken("org", "flow"), Inbox: &flowdock.InboxCreateOptions{Source: "CI", FromAddress: "ci@example.com", Subject: "Build", Content: "passed"}},
+		}, nil
+	})}
+	if w := deliver(h, `{}`); w.Code != http.StatusNoContent {
+		t.Fatalf("delivering a webhook answered %v %v", w.Code, w.Body)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := out.Close(ctx); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if n := len(s.Messages("org", "flow")); n != 2 {
+		t.Errorf("flow has %d messages, want 2", n)
+	}
+}
+
+func TestHandler_maxBodySize(t *testing.T) {
+	h := &Handler{Mapper: MapperFunc(func(*Event) ([]Post, error) { return nil, nil }), MaxBodySize: 10}
+	if w := deliver(h, `{"text":"too long"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("an oversized body answered %v, want 400", w.Code)
+	}
+}
+
+const alertmanagerPayload = `{
+	"status": "firing",
+	"commonLabels": {"severity": "critical"},
+	"alerts": [
+		{"status": "firing", "labels": {"alertname": "DiskFull", "instance": "db1"}, "annotations": {"summary": "disk 95% full"}},
+		{"status": "firing", "labels": {"alertname": "HighLoad", "instance": "web2"}, "annotations": {}}
+	]
+}`
+
+func TestTemplate(t *testing.T) {
+	s := seed(t)
+	alerts, err := NewTemplate(TemplateConfig{
+		Flow:    "org:flow",
+		Content: `{{if eq .status "firing"}}{{range .alerts}}[{{.labels.alertname}}] {{.labels.instance}} {{.annotations.summary}}{{"\n"}}{{end}}{{end}}`,
+		Tags:    []string{"alert", "{{.commonLabels.severity}}", "{{.commonLabels.team}}"},
+	})
+	if err != nil {
+		t.Fatalf("NewTemplate returned error: %v", err)
+	}
+	h := &Handler{Client: s.Client(), Mapper: alerts}
+
+	if w := deliver(h, alertmanagerPayload); w.Code != http.StatusNoContent {
+		t.Fatalf("delivering a webhook answered %v %v", w.Code, w.Body)
+	}
+	if w := deliver(h, `{"status":"resolved","alerts":[]}`); w.Code != http.StatusNoContent {
+		t.Fatalf("delivering an ignored webhook answered %v %v", w.Code, w.Body)
+	}
+
+	messages := s.Messages("org", "flow")
+	if len(messages) != 1 {
+		t.Fatalf("flow has %d messages, want 1", len(messages))
+	}
+	if got, want := messages[0].Content().String(), "[DiskFull] db1 disk 95% full\n[HighLoad] web2"; got != want {
+		t.Errorf("message content = %q, want %q", got, want)
+	}
+	if got := *messages[0].Tags; !reflect.DeepEqual(got, []string{"alert", "critical"}) {
+		t.Errorf("message tags = %q", got)
+	}
+}
+
+func TestTemplate_inbox(t *testing.T) {
+	s := seed(t)
+	build, err := NewTemplate(TemplateConfig{
+		Token:       s.FlowToken("org", "flow"),
+		Subject:     `Build {{.number}} {{.result}}`,
+		FromAddress: "ci@example.com",
+		Source:      "CI",
+		Link:        "{{.url}}",
+		Content:     `<p>{{.branch}}: {{join ", " .changes | truncate 40}}</p>`,
+	})
+	if err != nil {
+		t.Fatalf("NewTemplate returned error: %v", err)
+	}
+	posts, err := build.Map(&Event{Payload: map[string]interface{}{
+		"number": 1024, "result": "passed", "url": "https://ci.example.com/1024", "branch": "main",
+		"changes": []interface{}{"Fix the login form", "Update dependencies", "Add metrics"},
+	}})
+	if err != nil {
+		t.Fatalf("Map returned error: %v", err)
+	}
+	want := []Post{{Token: s.FlowToken("org", "flow"), Inbox: &flowdock.InboxCreateOptions{
+		Subject:     "Build 1024 passed",
+		FromAddress: "ci@example.com",
+		Source:      "CI",
+		Link:        "https://ci.example.com/1024",
+		Content:     "<p>main: Fix the login form, Update dependencies,…</p>",
+	}}}
+	if !reflect.DeepEqual(posts, want) {
+		t.Errorf("Map returned %+v, want %+v", posts[0].Inbox, want[0].Inbox)
+	}
+
+	h := &Handler{Client: s.Client(), Mapper: build}
+	if w := deliver(h, `{"number":1025,"result":"failed","branch":"dev","changes":[]}`); w.Code != http.StatusNoContent {
+		t.Fatalf("delivering a webhook answered %v %v", w.Code, w.Body)
+	}
+	if messages := s.Messages("org", "flow"); len(messages) != 1 || *messages[0].Event != "mail" {
+		t.Errorf("flow has messages %+v, want the inbox message", messages)
+	}
+}
+
+func TestNewTemplate_invalid(t *testing.T) {
+	tests := map[string]TemplateConfig{
+		"no flow":          {Content: "x"},
+		"flow and token":   {Flow: "f", Token: "t", Content: "x"},
+		"inbox no subject": {Token: "t", FromAddress: "a@example.com", Source: "s", Content: "x"},
+		"bad template":     {Flow: "f", Content: "{{.x"},
+		"bad tag":          {Flow: "f", Content: "x", Tags: []string{"{{end}}"}},
+		"unknown function": {Flow: "f", Content: "{{upper .x}}"},
+	}
+	for name, c := range tests {
+		if _, err := NewTemplate(c); err == nil {
+			t.Errorf("%v: NewTemplate returned no error", name)
+		}
+	}
+}
+
+const (
+	pushPayload = `{
+		"ref": "refs/heads/main",
+		"compare": "https://github.com/acme/web/compare/1a2b...3c4d",
+		"pusher": {"name": "alice"},
+		"sender": {"login": "alice"},
+		"repository": {"name": "web"},
+		"commits": [
+			{"id": "3c4d5e6f7a8b", "message": "Fix the login form\n\nIt lost the password.", "author": {"name": "Alice", "username": "alice"}},
+			{"id": "9e8d7c6b5a4f", "message": "Update dependencies"}
+		]
+	}`
+	pullRequestPayload = `{
+		"action": "closed",
+		"pull_request": {"url": "https://api.github.com/repos/acme/web/pulls/12", "number": 12, "title": "Add metrics", "merged": true},
+		"sender": {"login": "bob"},
+		"repository": {"name": "web"}
+	}`
+	issuePayload = `{
+		"action": "opened",
+		"issue": {"url": "https://api.github.com/repos/acme/web/issues/7", "number": 7, "title": "Login is slow"},
+		"sender": {"login": "carol"},
+		"repository": {"name": "web"}
+	}`
+)
+
+func TestGitHub(t *testing.T) {
+	g := &GitHub{Flow: "org:flow", Tags: []string{"web"}}
+	tests := []struct {
+		event, payload, content string
+	}{
+		{"push", pushPayload, "alice pushed 2 commits to branch main in web\n\n" +
+			"- 3c4d5e6 Fix the login form (alice)\n- 9e8d7c6 Update dependencies\n\n" +
+			"https://github.com/acme/web/compare/1a2b...3c4d"},
+		{"pull_request", pullRequestPayload, "bob merged pull request 12 in web: Add metrics\n\n" +
+			"https://api.github.com/repos/acme/web/pulls/12"},
+		{"issues", issuePayload, "carol opened issue 7 in web: Login is slow\n\n" +
+			"https://api.github.com/repos/acme/web/issues/7"},
+	}
+	for _, tt := range tests {
+		posts, err := g.Map(&Event{Header: http.Header{"X-Github-Event": {tt.event}}, Body: []byte(tt.payload)})
+		if err != nil {
+			t.Errorf("%v: Map returned error: %v", tt.event, err)
+			continue
+		}
+		want := []Post{{Message: &flowdock.MessagesCreateOptions{
+			FlowID:  "org:flow",
+			Event:   "message",
+			Content: tt.content,
+			Tags:    []string{"github", tt.event, "web"},
+		}}}
+		if !reflect.DeepEqual(posts, want) {
+			t.Errorf("%v: Map returned\n%+v\nwant\n%+v", tt.event, posts[0].Message, want[0].Message)
+		}
+	}
+}
+
+func TestGitHub_ignored(t *testing.T) {
+	g := &GitHub{Flow: "org:flow"}
+	labeled := strings.Replace(issuePayload, `"opened"`, `"labeled"`, 1)
+	for event, payload := range map[string]string{"ping": `{"zen":"Keep it simple."}`, "issues": labeled} {
+		posts, err := g.Map(&Event{Header: http.Header{"X-Github-Event": {event}}, Body: []byte(payload)})
+		if err != nil || len(posts) != 0 {
+			t.Errorf("%v: Map returned %+v, %v; want the event ignored", event, posts, err)
+		}
+	}
+
+	g.AllActions = true
+	posts, _ := g.Map(&Event{Header: http.Header{"X-Github-Event": {"issues"}}, Body: []byte(labeled)})
+	if len(posts) != 1 {
+		t.Errorf("Map with AllActions returned %+v, want a message", posts)
+	}
+
+	if _, err := g.Map(&Event{Header: http.Header{"X-Github-Event": {"push"}}, Body: []byte(`{}`)}); err == nil {
+		t.Error("Map of a push without a repository returned no error")
+	}
+}